@@ -7,6 +7,7 @@ package api
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -32,9 +33,37 @@ type Client struct {
 // ServerInfo defines information about the cosi-server. description, version, and
 // list of supported operating systems
 type ServerInfo struct {
-	Description string   `json:"description"`
-	Version     string   `json:"version"`
-	Supported   []string `json:"supported"`
+	Description     string               `json:"description"`
+	Version         string               `json:"version"`
+	Supported       []string             `json:"supported"` // deprecated, "dist vers arch" strings, use Platforms
+	Platforms       []Platform           `json:"platforms,omitempty"`
+	TemplateWatcher *TemplateWatcherInfo `json:"template_watcher,omitempty"`
+}
+
+// Platform defines a supported operating system and one of its agent
+// packages. Type and dist are lower case, vers is a version or version
+// range (e.g. ">=16.04 <18.04") as configured.
+type Platform struct {
+	Type         string `json:"type"`
+	Dist         string `json:"dist"`
+	Vers         string `json:"vers"`
+	Arch         string `json:"arch"`
+	PackageKind  string `json:"package_kind"` // package type, e.g. rpm, deb, ips, apk, freebsd-pkg, msi, tgz
+	AgentVersion string `json:"agent_version,omitempty"`
+	Channel      string `json:"channel"`
+	Status       string `json:"status"`            // lifecycle status, e.g. supported, deprecated, eol, blocked
+	EOL          string `json:"eol,omitempty"`     // end of life date (YYYY-MM-DD)
+	Warning      string `json:"warning,omitempty"` // lifecycle warning, for platforms which are not supported
+}
+
+// TemplateWatcherInfo defines the status of the cosi-server template directory
+// watcher (only present when template caching and watching are enabled)
+type TemplateWatcherInfo struct {
+	Directory    string     `json:"directory"`
+	Running      bool       `json:"running"`
+	Evictions    uint64     `json:"evictions"`
+	LastEviction *time.Time `json:"last_eviction,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
 }
 
 // GraphFilters defines the include/exclude filters for variable graphs (e.g. disk, fs, network interfaces)
@@ -45,11 +74,73 @@ type GraphFilters struct {
 
 // Package defines the agent package to use for a specific operating system
 type Package struct {
+	File          string         `json:"package_file,omitempty"`
+	URL           string         `json:"package_url,omitempty"`
+	Name          string         `json:"package_name,omitempty"`
+	Type          string         `json:"package_type,omitempty"`  // rpm, deb, ips, apk, freebsd-pkg, msi or tgz
+	SHA256        string         `json:"sha256,omitempty"`        // hex sha256 checksum of the package file
+	SignatureURL  string         `json:"signature_url,omitempty"` // detached signature of the package file
+	PublisherURL  string         `json:"publisher_url,omitempty"`
+	PublisherName string         `json:"publisher_name,omitempty"`
+	Match         *PackageMatch  `json:"match,omitempty"`
+	Channel       string         `json:"channel,omitempty"`       // release channel, e.g. stable, beta, lts
+	AgentVersion  string         `json:"agent_version,omitempty"` // agent version of the package, if configured
+	Rollout       string         `json:"rollout,omitempty"`       // stable or canary, if the package has a canary
+	Canary        *PackageCanary `json:"canary,omitempty"`        // canary package (package versions only)
+	Repo          *PackageRepo   `json:"repo,omitempty"`          // yum or apt repository containing the package, if served by cosi-server
+	Status        string         `json:"status,omitempty"`        // lifecycle status of the platform, e.g. deprecated, eol
+	EOL           string         `json:"eol,omitempty"`           // end of life date of the platform (YYYY-MM-DD)
+	Warning       string         `json:"warning,omitempty"`       // lifecycle warning, for platforms which are not supported
+}
+
+// PackageRepo defines the yum or apt repository containing a package
+type PackageRepo struct {
+	Type string `json:"type"` // yum or apt
+	URL  string `json:"url"`  // yum baseurl, or apt repository url (suite stable, component main)
+}
+
+// PackageCanary defines a package served, in place of a package, to a percentage of hosts
+type PackageCanary struct {
 	File          string `json:"package_file,omitempty"`
 	URL           string `json:"package_url,omitempty"`
 	Name          string `json:"package_name,omitempty"`
+	Type          string `json:"package_type,omitempty"`
+	SHA256        string `json:"sha256,omitempty"`
+	SignatureURL  string `json:"signature_url,omitempty"`
 	PublisherURL  string `json:"publisher_url,omitempty"`
 	PublisherName string `json:"publisher_name,omitempty"`
+	AgentVersion  string `json:"agent_version,omitempty"`
+	Percent       int    `json:"percent"`
+}
+
+// PackageOptions selects one of the agent packages for a specific operating system
+type PackageOptions struct {
+	Channel      string // release channel, the server's default channel if blank
+	AgentVersion string // pinned agent version
+	HostID       string // host identifier for canary rollout, the client ip if blank
+}
+
+// PackageVersions lists the agent packages available for a specific operating system
+type PackageVersions struct {
+	DefaultChannel string    `json:"default_channel"`
+	Packages       []Package `json:"packages"`
+}
+
+// PackageMatch identifies the package configuration rule used for the operating system
+type PackageMatch struct {
+	Dist string `json:"dist"` // distro of the package configuration entry
+	Rule string `json:"rule"` // exact, range or nearest_lower
+	Vers string `json:"vers"` // vers of the package configuration entry
+}
+
+// TemplateListItem defines a template available for a specific operating system
+type TemplateListItem struct {
+	ID          string `json:"id"`          // type-name, e.g. graph-vm
+	Type        string `json:"type"`        // check, dashboard, graph, worksheet
+	Name        string `json:"name"`        // e.g. vm
+	Version     string `json:"version"`     // template version
+	Description string `json:"description"` // template description
+	Level       string `json:"level"`       // level the template resolved from: arch, vers, dist, type or default
 }
 
 // TOML template structs
@@ -62,44 +153,44 @@ type Package struct {
    }
 */
 
-// Template defines a TOML template received from the COSI API
+// Template defines a template received from the COSI API (TOML, JSON or YAML)
 type Template struct {
-	Type        string                    `toml:"type"`        // common, required
-	Name        string                    `toml:"name"`        // common, required
-	Version     string                    `toml:"version"`     // common, required
-	Description string                    `toml:"description"` // common
-	Configs     map[string]TemplateConfig `toml:"configs"`     // common, required
-	Variable    bool                      `toml:"variable"`    // graph only
-	Filter      TemplateFilter            `toml:"filters"`     // graph only
+	Type        string                    `toml:"type" json:"type" yaml:"type"`                      // common, required
+	Name        string                    `toml:"name" json:"name" yaml:"name"`                      // common, required
+	Version     string                    `toml:"version" json:"version" yaml:"version"`             // common, required
+	Description string                    `toml:"description" json:"description" yaml:"description"` // common
+	Configs     map[string]TemplateConfig `toml:"configs" json:"configs" yaml:"configs"`             // common, required
+	Variable    bool                      `toml:"variable" json:"variable" yaml:"variable"`          // graph only
+	Filter      TemplateFilter            `toml:"filters" json:"filters" yaml:"filters"`             // graph only
 }
 
 // TemplateFilter defines the include and exclude regex lists to use
 // for 'variable' graphs and datapoints
 type TemplateFilter struct {
-	Include []string `toml:"include"`
-	Exclude []string `toml:"exclude"`
+	Include []string `toml:"include" json:"include" yaml:"include"`
+	Exclude []string `toml:"exclude" json:"exclude" yaml:"exclude"`
 }
 
 // TemplateConfig defines a specific configuration template instance
 type TemplateConfig struct {
-	Datapoints []TemplateDatapoint `toml:"datapoints"` // graph only
-	Template   string              `toml:"template"`   // common, required
-	Variable   bool                `toml:"variable"`   // graph only
-	Widgets    []TemplateWidget    `toml:"widgets"`    // dashboard only
+	Datapoints []TemplateDatapoint `toml:"datapoints" json:"datapoints" yaml:"datapoints"` // graph only
+	Template   string              `toml:"template" json:"template" yaml:"template"`       // common, required
+	Variable   bool                `toml:"variable" json:"variable" yaml:"variable"`       // graph only
+	Widgets    []TemplateWidget    `toml:"widgets" json:"widgets" yaml:"widgets"`          // dashboard only
 }
 
 // TemplateDatapoint defines a graph datapoint template
 type TemplateDatapoint struct {
-	Variable bool           `toml:"variable"`
-	Filter   TemplateFilter `toml:"filter"`       // variable datapoint only
-	MetricRx string         `toml:"metric_regex"` // variable datapoint only
-	Template string         `toml:"template"`     // required
+	Variable bool           `toml:"variable" json:"variable" yaml:"variable"`
+	Filter   TemplateFilter `toml:"filter" json:"filter" yaml:"filter"`                   // variable datapoint only
+	MetricRx string         `toml:"metric_regex" json:"metric_regex" yaml:"metric_regex"` // variable datapoint only
+	Template string         `toml:"template" json:"template" yaml:"template"`             // required
 }
 
 // TemplateWidget defines a dashboard widget template
 type TemplateWidget struct {
-	GraphName string `toml:"graph_name"` // graph widget only
-	Template  string `toml:"template"`   // required
+	GraphName string `toml:"graph_name" json:"graph_name" yaml:"graph_name"` // graph widget only
+	Template  string `toml:"template" json:"template" yaml:"template"`       // required
 }
 
 const (
@@ -107,6 +198,14 @@ const (
 	TemplateFileExtension = ".toml"
 )
 
+// Template formats which can be requested from the COSI API, templates are
+// stored and served as TOML by default
+const (
+	TemplateFormatTOML = "toml"
+	TemplateFormatJSON = "json"
+	TemplateFormatYAML = "yaml"
+)
+
 // New creates a new cosi-server api client
 func New(cfg *Config) (*Client, error) {
 	if cfg == nil {
@@ -6,14 +6,23 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
 // FetchPackage retrieves information about what agent package to use for a
-// specific operating system from the cosi-server API
-func (c *Client) FetchPackage(format string) (*Package, error) {
+// specific operating system from the cosi-server API. The package from the
+// server's default release channel is returned unless options select a
+// channel and/or agent version.
+func (c *Client) FetchPackage(format string, opts ...PackageOptions) (*Package, error) {
 	if format == "" {
 		format = "json"
 	}
@@ -29,7 +38,21 @@ func (c *Client) FetchPackage(format string) (*Package, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "setting URL path")
 	}
-	u.RawQuery = c.genQueryString(nil, true)
+	var args *map[string]string
+	if len(opts) > 0 {
+		a := map[string]string{}
+		if opts[0].Channel != "" {
+			a["channel"] = opts[0].Channel
+		}
+		if opts[0].AgentVersion != "" {
+			a["agent_version"] = opts[0].AgentVersion
+		}
+		if opts[0].HostID != "" {
+			a["host_id"] = opts[0].HostID
+		}
+		args = &a
+	}
+	u.RawQuery = c.genQueryString(args, true)
 
 	headers := map[string]string{"Accept": accept}
 	data, err := c.get(u, &headers)
@@ -44,3 +67,99 @@ func (c *Client) FetchPackage(format string) (*Package, error) {
 
 	return &p, nil
 }
+
+// FetchPackageVersions retrieves the agent packages (release channels, agent
+// versions) available for a specific operating system from the cosi-server API
+func (c *Client) FetchPackageVersions() (*PackageVersions, error) {
+	u, err := c.cosiURL.Parse("/package/versions/")
+	if err != nil {
+		return nil, errors.Wrap(err, "setting URL path")
+	}
+	u.RawQuery = c.genQueryString(nil, true)
+
+	data, err := c.get(u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching package versions")
+	}
+
+	var v PackageVersions
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, errors.Wrap(err, "parsing package versions")
+	}
+
+	return &v, nil
+}
+
+// Verify checks the content of a downloaded package file against the
+// package's sha256 checksum. An error is returned if the package has no
+// checksum or the content does not match. The package signature is checked
+// separately, see VerifySignature.
+func (p *Package) Verify(r io.Reader) error {
+	if p.SHA256 == "" {
+		return errors.New("package has no sha256 checksum")
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return errors.Wrap(err, "reading package")
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if sum != strings.ToLower(p.SHA256) {
+		return errors.Errorf("package checksum mismatch, expected %s got %s", p.SHA256, sum)
+	}
+
+	return nil
+}
+
+// VerifyFile checks a downloaded package file against the package's sha256
+// checksum, see Verify
+func (p *Package) VerifyFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "opening package")
+	}
+	defer f.Close()
+
+	return p.Verify(f)
+}
+
+// VerifySignature checks a downloaded package file against its detached
+// signature (downloaded from SignatureURL) with the publisher's public key
+// file (armored or binary). gpg is used, with a temporary home directory so
+// the user's keyrings are neither used nor modified. An error is returned if
+// the package has no signature, gpg is not found or the signature is not
+// valid.
+func (p *Package) VerifySignature(file, sigFile, keyFile string) error {
+	if p.SignatureURL == "" {
+		return errors.New("package has no signature")
+	}
+
+	gpg, err := exec.LookPath("gpg")
+	if err != nil {
+		return errors.Wrap(err, "gpg required to verify package signature")
+	}
+
+	home, err := ioutil.TempDir("", "cosi-gpg")
+	if err != nil {
+		return errors.Wrap(err, "creating gpg home directory")
+	}
+	defer os.RemoveAll(home)
+
+	run := func(args ...string) error {
+		cmd := exec.Command(gpg, append([]string{"--homedir", home, "--batch", "--quiet"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Wrap(err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	if err := run("--import", keyFile); err != nil {
+		return errors.Wrap(err, "importing package key")
+	}
+	if err := run("--verify", sigFile, file); err != nil {
+		return errors.Wrap(err, "package signature verification failed")
+	}
+
+	return nil
+}
@@ -7,8 +7,12 @@ package api
 
 import (
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -67,3 +71,207 @@ func TestPackage(t *testing.T) {
 		}
 	}
 }
+
+func TestPackageOptions(t *testing.T) {
+	t.Log("Testing Package (options)")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("channel") == "beta" && q.Get("agent_version") == "":
+			_, _ = w.Write([]byte(`{"package_file":"circonus-agent-1.2.0-beta.1-1.el7.x86_64.rpm","channel":"beta","agent_version":"1.2.0-beta.1"}`))
+		case q.Get("channel") == "" && q.Get("agent_version") == "1.0.0":
+			_, _ = w.Write([]byte(`{"package_file":"circonus-agent-1.0.0-1.el7.x86_64.rpm","channel":"stable","agent_version":"1.0.0"}`))
+		case q.Get("host_id") == "canary-host":
+			_, _ = w.Write([]byte(`{"package_file":"circonus-agent-1.2.0-1.el7.x86_64.rpm","channel":"stable","agent_version":"1.2.0","rollout":"canary"}`))
+		case q.Get("channel") == "" && q.Get("agent_version") == "":
+			_, _ = w.Write([]byte(`{"package_file":"circonus-agent-1.1.0-1.el7.x86_64.rpm","channel":"stable","agent_version":"1.1.0"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New(&Config{OSType: "Linux", OSDistro: "CentOS", OSVersion: "7", SysArch: "x86_64", CosiURL: ts.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	tests := []struct {
+		name   string
+		opts   []PackageOptions
+		expect string
+	}{
+		{"default", nil, "1.1.0"},
+		{"empty options", []PackageOptions{{}}, "1.1.0"},
+		{"channel", []PackageOptions{{Channel: "beta"}}, "1.2.0-beta.1"},
+		{"agent version", []PackageOptions{{AgentVersion: "1.0.0"}}, "1.0.0"},
+		{"host id", []PackageOptions{{HostID: "canary-host"}}, "1.2.0"},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+		p, err := c.FetchPackage("json", test.opts...)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if p.AgentVersion != test.expect {
+			t.Fatalf("expected %s, got %#v", test.expect, p)
+		}
+	}
+}
+
+func TestPackageVersions(t *testing.T) {
+	t.Log("Testing PackageVersions")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/package/versions/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"default_channel":"stable","packages":[{"package_file":"circonus-agent-1.1.0-1.el7.x86_64.rpm","channel":"stable","agent_version":"1.1.0","match":{"dist":"centos","rule":"exact","vers":"7"}},{"package_file":"circonus-agent-1.2.0-beta.1-1.el7.x86_64.rpm","channel":"beta","agent_version":"1.2.0-beta.1","match":{"dist":"centos","rule":"exact","vers":"7"}}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := New(&Config{OSType: "Linux", OSDistro: "CentOS", OSVersion: "7", SysArch: "x86_64", CosiURL: ts.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	v, err := c.FetchPackageVersions()
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if v.DefaultChannel != "stable" || len(v.Packages) != 2 || v.Packages[1].Channel != "beta" || v.Packages[1].Match == nil {
+		t.Fatalf("unexpected versions %#v", v)
+	}
+}
+
+func TestPackageVerify(t *testing.T) {
+	t.Log("Testing Package.Verify")
+
+	content := "test"
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tests := []struct {
+		name        string
+		sha256      string
+		shouldError bool
+		errorExpect string
+	}{
+		{"no checksum", "", true, "package has no sha256 checksum"},
+		{"mismatch", strings.Repeat("0", 64), true, "package checksum mismatch, expected " + strings.Repeat("0", 64) + " got " + sum},
+		{"valid", sum, false, ""},
+		{"valid (upper case)", strings.ToUpper(sum), false, ""},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+
+		p := Package{SHA256: test.sha256}
+		err := p.Verify(strings.NewReader(content))
+		if test.shouldError {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if err.Error() != test.errorExpect {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	t.Log("\tfile")
+	{
+		f, err := ioutil.TempFile("", "cosi-package")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		f.Close()
+
+		p := Package{SHA256: sum}
+		if err := p.VerifyFile(f.Name()); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if err := p.VerifyFile(f.Name() + ".missing"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestPackageVerifySignature(t *testing.T) {
+	t.Log("Testing Package.VerifySignature")
+
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	dir, err := ioutil.TempDir("", "cosi-package")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	gpgHome := filepath.Join(dir, "gnupg")
+	if err := os.Mkdir(gpgHome, 0700); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	defer func() { _ = exec.Command("gpgconf", "--homedir", gpgHome, "--kill", "all").Run() }()
+	pkgFile := filepath.Join(dir, "package")
+	if err := ioutil.WriteFile(pkgFile, []byte("package"), 0644); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	otherFile := filepath.Join(dir, "other")
+	if err := ioutil.WriteFile(otherFile, []byte("other package"), 0644); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	for _, args := range [][]string{
+		{"--quick-gen-key", "cosi test <test@example.com>", "ed25519", "sign", "never"},
+		{"--armor", "--output", filepath.Join(dir, "key.asc"), "--export"},
+		{"--output", pkgFile + ".sig", "--detach-sign", pkgFile},
+		{"--output", otherFile + ".sig", "--detach-sign", otherFile},
+	} {
+		cmd := exec.Command("gpg", append([]string{"--homedir", gpgHome, "--batch", "--passphrase", ""}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("gpg %v: %v (%s)", args, err, string(out))
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sigURL      string
+		sig         string
+		key         string
+		shouldError bool
+	}{
+		{"no signature", "", pkgFile + ".sig", "key.asc", true},
+		{"valid", "http://cosi/packages/package.sig", pkgFile + ".sig", "key.asc", false},
+		{"invalid", "http://cosi/packages/package.sig", otherFile + ".sig", "key.asc", true},
+		{"missing signature", "http://cosi/packages/package.sig", pkgFile + ".missing", "key.asc", true},
+		{"missing key", "http://cosi/packages/package.sig", pkgFile + ".sig", "missing.asc", true},
+		{"invalid key", "http://cosi/packages/package.sig", pkgFile + ".sig", "package", true},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+
+		p := Package{SignatureURL: test.sigURL}
+		err := p.VerifySignature(pkgFile, test.sig, filepath.Join(dir, test.key))
+		if test.shouldError {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// FetchPlatforms retrieves the supported operating systems from the
+// cosi-server API, a record for each agent package (e.g. release channel)
+// of each type, distro, version, architecture combination. The client's
+// operating system is not used.
+func (c *Client) FetchPlatforms() ([]Platform, error) {
+	u, err := c.cosiURL.Parse("/platforms/")
+	if err != nil {
+		return nil, errors.Wrap(err, "setting URL path")
+	}
+
+	data, err := c.get(u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching platforms")
+	}
+
+	var list []Platform
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrap(err, "parsing platforms")
+	}
+
+	return list, nil
+}
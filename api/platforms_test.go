@@ -0,0 +1,61 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchPlatforms(t *testing.T) {
+	t.Log("Testing FetchPlatforms")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/platforms/" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"type":"linux","dist":"ubuntu","vers":"18.04","arch":"x86_64","package_kind":"deb","agent_version":"1.0.0","channel":"stable","status":"supported"}]`))
+	}))
+	defer ts.Close()
+
+	t.Log("\tvalid")
+	{
+		c, err := New(&Config{OSType: "linux", OSDistro: "ubuntu", OSVersion: "18.04", SysArch: "x86_64", CosiURL: ts.URL})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+
+		list, err := c.FetchPlatforms()
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		expect := Platform{Type: "linux", Dist: "ubuntu", Vers: "18.04", Arch: "x86_64", PackageKind: "deb", AgentVersion: "1.0.0", Channel: "stable", Status: "supported"}
+		if len(list) != 1 || list[0] != expect {
+			t.Fatalf("unexpected platforms %#v", list)
+		}
+	}
+
+	t.Log("\tinvalid (json/parse)")
+	{
+		ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("invalid"))
+		}))
+		defer ts2.Close()
+
+		c, err := New(&Config{OSType: "linux", OSDistro: "ubuntu", OSVersion: "18.04", SysArch: "x86_64", CosiURL: ts2.URL})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+
+		if _, err := c.FetchPlatforms(); err == nil {
+			t.Fatal("expected error")
+		} else if err.Error() != "parsing platforms: invalid character 'i' looking for beginning of value" {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+}
@@ -38,12 +38,23 @@ func (c *Client) FetchTemplate(id string) (*Template, error) {
 // FetchRawTemplate retrieves a template from the cosi-server API and
 // returns the raw data (does not parse the JSON) or an error. This
 // call is used by cosi-tool when it intends to store the template
-// on disk.
-func (c *Client) FetchRawTemplate(id string) ([]byte, error) {
+// on disk. The template is TOML unless a format is specified (one of
+// TemplateFormatTOML, TemplateFormatJSON or TemplateFormatYAML).
+func (c *Client) FetchRawTemplate(id string, format ...string) ([]byte, error) {
 	if id == "" {
 		return nil, errors.New("invalid id (empty)")
 	}
 
+	var args *map[string]string
+	if len(format) > 0 && format[0] != "" {
+		switch format[0] {
+		case TemplateFormatTOML, TemplateFormatJSON, TemplateFormatYAML:
+			args = &map[string]string{"format": format[0]}
+		default:
+			return nil, errors.Errorf("invalid format (%s)", format[0])
+		}
+	}
+
 	tType, tName, err := parseTemplateID(id)
 	if err != nil {
 		return nil, errors.Wrap(err, "parsing id")
@@ -53,7 +64,7 @@ func (c *Client) FetchRawTemplate(id string) ([]byte, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "setting URL path")
 	}
-	u.RawQuery = c.genQueryString(nil, true)
+	u.RawQuery = c.genQueryString(args, true)
 
 	data, err := c.get(u, nil)
 	if err != nil {
@@ -63,6 +74,28 @@ func (c *Client) FetchRawTemplate(id string) ([]byte, error) {
 	return data, nil
 }
 
+// FetchTemplateList retrieves the list of templates available for the
+// client's operating system from the cosi-server API.
+func (c *Client) FetchTemplateList() ([]TemplateListItem, error) {
+	u, err := c.cosiURL.Parse("/templates/")
+	if err != nil {
+		return nil, errors.Wrap(err, "setting URL path")
+	}
+	u.RawQuery = c.genQueryString(nil, true)
+
+	data, err := c.get(u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching template list")
+	}
+
+	var list []TemplateListItem
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrap(err, "parsing template list")
+	}
+
+	return list, nil
+}
+
 func parseTemplateID(id string) (string, string, error) {
 	idParts := strings.SplitN(id, "-", 2)
 	if len(idParts) != 2 {
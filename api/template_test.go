@@ -6,11 +6,13 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -78,6 +80,10 @@ func genTestServer(t *testing.T) *httptest.Server {
 			}
 			_, _ = w.Write(data)
 		case "/template/graph/cpu/":
+			if r.URL.Query().Get("format") == TemplateFormatJSON {
+				_, _ = w.Write([]byte(`{"type":"graph","name":"cpu"}`))
+				return
+			}
 			data, err := ioutil.ReadFile(path.Join(templateDir, "graph-cpu"+TemplateFileExtension))
 			if err != nil {
 				t.Fatalf("Fetching (%s) (%s)", r.URL.Path, err)
@@ -89,6 +95,8 @@ func genTestServer(t *testing.T) *httptest.Server {
 				t.Fatalf("Fetching (%s) (%s)", r.URL.Path, err)
 			}
 			_, _ = w.Write(data)
+		case "/templates/":
+			_, _ = w.Write([]byte(`[{"id":"graph-cpu","type":"graph","name":"cpu","version":"1.0.0","description":"cpu","level":"default"}]`))
 		case "/template/json/syntax1/":
 			_, _ = w.Write([]byte(`{"type":"foo", "id":"bar}`))
 		default:
@@ -151,3 +159,91 @@ func TestTemplate(t *testing.T) {
 
 	ts.Close()
 }
+
+func TestTemplateList(t *testing.T) {
+	t.Log("Testing FetchTemplateList")
+
+	ts := genTestServer(t)
+	defer ts.Close()
+
+	cfg := &Config{
+		OSType:    "Linux",
+		OSDistro:  "CentOS",
+		OSVersion: "7.1.1408",
+		SysArch:   "x86_64",
+		CosiURL:   ts.URL,
+	}
+
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	list, err := c.FetchTemplateList()
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 template, got %d", len(list))
+	}
+	if list[0].ID != "graph-cpu" || list[0].Level != "default" {
+		t.Fatalf("unexpected template list item (%#v)", list[0])
+	}
+}
+
+func TestRawTemplateFormat(t *testing.T) {
+	t.Log("Testing FetchRawTemplate (format)")
+
+	ts := genTestServer(t)
+	defer ts.Close()
+
+	cfg := &Config{
+		OSType:    "Linux",
+		OSDistro:  "CentOS",
+		OSVersion: "7.1.1408",
+		SysArch:   "x86_64",
+		CosiURL:   ts.URL,
+	}
+
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Log("\tinvalid format")
+	{
+		_, err := c.FetchRawTemplate("graph-cpu", "xml")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if err.Error() != "invalid format (xml)" {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	t.Log("\tjson")
+	{
+		data, err := c.FetchRawTemplate("graph-cpu", TemplateFormatJSON)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		var tmpl Template
+		if err := json.Unmarshal(data, &tmpl); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if tmpl.Type != "graph" || tmpl.Name != "cpu" {
+			t.Fatalf("unexpected template (%#v)", tmpl)
+		}
+	}
+
+	t.Log("\tdefault (toml)")
+	{
+		data, err := c.FetchRawTemplate("graph-cpu")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if !strings.Contains(string(data), `type = "graph"`) {
+			t.Fatalf("expected toml template (%s)", string(data))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/coverage"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/circonus-labs/cosi-server/internal/templates"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	coverageFormat      string
+	coverageContentPath string
+	coveragePackageConf string
+)
+
+// CoverageCmd reports the platform × template coverage matrix
+var CoverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Report which templates resolve for each supported platform",
+	Long: `For every type/dist/vers/arch in the package configuration, show
+the level (arch, vers, dist, type, default) each template resolves from,
+dashboard graph widgets referencing graphs which do not resolve, and files
+in the template tree which are never served.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if coverageContentPath != "" {
+			viper.Set(config.KeyContentPath, coverageContentPath)
+		}
+		if coveragePackageConf != "" {
+			viper.Set(config.KeyPackageConfigFile, coveragePackageConf)
+		}
+
+		p, err := packages.New("")
+		if err != nil {
+			log.Fatal().Err(err).Msg("initializing package list")
+		}
+		t, err := templates.New(nil)
+		if err != nil {
+			log.Fatal().Err(err).Msg("initializing templates")
+		}
+
+		r, err := coverage.Build(p, t)
+		if err != nil {
+			log.Fatal().Err(err).Msg("coverage")
+		}
+		if err := r.Write(os.Stdout, coverageFormat); err != nil {
+			log.Fatal().Err(err).Msg("coverage")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(CoverageCmd)
+
+	CoverageCmd.Flags().StringVar(&coverageFormat, "format", "table", "Output format (table|csv|json)")
+	CoverageCmd.Flags().StringVar(&coverageContentPath, "content-dir", "", "Content directory (default from configuration)")
+	CoverageCmd.Flags().StringVar(&coveragePackageConf, "package-conf", "", "Package configuration file or directory (default from configuration)")
+}
@@ -0,0 +1,66 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	generatePackageDir string
+	generateOverrides  string
+	generateAll        bool
+	generateOutput     string
+)
+
+// GenerateCmd writes a package configuration generated from package files
+var GenerateCmd = &cobra.Command{
+	Use:   "generate-packages",
+	Short: "Generate the package configuration from a local package directory",
+	Long: `Derive type/dist/vers/arch -> package_file entries from the agent
+package file names in a directory, using the package_patterns file name
+patterns, merged with the entries of a hand-written overrides package
+configuration. The newest agent version of each platform is used unless
+--all is set. The same configuration is used by the server when started
+with --package-generate.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := generatePackageDir
+		if dir == "" {
+			dir = viper.GetString(config.KeyLocalPackagePath)
+		}
+
+		data, err := packages.GenerateConfig(dir, generateOverrides, generateAll)
+		if err != nil {
+			log.Fatal().Err(err).Msg("generate package configuration")
+		}
+
+		if generateOutput == "" || generateOutput == "-" {
+			if _, err := os.Stdout.Write(data); err != nil {
+				log.Fatal().Err(err).Msg("generate package configuration")
+			}
+			return
+		}
+		if err := ioutil.WriteFile(generateOutput, data, 0644); err != nil {
+			log.Fatal().Err(err).Msg("generate package configuration")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(GenerateCmd)
+
+	GenerateCmd.Flags().StringVar(&generatePackageDir, "package-dir", "", "Package directory (default local_package_path)")
+	GenerateCmd.Flags().StringVar(&generateOverrides, "overrides", "", "Package configuration file with entries overriding generated entries")
+	GenerateCmd.Flags().BoolVar(&generateAll, "all", false, "Generate entries for every agent version, not only the newest")
+	GenerateCmd.Flags().StringVar(&generateOutput, "output", "", "Output file (default stdout)")
+}
@@ -0,0 +1,64 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/mirror"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	prewarmMirrorPath  string
+	prewarmPackageConf string
+)
+
+// PrewarmCmd fetches every package file of the package configuration into
+// the package mirror
+var PrewarmCmd = &cobra.Command{
+	Use:   "prewarm-packages",
+	Short: "Fetch every package in the package configuration into the package mirror",
+	Long: `Fetch every package file (including canary packages) of the package
+configuration which is not already in package_mirror_path from its
+upstream url, verifying the configured sha256. Exits non-zero if any
+package file could not be fetched.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if prewarmMirrorPath != "" {
+			viper.Set(config.KeyPackageMirrorPath, prewarmMirrorPath)
+		}
+		if prewarmPackageConf != "" {
+			viper.Set(config.KeyPackageConfigFile, prewarmPackageConf)
+		}
+
+		p, err := packages.New("")
+		if err != nil {
+			log.Fatal().Err(err).Msg("prewarm")
+		}
+		m, err := mirror.New(viper.GetString(config.KeyPackageMirrorPath), viper.GetInt64(config.KeyPackageMirrorMaxSize))
+		if err != nil {
+			log.Fatal().Err(err).Msg("prewarm")
+		}
+
+		files := p.Files()
+		n, err := m.Prewarm(context.Background(), files)
+		if err != nil {
+			log.Fatal().Err(err).Int("fetched", n).Msg("prewarm")
+		}
+		log.Info().Int("files", len(files)).Int("fetched", n).Msg("prewarm complete")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(PrewarmCmd)
+
+	PrewarmCmd.Flags().StringVar(&prewarmMirrorPath, "mirror-dir", "", "Mirror directory (default package_mirror_path)")
+	PrewarmCmd.Flags().StringVar(&prewarmPackageConf, "package-conf", "", "Package configuration file or directory (default from configuration)")
+}
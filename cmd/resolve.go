@@ -0,0 +1,67 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/server"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	resolvePlatform    server.Platform
+	resolveTemplates   []string
+	resolveFormat      string
+	resolveContentPath string
+	resolvePackageConf string
+)
+
+// ResolveCmd shows how a request from a platform would be resolved
+var ResolveCmd = &cobra.Command{
+	Use:   "resolve",
+	Short: "Show package and template resolution for a platform (dry-run)",
+	Long: `Apply the same parameter validation and normalization a request
+would get, then show the agent package selected and, for each template,
+every file checked with found/missing/invalid markers. The selected
+template file is marked with '*'. No listeners are started.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if resolveContentPath != "" {
+			viper.Set(config.KeyContentPath, resolveContentPath)
+		}
+		if resolvePackageConf != "" {
+			viper.Set(config.KeyPackageConfigFile, resolvePackageConf)
+		}
+
+		res, err := server.Resolve(resolvePlatform, resolveTemplates)
+		if err != nil {
+			log.Fatal().Err(err).Msg("resolve")
+		}
+		if err := res.Write(os.Stdout, resolveFormat); err != nil {
+			log.Fatal().Err(err).Msg("resolve")
+		}
+		if !res.OK() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ResolveCmd)
+
+	ResolveCmd.Flags().StringVar(&resolvePlatform.Type, "type", "", "OS type (e.g. linux)")
+	ResolveCmd.Flags().StringVar(&resolvePlatform.Dist, "dist", "", "OS distribution (e.g. ubuntu)")
+	ResolveCmd.Flags().StringVar(&resolvePlatform.Vers, "vers", "", "OS version (e.g. 16.04)")
+	ResolveCmd.Flags().StringVar(&resolvePlatform.Arch, "arch", "", "System architecture (e.g. x86_64)")
+	ResolveCmd.Flags().StringVar(&resolvePlatform.Like, "like", "", "OS distributions the distribution is like, os-release ID_LIKE (e.g. \"rhel fedora\")")
+	ResolveCmd.Flags().StringSliceVar(&resolveTemplates, "template", []string{}, "Template id(s) to resolve, type-name (default all available)")
+	ResolveCmd.Flags().StringVar(&resolveFormat, "format", "text", "Output format (text|json)")
+	ResolveCmd.Flags().StringVar(&resolveContentPath, "content-dir", "", "Content directory (default from configuration)")
+	ResolveCmd.Flags().StringVar(&resolvePackageConf, "package-conf", "", "Package configuration file or directory (default from configuration)")
+}
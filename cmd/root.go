@@ -169,7 +169,7 @@ func init() {
 			key         = config.KeyPackageConfigFile
 			longOpt     = "package-conf"
 			envVar      = release.ENVPREFIX + "_PACKAGE_CONF"
-			description = "Package configuration file"
+			description = "Package configuration file or directory (conf.d, files merged in lexical order)"
 		)
 
 		RootCmd.Flags().String(longOpt, defaults.PackageConfigFile, desc(description, envVar))
@@ -192,6 +192,48 @@ func init() {
 		viper.SetDefault(key, defaults.BasePackageURL)
 	}
 
+	{
+		const (
+			key         = config.KeyPackageChannel
+			longOpt     = "package-channel"
+			envVar      = release.ENVPREFIX + "_PACKAGE_CHANNEL"
+			description = "Default agent package release channel (e.g. stable, beta, lts)"
+		)
+
+		RootCmd.Flags().String(longOpt, defaults.PackageChannel, desc(description, envVar))
+		bindFlagError(longOpt, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.PackageChannel)
+	}
+
+	{
+		const (
+			key         = config.KeyPackageGenerate
+			longOpt     = "package-generate"
+			envVar      = release.ENVPREFIX + "_PACKAGE_GENERATE"
+			description = "Generate package configuration from local package files, package config entries override"
+		)
+
+		RootCmd.Flags().Bool(longOpt, defaults.PackageGenerate, desc(description, envVar))
+		bindFlagError(longOpt, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.PackageGenerate)
+	}
+
+	{
+		const (
+			key         = config.KeyPackageMirror
+			longOpt     = "package-mirror"
+			envVar      = release.ENVPREFIX + "_PACKAGE_MIRROR"
+			description = "Mirror upstream packages, fetch once and serve from package_mirror_path"
+		)
+
+		RootCmd.Flags().Bool(longOpt, defaults.PackageMirror, desc(description, envVar))
+		bindFlagError(longOpt, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.PackageMirror)
+	}
+
 	//
 	// SSL
 	//
@@ -268,6 +310,62 @@ func init() {
 		viper.SetDefault(key, defaults.EnableTemplateCache)
 	}
 
+	{
+		const (
+			key         = config.KeyWatchTemplates
+			longOpt     = "watch-templates"
+			envVar      = release.ENVPREFIX + "_WATCH_TEMPLATES"
+			description = "Evict cached templates when template files change"
+		)
+
+		RootCmd.Flags().Bool(longOpt, defaults.WatchTemplates, desc(description, envVar))
+		bindFlagError(longOpt, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.WatchTemplates)
+	}
+
+	{
+		const (
+			key         = config.KeyTemplateValidation
+			longOpt     = "template-validation"
+			envVar      = release.ENVPREFIX + "_TEMPLATE_VALIDATION"
+			description = "Invalid template handling (off|quarantine|fail)"
+		)
+
+		RootCmd.Flags().String(longOpt, defaults.TemplateValidation, desc(description, envVar))
+		bindFlagError(longOpt, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.TemplateValidation)
+	}
+
+	{
+		const (
+			key         = config.KeyAdminEndpoints
+			longOpt     = "admin-endpoints"
+			envVar      = release.ENVPREFIX + "_ADMIN_ENDPOINTS"
+			description = "Enable /admin/ reporting endpoints (e.g. template coverage)"
+		)
+
+		RootCmd.Flags().Bool(longOpt, defaults.AdminEndpoints, desc(description, envVar))
+		bindFlagError(longOpt, viper.BindPFlag(key, RootCmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		viper.SetDefault(key, defaults.AdminEndpoints)
+	}
+
+	// Template cache bounds (config file only)
+	viper.SetDefault(config.KeyTemplateCacheMaxEntries, defaults.TemplateCacheMaxEntries)
+	viper.SetDefault(config.KeyTemplateCacheTTL, defaults.TemplateCacheTTL)
+
+	// Distro aliases (config file only)
+	viper.SetDefault(config.KeyDistroAliases, defaults.DistroAliases)
+	viper.SetDefault(config.KeyPackageGenerateAll, defaults.PackageGenerateAll)
+	viper.SetDefault(config.KeyPackageMirrorPath, defaults.PackageMirrorPath)
+	viper.SetDefault(config.KeyPackageMirrorMaxSize, defaults.PackageMirrorMaxSize)
+	viper.SetDefault(config.KeyPackageMirrorURL, defaults.PackageMirrorURL)
+	viper.SetDefault(config.KeyRegionMirrorHealthInterval, defaults.RegionMirrorHealthInterval)
+	viper.SetDefault(config.KeyTrustedProxies, defaults.TrustedProxies)
+	viper.SetDefault(config.KeyPackagePatterns, defaults.PackagePatterns)
+
 	//
 	// Validation regular expression defaults (config file only)
 	//
@@ -306,6 +404,9 @@ func init() {
 	// Local packages
 	viper.SetDefault(config.KeyLocalPackages, defaults.LocalPackages)
 	viper.SetDefault(config.KeyLocalPackagePath, defaults.LocalPackagePath)
+	viper.SetDefault(config.KeyLocalPackagePrefix, defaults.LocalPackagePrefix)
+	viper.SetDefault(config.KeyLocalPackageRegex, defaults.LocalPackageRegex)
+	viper.SetDefault(config.KeyLocalPackageRepos, defaults.LocalPackageRepos)
 
 	//
 	// StatsD client
@@ -0,0 +1,56 @@
+// Copyright © 2018 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/lint"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	validateFormat      string
+	validateContentPath string
+	validatePackageConf string
+)
+
+// ValidateCmd checks the configuration, package configuration and templates
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate configuration, package configuration and templates",
+	Long: `Load the server configuration, the package configuration file and
+the template tree and report any problems found. Exits with a non-zero
+status if there are problems, suitable for checking content in CI before
+it is deployed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if validateContentPath != "" {
+			viper.Set(config.KeyContentPath, validateContentPath)
+		}
+		if validatePackageConf != "" {
+			viper.Set(config.KeyPackageConfigFile, validatePackageConf)
+		}
+
+		r := lint.Run()
+		if err := r.Write(os.Stdout, validateFormat); err != nil {
+			log.Fatal().Err(err).Msg("validate")
+		}
+		if !r.OK() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(ValidateCmd)
+
+	ValidateCmd.Flags().StringVar(&validateFormat, "format", "text", "Output format (text|json)")
+	ValidateCmd.Flags().StringVar(&validateContentPath, "content-dir", "", "Content directory (default from configuration)")
+	ValidateCmd.Flags().StringVar(&validatePackageConf, "package-conf", "", "Package configuration file or directory (default from configuration)")
+}
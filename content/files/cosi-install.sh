@@ -53,6 +53,10 @@ Options
 
   [--timeout]     Set timeout for curl operations (default: 120 seconds)
 
+  [--package-key] Public key file (gpg) to verify agent package signatures with.
+                  Packages with a signature_url fail to install if the signature
+                  can not be verified. Default: signatures are not verified
+
   [--help]        This message
 
   [--trace]       Enable tracing, output debugging messages
@@ -192,6 +196,14 @@ __parse_parameters() {
                 fail "--timeout must be followed by a value, number of seconds."
             fi
             ;;
+        (--package-key)
+            if [[ -n "${1:-}" ]]; then
+                cosi_package_key="$1"
+                shift
+            else
+                fail "--package-key must be followed by a public key file."
+            fi
+            ;;
         (--help)
             usage
             exit 0
@@ -373,7 +385,9 @@ __lookup_os() {
     #
     cosi_url_args="?type=${cosi_os_type}&dist=${cosi_os_dist}&vers=${cosi_os_vers}&arch=${cosi_os_arch}"
 
-    request_url="${cosi_url}package/${cosi_url_args}"
+    # text_format=2, typed package information (older servers ignore it and
+    # return the legacy format)
+    request_url="${cosi_url}package/${cosi_url_args}&text_format=2"
     log_only "\tCOSI package request: $request_url"
 
     #
@@ -392,15 +406,32 @@ __lookup_os() {
         fail "curl command encountered an error (exit code=${cmd_result}) - ${curl_result}\n\tTry curl -v '${request_url}' to see full transaction details."
     fi
 
-    IFS='|' read -a request_result <<< "$curl_result"
-    if [[ ${#request_result[@]} -ne 2 ]]; then
+    # split off the status code curl appended, error messages end with a
+    # newline so the result can not be read as a single line
+    if [[ ! "$curl_result" =~ \|[0-9]{3}$ ]]; then
         fail "Unexpected response received from COSI request '${curl_result}'. Try curl -v '${request_url}' to see full transaction details."
     fi
+    request_result=("${curl_result%|*}" "${curl_result##*|}")
+    request_result[0]="${request_result[0]%$'\n'}"
 
     case ${request_result[1]} in
     (200)
         pass "\t$cosi_os_dist $cosi_os_vers $cosi_os_arch supported!"
         IFS='|' read -a cosi_agent_package_info <<< "${request_result[0]//%%/|}"
+        if [[ "${cosi_agent_package_info[0]:-}" == "2" ]]; then
+            # typed: 2 package_type url file sha256 signature_url name publisher publisher_url
+            local typed=("${cosi_agent_package_info[@]}")
+            cosi_agent_package_type="${typed[1]:-}"
+            if [[ "$cosi_agent_package_type" == "ips" ]]; then
+                cosi_agent_package_info=("${typed[8]:-}" "${typed[7]:-}" "${typed[6]:-}")
+            else
+                cosi_agent_package_info=("${typed[2]:-}" "${typed[3]:-}" "${typed[4]:-}" "${typed[5]:-}")
+            fi
+        fi
+        ;;
+    (410)
+        # platform is no longer supported (blocked)
+        fail "$cosi_os_dist $cosi_os_vers $cosi_os_arch is no longer supported\nmessage: ${request_result[0]}"
         ;;
     (000)
         # outlier but, made it happen by trying to get curl to timeout
@@ -421,9 +452,13 @@ __download_package() {
     local package_url=""
     local package_file=""
     local local_package_file=""
+    local package_sha256=""
+    local signature_url=""
 
     package_url=${cosi_agent_package_info[0]}
     package_file=${cosi_agent_package_info[1]}
+    package_sha256=${cosi_agent_package_info[2]:-}
+    signature_url=${cosi_agent_package_info[3]:-}
 
     if [[ "${package_url: -1}" != "/" ]]; then
         package_url+="/"
@@ -434,7 +469,7 @@ __download_package() {
     # do what we can to validate agent package url
     #
     if [[ -n "${package_url:-}" ]]; then
-        [[ "$package_url" =~ ^http[s]?://[^/]+/.*\.(rpm|deb|tgz)$ ]] || fail "COSI agent package url does not match URL pattern (^http[s]?://[^/]+/.*\.(rpm|deb|tgz)$)"
+        [[ "$package_url" =~ ^http[s]?://[^/]+/.*\.(rpm|deb|tgz|tar\.gz|apk|pkg|txz)$ ]] || fail "COSI agent package url does not match URL pattern (^http[s]?://[^/]+/.*\.(rpm|deb|tgz|tar\.gz|apk|pkg|txz)$)"
     else
         fail "Invalid COSI agent package url"
     fi
@@ -452,6 +487,77 @@ __download_package() {
         set -o errexit
         [[ "$curl_err" == "0" && -f "${local_package_file}" ]] || fail "Unable to download '${package_url}' (curl exit code=${curl_err})."
     fi
+
+    if [[ -n "${package_sha256:-}" ]]; then
+        __verify_package "${local_package_file}" "${package_sha256}"
+    fi
+
+    if [[ -n "${signature_url:-}" ]]; then
+        if [[ -z "${cosi_package_key:-}" ]]; then
+            log "Agent package signature not verified (no --package-key), ${signature_url}"
+            return
+        fi
+        __verify_package_signature "${local_package_file}" "${signature_url}"
+    fi
+}
+
+__verify_package_signature() {
+    local package_file="$1"
+    local signature_url="$2"
+    local signature_file="${package_file}.sig"
+    local gpg_home=""
+    local curl_err=""
+    local gpg_err=""
+
+    [[ -n "$(type -P gpg)" ]] || fail "Unable to find gpg, required to verify package signature with --package-key."
+    [[ -f "${cosi_package_key}" ]] || fail "Package key file '${cosi_package_key}' not found."
+
+    log "Downloading Agent package signature ${signature_url}"
+    set +o errexit
+    \curl -m $cosi_curl_timeout -f "${signature_url}" -o "${signature_file}"
+    curl_err=$?
+    set -o errexit
+    [[ "$curl_err" == "0" && -f "${signature_file}" ]] || fail "Unable to download signature '${signature_url}' (curl exit code=${curl_err})."
+
+    # verify with only the package key, not the keys of the user's keyring
+    gpg_home=$(mktemp -d)
+    set +o errexit
+    gpg --homedir "${gpg_home}" --batch --quiet --import "${cosi_package_key}" >> $cosi_install_log 2>&1 && \
+        gpg --homedir "${gpg_home}" --batch --verify "${signature_file}" "${package_file}" >> $cosi_install_log 2>&1
+    gpg_err=$?
+    set -o errexit
+    rm -rf "${gpg_home}"
+
+    if [[ "$gpg_err" != "0" ]]; then
+        rm -f "${package_file}" "${signature_file}"
+        fail "Package signature verification failed for '${package_file}' (${signature_url}), see ${cosi_install_log}."
+    fi
+
+    pass "\tVerified package signature ${signature_url}"
+}
+
+__verify_package() {
+    local package_file="$1"
+    local expected="$2"
+    local actual=""
+
+    if [[ -n "$(type -P sha256sum)" ]]; then
+        actual=$(sha256sum "${package_file}" | awk '{print $1}')
+    elif [[ -n "$(type -P shasum)" ]]; then
+        actual=$(shasum -a 256 "${package_file}" | awk '{print $1}')
+    elif [[ -n "$(type -P sha256)" ]]; then
+        actual=$(sha256 -q "${package_file}")
+    else
+        log "Unable to find sha256sum, shasum or sha256, skipping package checksum verification."
+        return
+    fi
+
+    if [[ "${actual,,}" != "${expected,,}" ]]; then
+        rm -f "${package_file}"
+        fail "Package checksum mismatch for '${package_file}', expected ${expected} got ${actual}."
+    fi
+
+    pass "\tVerified package checksum ${actual}"
 }
 
 __install_agent() {
@@ -462,23 +568,44 @@ __install_agent() {
     local package_file
 
     if [[ ${cosi_os_type,,} =~ linux ]]; then
-        if [[ ${#cosi_agent_package_info[@]} -ne 2 ]]; then
-            fail "Invalid Agent package information ${cosi_agent_package_info[@]}, expected 'url file_name'"
+        if [[ ${#cosi_agent_package_info[@]} -lt 2 || ${#cosi_agent_package_info[@]} -gt 4 ]]; then
+            fail "Invalid Agent package information ${cosi_agent_package_info[@]}, expected 'url file_name [sha256 [signature_url]]'"
         fi
         __download_package
         package_file="${cosi_cache_dir}/${cosi_agent_package_info[1]}"
         log "Installing agent package ${package_file}"
         [[ ! -f "$package_file" ]] && fail "Unable to find package '$package_file'"
         if [[ -z "${pkg_cmd:-}" ]]; then
-            if [[ $package_file =~ \.rpm$ ]]; then
+            local package_type="${cosi_agent_package_type:-}"
+            if [[ -z "$package_type" ]]; then
+                # legacy package information, no package type
+                if [[ $package_file =~ \.rpm$ ]]; then
+                    package_type="rpm"
+                elif [[ $package_file =~ \.deb$ ]]; then
+                    package_type="deb"
+                fi
+            fi
+            case "$package_type" in
+            (rpm)
                 pkg_cmd="yum"
                 pkg_cmd_args="localinstall -y ${package_file}"
-            elif [[ $package_file =~ \.deb$ ]]; then
+                ;;
+            (deb)
                 pkg_cmd="dpkg"
                 pkg_cmd_args="--install --force-confold ${package_file}"
-            else
+                ;;
+            (apk)
+                pkg_cmd="apk"
+                pkg_cmd_args="add --allow-untrusted ${package_file}"
+                ;;
+            (tgz)
+                pkg_cmd="tar"
+                pkg_cmd_args="-zxf ${package_file} -C /"
+                ;;
+            (*)
                 fail "Unable to determine package installation command on '${cosi_os_dist}' for '${package_file}'. Please set package_install_cmd in config file to continue."
-            fi
+                ;;
+            esac
         fi
     else
         case "$cosi_os_dist" in
@@ -496,15 +623,20 @@ __install_agent() {
             pkg_cmd_args="install ${cosi_agent_package_info[2]}"
             ;;
         (FreeBSD|BSD)
-            if [[ ${#cosi_agent_package_info[@]} -ne 2 ]]; then
-                fail "Invalid Agent package information ${cosi_agent_package_info[@]}, expected 'url file_name'"
+            if [[ ${#cosi_agent_package_info[@]} -lt 2 || ${#cosi_agent_package_info[@]} -gt 4 ]]; then
+                fail "Invalid Agent package information ${cosi_agent_package_info[@]}, expected 'url file_name [sha256 [signature_url]]'"
             fi
             __download_package
             package_file="${cosi_cache_dir}/${cosi_agent_package_info[1]}"
             log "Installing agent package ${package_file}"
             [[ ! -f "$package_file" ]] && fail "Unable to find package '$package_file'"
-            pkg_cmd="tar"
-            pkg_cmd_args="-zxf ${package_file} -C /"
+            if [[ "${cosi_agent_package_type:-}" == "freebsd-pkg" ]]; then
+                pkg_cmd="pkg"
+                pkg_cmd_args="add ${package_file}"
+            else
+                pkg_cmd="tar"
+                pkg_cmd_args="-zxf ${package_file} -C /"
+            fi
             ;;
         (*)
             fail "Unable to determine package installation command for ${cosi_os_dist}. Please set package_install_cmd in config file to continue."
@@ -812,6 +944,7 @@ cosi_initialize() {
     agent_pre_hook="${cosi_dir}/agent_pre_hook.sh"
     agent_post_hook="${cosi_dir}/agent_post_hook.sh"
     cosi_agent_package_info=()
+    cosi_agent_package_type=""
     cosi_cache_dir="${cosi_dir}/cache"
     cosi_register_config="${etc_dir}/cosi.yaml"
     cosi_register_id_file="${etc_dir}/.cosi_id"
@@ -845,6 +978,7 @@ cosi_initialize() {
     : ${package_install_cmd:=}
     : ${package_install_args:=--install}
     : ${cosi_curl_timeout:=120}
+    : ${cosi_package_key:=}
 
     # list of settings we will save if cosi_save_config_flag is ON
     settings_list=" \
@@ -3,6 +3,7 @@ module github.com/circonus-labs/cosi-server
 require (
 	github.com/Masterminds/semver v1.5.0
 	github.com/alexcesaro/statsd v2.0.0+incompatible
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/justinas/alice v1.2.0
 	github.com/klauspost/compress v1.8.5 // indirect
 	github.com/klauspost/cpuid v1.2.1 // indirect
@@ -0,0 +1,71 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package arch defines the canonical system architecture names. Packages,
+// templates and parameters are matched by canonical architecture so that
+// e.g. amd64 and x86_64 are the same architecture.
+package arch
+
+import "strings"
+
+// Canonical architectures (uname -m names)
+const (
+	X86_64  = "x86_64"
+	I386    = "i386"
+	I686    = "i686"
+	AArch64 = "aarch64"
+	ARMv7l  = "armv7l"
+	PPC64le = "ppc64le"
+	S390x   = "s390x"
+)
+
+// aliases are the other names used for an architecture, by canonical name
+var aliases = map[string][]string{
+	X86_64:  {"amd64"},
+	AArch64: {"arm64"},
+	ARMv7l:  {"armv7", "armhf"},
+}
+
+// toolNames maps a canonical architecture to the name used in cosi-tool
+// release artifacts (e.g. cosi-tool_0.2.0_linux_arm64.tar.gz)
+var toolNames = map[string]string{
+	X86_64:  "x86_64",
+	I386:    "i386",
+	I686:    "i386",
+	AArch64: "arm64",
+	ARMv7l:  "armv7",
+	PPC64le: "ppc64le",
+	S390x:   "s390x",
+}
+
+// Canonical returns the canonical name for an architecture, unknown
+// architectures are returned lower cased
+func Canonical(a string) string {
+	a = strings.ToLower(a)
+	for c, names := range aliases {
+		for _, name := range names {
+			if a == name {
+				return c
+			}
+		}
+	}
+	return a
+}
+
+// Names returns the canonical name followed by the aliases of an
+// architecture (e.g. x86_64, amd64)
+func Names(a string) []string {
+	c := Canonical(a)
+	return append([]string{c}, aliases[c]...)
+}
+
+// ToolName returns the architecture name used in cosi-tool release artifacts
+func ToolName(a string) string {
+	c := Canonical(a)
+	if n, ok := toolNames[c]; ok {
+		return n
+	}
+	return c
+}
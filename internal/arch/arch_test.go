@@ -0,0 +1,45 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package arch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	t.Log("Testing Canonical")
+
+	tt := []struct {
+		arch   string
+		expect string
+		names  string
+		tool   string
+	}{
+		{"x86_64", X86_64, "x86_64 amd64", "x86_64"},
+		{"AMD64", X86_64, "x86_64 amd64", "x86_64"},
+		{"arm64", AArch64, "aarch64 arm64", "arm64"},
+		{"aarch64", AArch64, "aarch64 arm64", "arm64"},
+		{"armhf", ARMv7l, "armv7l armv7 armhf", "armv7"},
+		{"i686", I686, "i686", "i386"},
+		{"ppc64le", PPC64le, "ppc64le", "ppc64le"},
+		{"s390x", S390x, "s390x", "s390x"},
+		{"Sparc", "sparc", "sparc", "sparc"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.arch)
+		if c := Canonical(tst.arch); c != tst.expect {
+			t.Fatalf("expected %s, got %s", tst.expect, c)
+		}
+		if n := strings.Join(Names(tst.arch), " "); n != tst.names {
+			t.Fatalf("expected (%s), got (%s)", tst.names, n)
+		}
+		if n := ToolName(tst.arch); n != tst.tool {
+			t.Fatalf("expected %s, got %s", tst.tool, n)
+		}
+	}
+}
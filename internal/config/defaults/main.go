@@ -24,26 +24,51 @@ const (
 	// LocalPackages toggles serving packages locally vs from public package server (for testing new agent packages)
 	LocalPackages = false
 
+	// LocalPackagePrefix defines the file name prefix of local agent packages
+	LocalPackagePrefix = "circonus-agent"
+
+	// LocalPackageRegex extracts the agent version from local agent package file names
+	LocalPackageRegex = `^circonus-agent-(.+)-1\..+$`
+
+	// LocalPackageRepos toggles generating yum and apt repositories from local agent packages
+	LocalPackageRepos = false
+
 	// EnableTemplateCache controls whether templates are cached
 	EnableTemplateCache = true
 
+	// WatchTemplates controls whether the template directory is watched for changes (when caching is enabled)
+	WatchTemplates = true
+
+	// TemplateCacheMaxEntries limits the number of template cache entries (0 = unbounded)
+	TemplateCacheMaxEntries = 0
+	// TemplateCacheTTL limits the age of template cache entries (0 = entries do not expire)
+	TemplateCacheTTL = time.Duration(0)
+
+	// TemplateValidation controls how invalid templates are handled at load (off, quarantine, fail)
+	TemplateValidation = "quarantine"
+
+	// AdminEndpoints controls whether the /admin/ reporting endpoints are served
+	AdminEndpoints = false
+
 	// ParamTypeRx defines the default 'type' (os type) parameter validation regular expression
 	ParamTypeRx = `^(?i)[a-z-_]+$`
 
 	// ParamDistroRx defines the default 'dist' (os distribution) parameter validation regular expression
 	ParamDistroRx = `^(?i)[a-z]+$`
 	// IsRHELDistroRx defines the default regular expression used to determine if os distro is a rhel type
-	IsRHELDistroRx = `^(?i)(CentOS|Fedora|RedHat|Oracle)$`
+	IsRHELDistroRx = `^(?i)(CentOS|Fedora|RedHat|RHEL|Oracle|Rocky|AlmaLinux)$`
 	// IsSolarisDistroRx defines the default regular expression used to determine if os distro is a solaris type (using 'pkg' to manage packages)
 	IsSolarisDistroRx = `^(?i)(OmniOS|Illumos|Solaris)$`
 
-	// ParamVersionRx defines the default 'vers' (os version) parameter validation regular expression
-	ParamVersionRx = `^[rv]?\d+(\.\d+)*$`
+	// ParamVersionRx defines the default 'vers' (os version) parameter validation regular expression,
+	// including FreeBSD releases (e.g. 12.1-RELEASE-p3)
+	ParamVersionRx = `^[rv]?\d+(\.\d+)*(?i:-(release|stable|current)(-p\d+)?)?$`
 	// ParamVersionCleanerRx defines the default version cleaner regular expression
-	ParamVersionCleanerRx = `^[rv]`
+	ParamVersionCleanerRx = `^[rv]|(?i:-(release|stable|current)(-p\d+)?)$`
 
-	// ParamArchRx defines the default 'arch' (system architecture) parameter validation regular expression
-	ParamArchRx = `^(amd64|x86_64|i386|i686)$`
+	// ParamArchRx defines the default 'arch' (system architecture) parameter validation regular expression,
+	// case insensitive (e.g. Windows AMD64)
+	ParamArchRx = `^(?i)(amd64|x86_64|i386|i686|aarch64|arm64|armv7l|armv7|armhf|ppc64le|s390x)$`
 
 	// ParamAgentModeRx defines the default 'agent' (agent mode) parameter validation regular expression
 	ParamAgentModeRx = `^(?i)(reverse|pull|push|revonly)$`
@@ -105,6 +130,30 @@ var (
 	// PackageConfigFile defines the default package configuration file
 	PackageConfigFile = ""
 
+	// PackageChannel defines the default agent package release channel
+	PackageChannel = "stable"
+
+	// PackageGenerate toggles generating the package configuration from local package files
+	PackageGenerate = false
+
+	// PackageGenerateAll generates entries for every agent version, not only the newest
+	PackageGenerateAll = false
+
+	// PackageMirror toggles the caching pull-through mirror of upstream packages
+	PackageMirror = false
+
+	// PackageMirrorMaxSize defines the mirror cache size in bytes (0 is unlimited)
+	PackageMirrorMaxSize = int64(0)
+
+	// PackageMirrorURL defines the advertised /packages/ url (derived from the request if blank)
+	PackageMirrorURL = ""
+
+	// RegionMirrorHealthInterval defines how often region mirrors are health checked (0 disables checks)
+	RegionMirrorHealthInterval = 30 * time.Second
+
+	// TrustedProxies defines the proxy CIDRs whose X-Forwarded-For header is trusted
+	TrustedProxies = []string{}
+
 	// SSLCertFile returns the deefault ssl cert file name
 	SSLCertFile = "" // (e.g. /opt/circonus/cosi-server/etc/ccosi-server.pem)
 
@@ -117,6 +166,23 @@ var (
 	// RPMFile determines if the /install/rpm/ endpoint will be served
 	RPMFile = ""
 
+	// DistroAliases maps os distros to the (binary compatible) distro used for packages and templates
+	DistroAliases = map[string]string{
+		"almalinux": "centos",
+		"rocky":     "centos",
+	}
+
+	// PackagePatterns maps agent package file names to platforms when
+	// generating the package configuration (type, dist, regex)
+	PackagePatterns = []map[string]string{
+		{"type": "Linux", "dist": "Ubuntu", "regex": `^circonus-agent-(?P<agent_version>.+)-1\.ubuntu\.(?P<vers>[0-9.]+)_(?P<arch>[^.]+)\.deb$`},
+		{"type": "Linux", "dist": "debian", "regex": `^circonus-agent-(?P<agent_version>.+)-1\.debian\.(?P<vers>[0-9.]+)_(?P<arch>[^.]+)\.deb$`},
+		{"type": "Linux", "dist": "CentOS", "regex": `^circonus-agent-(?P<agent_version>.+)-1\.el(?P<vers>[0-9]+)(\.centos)?\.(?P<arch>[^.]+)\.rpm$`},
+		{"type": "Linux", "dist": "RedHat", "regex": `^circonus-agent-(?P<agent_version>.+)-1\.el(?P<vers>[0-9]+)(\.centos)?\.(?P<arch>[^.]+)\.rpm$`},
+		{"type": "Linux", "dist": "Oracle", "regex": `^circonus-agent-(?P<agent_version>.+)-1\.el(?P<vers>[0-9]+)(\.centos)?\.(?P<arch>[^.]+)\.rpm$`},
+		{"type": "BSD", "dist": "FreeBSD", "regex": `^circonus-agent-(?P<agent_version>.+)-1\.freebsd\.(?P<vers>[0-9.]+)_(?P<arch>[^.]+)\.tgz$`},
+	}
+
 	httptrapBroker  = "35"
 	arlingtonBroker = "1"
 	sanjoseBroker   = "2"
@@ -137,6 +203,9 @@ var (
 	// LocalPackagePath defines where to serve local agent package files from
 	LocalPackagePath = ""
 
+	// PackageMirrorPath defines where mirrored agent package files are stored
+	PackageMirrorPath = ""
+
 	// CosiToolVersion defines version tag for cosi tool to install
 	CosiToolVersion = "v0.2.0"
 	// CosiToolBaseURL defines the base URL
@@ -164,6 +233,7 @@ func init() {
 	EtcPath = filepath.Join(BasePath, "etc")
 	ContentPath = filepath.Join(BasePath, "content")
 	LocalPackagePath = filepath.Join(BasePath, "content", "packages")
+	PackageMirrorPath = filepath.Join(BasePath, "cache", "packages")
 	PackageConfigFile = filepath.Join(EtcPath, "circonus-packages.yaml")
 	SSLCertFile = filepath.Join(EtcPath, release.NAME+".pem")
 	SSLKeyFile = filepath.Join(EtcPath, release.NAME+".key")
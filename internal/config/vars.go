@@ -24,6 +24,12 @@ type Brokers struct {
 	PullDefault     int      `mapstructure:"pull_default" json:"pull_default" yaml:"pull_default" toml:"pull_default"`                 // offset into Pull array or -1 for random
 }
 
+// TemplateCache defines the optional template cache bounds
+type TemplateCache struct {
+	MaxEntries int           `mapstructure:"max_entries" json:"max_entries" yaml:"max_entries" toml:"max_entries"` // 0 = unbounded
+	TTL        time.Duration `json:"ttl" yaml:"ttl" toml:"ttl"`                                                    // 0 = entries do not expire
+}
+
 // Log defines the running config.log structure
 type Log struct {
 	Level  string `json:"level" yaml:"level" toml:"level"`
@@ -52,24 +58,60 @@ type Validators struct {
 	TemplateNameRegex        string `mapstructure:"template_name_regex" json:"template_name_regex" yaml:"template_name_regex" toml:"template_name_regex"`
 }
 
+// PackagePattern maps agent package file names to platforms, regex named
+// groups agent_version, vers and arch (and type, dist if not set) are required
+type PackagePattern struct {
+	Type  string `json:"type" yaml:"type" toml:"type"`
+	Dist  string `json:"dist" yaml:"dist" toml:"dist"`
+	Regex string `json:"regex" yaml:"regex" toml:"regex"`
+}
+
+// RegionMirror is the package mirror for the hosts of a region, selected by
+// client network or the region request parameter
+type RegionMirror struct {
+	Region    string   `mapstructure:"region" json:"region" yaml:"region" toml:"region"`
+	URL       string   `mapstructure:"url" json:"url" yaml:"url" toml:"url"`                             // package base url
+	Networks  []string `mapstructure:"networks" json:"networks" yaml:"networks" toml:"networks"`         // client CIDRs
+	HealthURL string   `mapstructure:"health_url" json:"health_url" yaml:"health_url" toml:"health_url"` // checked instead of url, if set
+}
+
 // Config defines the running config structure
 type Config struct {
-	Listen            []string   `json:"listen" yaml:"listen" toml:"listen"`
-	ContentPath       string     `mapstructure:"content_path" json:"content_path" yaml:"content_path" toml:"content_path"`
-	PackageConfigFile string     `mapstructure:"package_config_file" json:"package_config_file" yaml:"package_config_file" toml:"package_config_file"`
-	PackageBaseURL    string     `mapstructure:"package_base_url" json:"package_base_url" yaml:"package_base_url" toml:"package_base_url"`
-	SSL               SSL        `json:"ssl" yaml:"ssl" toml:"ssl"`
-	CacheTemplates    bool       `mapstructure:"enable_template_cache" json:"enable_template_cache" yaml:"enable_template_cache" toml:"enable_template_cache"`
-	Validators        Validators `json:"validators" yaml:"validators" toml:"validators"`
-	Brokers           Brokers    `json:"brokers" yaml:"brokers" toml:"brokers"`
-	RPMFile           string     `mapstructure:"rpm_file" json:"rpm_file" yaml:"rpm_file" toml:"rpm_file"`
-	Statsd            Statsd     `json:"statsd" yaml:"statsd" toml:"statsd"`
-	Debug             bool       `json:"debug" yaml:"debug" toml:"debug"`
-	Log               Log        `json:"log" yaml:"log" toml:"log"`
-	LocalPackages     bool       `mapstructure:"local_packages"`
-	LocalPackagePath  string     `mapstructure:"local_package_path"`
-	CosiToolVersion   string     `mapstructure:"cosi_tool_version"`
-	CosiToolBaseURL   string     `mapstructure:"cosi_tool_base_url"`
+	Listen             []string          `json:"listen" yaml:"listen" toml:"listen"`
+	ContentPath        string            `mapstructure:"content_path" json:"content_path" yaml:"content_path" toml:"content_path"`
+	PackageConfigFile  string            `mapstructure:"package_config_file" json:"package_config_file" yaml:"package_config_file" toml:"package_config_file"`
+	PackageBaseURL     string            `mapstructure:"package_base_url" json:"package_base_url" yaml:"package_base_url" toml:"package_base_url"`
+	PackageChannel     string            `mapstructure:"package_channel" json:"package_channel" yaml:"package_channel" toml:"package_channel"`
+	PackageGenerate    bool              `mapstructure:"package_generate" json:"package_generate" yaml:"package_generate" toml:"package_generate"`
+	PackageGenerateAll bool              `mapstructure:"package_generate_all" json:"package_generate_all" yaml:"package_generate_all" toml:"package_generate_all"`
+	PackagePatterns    []PackagePattern  `mapstructure:"package_patterns" json:"package_patterns" yaml:"package_patterns" toml:"package_patterns"`
+	PackageMirror      bool              `mapstructure:"package_mirror" json:"package_mirror" yaml:"package_mirror" toml:"package_mirror"`
+	PackageMirrorPath  string            `mapstructure:"package_mirror_path" json:"package_mirror_path" yaml:"package_mirror_path" toml:"package_mirror_path"`
+	PackageMirrorSize  int64             `mapstructure:"package_mirror_max_size" json:"package_mirror_max_size" yaml:"package_mirror_max_size" toml:"package_mirror_max_size"`
+	PackageMirrorURL   string            `mapstructure:"package_mirror_url" json:"package_mirror_url" yaml:"package_mirror_url" toml:"package_mirror_url"`
+	RegionMirrors      []RegionMirror    `mapstructure:"region_mirrors" json:"region_mirrors" yaml:"region_mirrors" toml:"region_mirrors"`
+	RegionMirrorHealth time.Duration     `mapstructure:"region_mirror_health_interval" json:"region_mirror_health_interval" yaml:"region_mirror_health_interval" toml:"region_mirror_health_interval"`
+	TrustedProxies     []string          `mapstructure:"trusted_proxies" json:"trusted_proxies" yaml:"trusted_proxies" toml:"trusted_proxies"`
+	SSL                SSL               `json:"ssl" yaml:"ssl" toml:"ssl"`
+	CacheTemplates     bool              `mapstructure:"enable_template_cache" json:"enable_template_cache" yaml:"enable_template_cache" toml:"enable_template_cache"`
+	WatchTemplates     bool              `mapstructure:"watch_templates" json:"watch_templates" yaml:"watch_templates" toml:"watch_templates"`
+	TemplateCache      TemplateCache     `mapstructure:"template_cache" json:"template_cache" yaml:"template_cache" toml:"template_cache"`
+	TemplateValidation string            `mapstructure:"template_validation" json:"template_validation" yaml:"template_validation" toml:"template_validation"`
+	AdminEndpoints     bool              `mapstructure:"admin_endpoints" json:"admin_endpoints" yaml:"admin_endpoints" toml:"admin_endpoints"`
+	DistroAliases      map[string]string `mapstructure:"distro_aliases" json:"distro_aliases" yaml:"distro_aliases" toml:"distro_aliases"`
+	Validators         Validators        `json:"validators" yaml:"validators" toml:"validators"`
+	Brokers            Brokers           `json:"brokers" yaml:"brokers" toml:"brokers"`
+	RPMFile            string            `mapstructure:"rpm_file" json:"rpm_file" yaml:"rpm_file" toml:"rpm_file"`
+	Statsd             Statsd            `json:"statsd" yaml:"statsd" toml:"statsd"`
+	Debug              bool              `json:"debug" yaml:"debug" toml:"debug"`
+	Log                Log               `json:"log" yaml:"log" toml:"log"`
+	LocalPackages      bool              `mapstructure:"local_packages"`
+	LocalPackagePath   string            `mapstructure:"local_package_path"`
+	LocalPackagePrefix string            `mapstructure:"local_package_prefix"`
+	LocalPackageRegex  string            `mapstructure:"local_package_regex"`
+	LocalPackageRepos  bool              `mapstructure:"local_package_repos"`
+	CosiToolVersion    string            `mapstructure:"cosi_tool_version"`
+	CosiToolBaseURL    string            `mapstructure:"cosi_tool_base_url"`
 }
 
 //
@@ -82,16 +124,60 @@ const (
 	// KeyContentPath content directory
 	KeyContentPath = "content_path"
 
-	// KeyPackageConfigFile defines the package configuration file
+	// KeyPackageConfigFile defines the package configuration file or directory
 	KeyPackageConfigFile = "package_config_file"
 
 	// KeyPackageBaseURL defines the base url for packages
 	KeyPackageBaseURL = "package_base_url"
 
+	// KeyPackageChannel defines the default agent package release channel
+	KeyPackageChannel = "package_channel"
+
+	// KeyPackageGenerate toggles generating the package configuration from
+	// the package files in local_package_path, the package configuration file
+	// entries override generated entries
+	KeyPackageGenerate = "package_generate"
+	// KeyPackageGenerateAll generates an entry for every agent version, not
+	// only the newest, of each platform
+	KeyPackageGenerateAll = "package_generate_all"
+	// KeyPackagePatterns defines the package file name patterns used to
+	// generate the package configuration
+	KeyPackagePatterns = "package_patterns"
+
+	// KeyPackageMirror toggles the caching pull-through mirror, package files
+	// are fetched from upstream once and served from package_mirror_path
+	KeyPackageMirror = "package_mirror"
+	// KeyPackageMirrorPath defines the mirror cache directory
+	KeyPackageMirrorPath = "package_mirror_path"
+	// KeyPackageMirrorMaxSize defines the size, in bytes, of the mirror cache
+	// directory, least recently used files are evicted (0 is unlimited)
+	KeyPackageMirrorMaxSize = "package_mirror_max_size"
+	// KeyPackageMirrorURL defines the url of the /packages/ endpoint
+	// advertised to hosts, derived from the request if blank
+	KeyPackageMirrorURL = "package_mirror_url"
+
+	// KeyRegionMirrors defines the regional package mirrors, the package base
+	// url for hosts in a mirror's networks (or requesting its region)
+	KeyRegionMirrors = "region_mirrors"
+	// KeyRegionMirrorHealthInterval defines how often region mirrors are
+	// health checked, unhealthy mirrors are skipped (0 disables checks)
+	KeyRegionMirrorHealthInterval = "region_mirror_health_interval"
+	// KeyTrustedProxies defines the proxy CIDRs whose X-Forwarded-For header
+	// is trusted for the client address
+	KeyTrustedProxies = "trusted_proxies"
+
 	// KeyLocalPackages toggles serving agent packages from local directory
 	KeyLocalPackages = "local_packages"
 	// KeyPackagePath defines directory from which to serve local packages
 	KeyLocalPackagePath = "local_package_path"
+	// KeyLocalPackagePrefix defines the file name prefix of local agent packages
+	KeyLocalPackagePrefix = "local_package_prefix"
+	// KeyLocalPackageRegex defines the regular expression extracting the
+	// agent version (first group) from local agent package file names
+	KeyLocalPackageRegex = "local_package_regex"
+	// KeyLocalPackageRepos toggles generating yum and apt repositories from
+	// the local package files and advertising them in /package/ responses
+	KeyLocalPackageRepos = "local_package_repos"
 
 	// KeyCosiToolVersion defines the version of the cosi tool to install
 	KeyCosiToolVersion = "cosi_tool_version"
@@ -117,6 +203,23 @@ const (
 	// KeyEnableTemplateCache controls template caching
 	KeyEnableTemplateCache = "enable_template_cache"
 
+	// KeyWatchTemplates controls evicting cached templates when template files change
+	KeyWatchTemplates = "watch_templates"
+
+	// KeyTemplateCacheMaxEntries maximum number of template cache entries (0 = unbounded)
+	KeyTemplateCacheMaxEntries = "template_cache.max_entries"
+	// KeyTemplateCacheTTL maximum age of template cache entries (0 = entries do not expire)
+	KeyTemplateCacheTTL = "template_cache.ttl"
+
+	// KeyTemplateValidation controls how invalid templates are handled (off, quarantine, fail)
+	KeyTemplateValidation = "template_validation"
+
+	// KeyAdminEndpoints enables the /admin/ reporting endpoints
+	KeyAdminEndpoints = "admin_endpoints"
+
+	// KeyDistroAliases maps os distros to the (binary compatible) distro used for packages and templates
+	KeyDistroAliases = "distro_aliases"
+
 	// KeyParamTypeRx defines the parameter 'type' (os type) validation regular expression
 	KeyParamTypeRx = "validators.param_type_regex"
 
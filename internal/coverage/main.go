@@ -0,0 +1,316 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package coverage reports which templates resolve for each platform in the
+// package configuration, and where from, to find gaps before hosts do
+package coverage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/circonus-labs/cosi-server/api"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/circonus-labs/cosi-server/internal/templates"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// Report is the platform × template coverage matrix
+type Report struct {
+	Templates   []string           `json:"templates"` // template ids (type-name) found anywhere in the template tree
+	Platforms   []PlatformCoverage `json:"platforms"`
+	Unreachable []Unreachable      `json:"unreachable"`
+}
+
+// PlatformCoverage describes the templates resolved for a platform
+type PlatformCoverage struct {
+	packages.Platform
+	Levels        map[string]string `json:"levels"` // template id -> level resolved from, missing ids are omitted
+	MissingGraphs []MissingGraph    `json:"missing_graphs,omitempty"`
+}
+
+// MissingGraph is a dashboard widget referencing a graph which does not
+// resolve for a platform
+type MissingGraph struct {
+	Dashboard string `json:"dashboard"`
+	GraphName string `json:"graph_name"`
+}
+
+// Unreachable is a file in the template tree never served to any platform
+type Unreachable struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// Build resolves every template for every supported platform
+func Build(p *packages.Packages, t *templates.Templates) (*Report, error) {
+	if p == nil {
+		return nil, errors.New("invalid package list (nil)")
+	}
+	if t == nil {
+		return nil, errors.New("invalid templates (nil)")
+	}
+
+	files, ids, err := scan(t.Dir())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{
+		Templates:   ids,
+		Platforms:   []PlatformCoverage{},
+		Unreachable: []Unreachable{},
+	}
+
+	served := map[string]bool{}
+
+	for _, plat := range p.Platforms() {
+		pc := PlatformCoverage{Platform: plat, Levels: map[string]string{}}
+		selected := map[string]string{} // template id -> file
+
+		for _, id := range ids {
+			tType, tName := splitID(id)
+			candidates, err := t.Candidates(plat.Type, plat.Dist, plat.Vers, plat.Arch, tType, tName)
+			if err != nil {
+				continue // id does not pass the template type/name validators
+			}
+			for _, c := range candidates {
+				if c.Selected {
+					pc.Levels[id] = c.Level
+					selected[id] = c.File
+					served[filepath.Clean(c.File)] = true
+					break
+				}
+			}
+		}
+
+		pc.MissingGraphs = missingGraphs(selected)
+		r.Platforms = append(r.Platforms, pc)
+	}
+
+	for _, file := range files {
+		if served[file] {
+			continue
+		}
+		r.Unreachable = append(r.Unreachable, Unreachable{File: file, Reason: unreachableReason(file)})
+	}
+
+	return r, nil
+}
+
+// unreachableReason explains why a file in the template tree is never served
+func unreachableReason(file string) string {
+	switch filepath.Ext(file) {
+	case api.TemplateFileExtension:
+	case templates.LegacyFileExtension:
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err.Error()
+		}
+		if _, err := templates.ConvertLegacy(data); err != nil {
+			if errors.Cause(err) == templates.ErrLegacyUnsupported {
+				return "unsupported legacy template type"
+			}
+			return fmt.Sprintf("invalid legacy template (%s)", err)
+		}
+	default:
+		return fmt.Sprintf("not a %s or %s template file", api.TemplateFileExtension, templates.LegacyFileExtension)
+	}
+	return "not selected for any supported platform"
+}
+
+// scan returns every file in the template tree and the distinct template ids
+func scan(dir string) ([]string, []string, error) {
+	files := []string{}
+	idMap := map[string]bool{}
+
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		files = append(files, filepath.Clean(file))
+		if ext := filepath.Ext(fi.Name()); ext == api.TemplateFileExtension || ext == templates.LegacyFileExtension {
+			id := strings.ToLower(strings.TrimSuffix(fi.Name(), ext))
+			if tType, tName := splitID(id); tType != "" && tName != "" {
+				idMap[id] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "scanning template directory")
+	}
+
+	ids := make([]string, 0, len(idMap))
+	for id := range idMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	sort.Strings(files)
+
+	return files, ids, nil
+}
+
+// missingGraphs checks the graph widgets of each dashboard resolved for a
+// platform. A widget graph_name is graph-<name>-<config>, it resolves when
+// the graph-<name> template resolves and has the config.
+func missingGraphs(selected map[string]string) []MissingGraph {
+	missing := []MissingGraph{}
+	graphConfigs := map[string]map[string]api.TemplateConfig{}
+
+	load := func(file string) *api.Template {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		if filepath.Ext(file) == templates.LegacyFileExtension {
+			if data, err = templates.ConvertLegacy(data); err != nil {
+				return nil
+			}
+		}
+		var tmpl api.Template
+		if err := toml.Unmarshal(data, &tmpl); err != nil {
+			return nil
+		}
+		return &tmpl
+	}
+
+	resolves := func(graphName string) bool {
+		name := strings.TrimPrefix(graphName, "graph-")
+		// graph names may contain '-', try each split point
+		for i := strings.Index(name, "-"); i != -1; {
+			id := "graph-" + name[:i]
+			cfg := name[i+1:]
+			if _, ok := graphConfigs[id]; !ok {
+				graphConfigs[id] = nil
+				if file, ok := selected[id]; ok {
+					if tmpl := load(file); tmpl != nil {
+						graphConfigs[id] = tmpl.Configs
+					}
+				}
+			}
+			if _, ok := graphConfigs[id][cfg]; ok {
+				return true
+			}
+			next := strings.Index(name[i+1:], "-")
+			if next == -1 {
+				break
+			}
+			i += next + 1
+		}
+		return false
+	}
+
+	dashboards := []string{}
+	for id := range selected {
+		if strings.HasPrefix(id, "dashboard-") {
+			dashboards = append(dashboards, id)
+		}
+	}
+	sort.Strings(dashboards)
+
+	for _, id := range dashboards {
+		tmpl := load(selected[id])
+		if tmpl == nil {
+			continue
+		}
+		cfgNames := make([]string, 0, len(tmpl.Configs))
+		for name := range tmpl.Configs {
+			cfgNames = append(cfgNames, name)
+		}
+		sort.Strings(cfgNames)
+		for _, name := range cfgNames {
+			for _, w := range tmpl.Configs[name].Widgets {
+				if w.GraphName == "" || resolves(w.GraphName) {
+					continue
+				}
+				missing = append(missing, MissingGraph{Dashboard: id, GraphName: w.GraphName})
+			}
+		}
+	}
+
+	return missing
+}
+
+func splitID(id string) (string, string) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// Write outputs the report in the requested format (table, csv or json)
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "formatting report (json)")
+		}
+		fmt.Fprintln(w, string(data))
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(append([]string{"platform"}, r.Templates...)); err != nil {
+			return errors.Wrap(err, "formatting report (csv)")
+		}
+		for _, pc := range r.Platforms {
+			if err := cw.Write(append([]string{pc.String()}, pc.row(r.Templates, "")...)); err != nil {
+				return errors.Wrap(err, "formatting report (csv)")
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return errors.Wrap(err, "formatting report (csv)")
+		}
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+		fmt.Fprintln(tw, "PLATFORM\t"+strings.Join(r.Templates, "\t"))
+		for _, pc := range r.Platforms {
+			fmt.Fprintln(tw, pc.String()+"\t"+strings.Join(pc.row(r.Templates, "-"), "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return errors.Wrap(err, "formatting report (table)")
+		}
+		for _, pc := range r.Platforms {
+			for _, mg := range pc.MissingGraphs {
+				fmt.Fprintf(w, "missing graph: %s %s references %s\n", pc.String(), mg.Dashboard, mg.GraphName)
+			}
+		}
+		for _, u := range r.Unreachable {
+			fmt.Fprintf(w, "unreachable: %s (%s)\n", u.File, u.Reason)
+		}
+	default:
+		return errors.Errorf("unknown report format '%s'", format)
+	}
+
+	return nil
+}
+
+// row returns the level each template resolved from, in order, using
+// missing for templates which did not resolve
+func (pc *PlatformCoverage) row(ids []string, missing string) []string {
+	row := make([]string, len(ids))
+	for i, id := range ids {
+		if level, ok := pc.Levels[id]; ok {
+			row[i] = level
+		} else {
+			row[i] = missing
+		}
+	}
+	return row
+}
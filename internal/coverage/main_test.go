@@ -0,0 +1,185 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package coverage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/circonus-labs/cosi-server/internal/templates"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func setup(t *testing.T) (*packages.Packages, *templates.Templates) {
+	t.Helper()
+
+	viper.Reset()
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyContentPath, "testdata/content")
+
+	p, err := packages.New("testdata/packages.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	tmpl, err := templates.New(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	return p, tmpl
+}
+
+func TestBuild(t *testing.T) {
+	t.Log("Testing Build")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer viper.Reset()
+
+	p, tmpl := setup(t)
+
+	t.Log("\tinvalid")
+	{
+		if _, err := Build(nil, tmpl); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := Build(p, nil); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tvalid")
+	r, err := Build(p, tmpl)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	if strings.Join(r.Templates, ",") != "dashboard-system,graph-cpu,graph-load,graph-vm" {
+		t.Fatalf("unexpected templates %v", r.Templates)
+	}
+
+	if len(r.Platforms) != 2 {
+		t.Fatalf("expected 2 platforms, got %d", len(r.Platforms))
+	}
+
+	centos := r.Platforms[0]
+	if centos.String() != "linux/centos/7/x86_64" {
+		t.Fatalf("unexpected platform (%s)", centos.String())
+	}
+	if _, ok := centos.Levels["dashboard-system"]; ok {
+		t.Fatal("expected dashboard-system missing for centos")
+	}
+	if centos.Levels["graph-cpu"] != templates.LevelDefault {
+		t.Fatalf("expected graph-cpu from default, got %s", centos.Levels["graph-cpu"])
+	}
+	if centos.Levels["graph-load"] != templates.LevelType {
+		t.Fatalf("expected legacy graph-load from type, got %s", centos.Levels["graph-load"])
+	}
+	if _, ok := centos.Levels["graph-vm"]; ok {
+		t.Fatal("expected invalid legacy graph-vm missing for centos")
+	}
+
+	ubuntu := r.Platforms[1]
+	if ubuntu.Levels["dashboard-system"] != templates.LevelDistro {
+		t.Fatalf("expected dashboard-system from dist, got %s", ubuntu.Levels["dashboard-system"])
+	}
+	if len(ubuntu.MissingGraphs) != 1 || ubuntu.MissingGraphs[0].GraphName != "graph-cpu-saturation" {
+		t.Fatalf("expected graph-cpu-saturation missing, got %#v", ubuntu.MissingGraphs)
+	}
+
+	expect := map[string]string{
+		"testdata/content/templates/graph-vm.json":          "invalid legacy template (legacy template missing 'config')",
+		"testdata/content/templates/solaris/graph-cpu.toml": "not selected for any supported platform",
+	}
+	if len(r.Unreachable) != len(expect) {
+		t.Fatalf("expected %d unreachable, got %#v", len(expect), r.Unreachable)
+	}
+	for _, u := range r.Unreachable {
+		if expect[u.File] != u.Reason {
+			t.Fatalf("unexpected unreachable %#v", u)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Log("Testing Write")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer viper.Reset()
+
+	p, tmpl := setup(t)
+	r, err := Build(p, tmpl)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\tjson")
+	{
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "json"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		var got Report
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(got.Platforms) != 2 || got.Platforms[1].Dist != "ubuntu" {
+			t.Fatalf("unexpected %#v", got.Platforms)
+		}
+	}
+
+	t.Log("\tcsv")
+	{
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "csv"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		expect := [][]string{
+			{"platform", "dashboard-system", "graph-cpu", "graph-load", "graph-vm"},
+			{"linux/centos/7/x86_64", "", "default", "type", ""},
+			{"linux/ubuntu/16.04/x86_64", "dist", "default", "type", ""},
+		}
+		if len(rows) != len(expect) {
+			t.Fatalf("expected %d rows, got %d", len(expect), len(rows))
+		}
+		for i := range expect {
+			if strings.Join(rows[i], ",") != strings.Join(expect[i], ",") {
+				t.Fatalf("expected %v got %v", expect[i], rows[i])
+			}
+		}
+	}
+
+	t.Log("\ttable")
+	{
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "table"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		out := buf.String()
+		for _, s := range []string{"PLATFORM", "missing graph: linux/ubuntu/16.04/x86_64 dashboard-system references graph-cpu-saturation", "unreachable: testdata/content/templates/graph-vm.json"} {
+			if !strings.Contains(out, s) {
+				t.Fatalf("expected (%s) in %s", s, out)
+			}
+		}
+	}
+
+	t.Log("\tinvalid format")
+	{
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "xml"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package lint checks the server configuration, package configuration and
+// templates without starting the server (e.g. in CI before deploying content)
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/circonus-labs/cosi-server/internal/templates"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Report sections
+const (
+	SectionConfig     = "config"
+	SectionValidators = "validators"
+	SectionBrokers    = "brokers"
+	SectionPackages   = "packages"
+	SectionTemplates  = "templates"
+)
+
+// Problem is a single issue found
+type Problem struct {
+	Section string `json:"section"`
+	Item    string `json:"item,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report is the result of a lint run
+type Report struct {
+	ConfigFile        string    `json:"config_file"`
+	PackageConfigFile string    `json:"package_config_file"`
+	TemplateDir       string    `json:"template_dir"`
+	Problems          []Problem `json:"problems"`
+	// package configuration directory entries overridden by a later file,
+	// reported but not problems
+	PackageConflicts []packages.Conflict `json:"package_conflicts,omitempty"`
+}
+
+// validators are the regular expressions compiled by the server at startup
+var validators = []struct {
+	key  string
+	name string
+}{
+	{config.KeyParamTypeRx, "os type regex"},
+	{config.KeyParamDistroRx, "os distro regex"},
+	{config.KeyParamVersionRx, "os version regex"},
+	{config.KeyParamVersionCleanerRx, "os version cleaner regex"},
+	{config.KeyParamArchRx, "system architecture regex"},
+	{config.KeyIsRHELDistroRx, "rhel regex"},
+	{config.KeyIsSolarisDistroRx, "solaris regex"},
+	{config.KeyAgentPullModeRx, "agent pull mode regex"},
+	{config.KeyAgentPushModeRx, "agent push mode regex"},
+	{config.KeyTemplateTypeRx, "template type regex"},
+	{config.KeyTemplateNameRx, "template name regex"},
+}
+
+// brokers are the broker lists and their default index settings
+var brokers = []struct {
+	listKey    string
+	defaultKey string
+}{
+	{config.KeyBrokerFallbackList, config.KeyBrokerFallbackDefault},
+	{config.KeyBrokerPushList, config.KeyBrokerPushDefault},
+	{config.KeyBrokerPullList, config.KeyBrokerPullDefault},
+}
+
+// Run checks the current configuration and the package configuration and
+// templates it references
+func Run() *Report {
+	r := &Report{
+		ConfigFile:        viper.ConfigFileUsed(),
+		PackageConfigFile: viper.GetString(config.KeyPackageConfigFile),
+		Problems:          []Problem{},
+	}
+
+	r.checkConfig()
+	r.checkValidators()
+	r.checkBrokers()
+	r.checkPackages()
+	r.checkTemplates()
+
+	return r
+}
+
+// OK returns true if no problems were found
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Write outputs the report in the requested format (json or text)
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "formatting report (json)")
+		}
+		fmt.Fprintln(w, string(data))
+	case "text", "":
+		if r.ConfigFile != "" {
+			fmt.Fprintf(w, "config file:    %s\n", r.ConfigFile)
+		}
+		fmt.Fprintf(w, "package config: %s\n", r.PackageConfigFile)
+		fmt.Fprintf(w, "templates:      %s\n", r.TemplateDir)
+		if len(r.PackageConflicts) > 0 {
+			fmt.Fprintf(w, "%d package configuration conflict(s), later files override:\n", len(r.PackageConflicts))
+			for _, c := range r.PackageConflicts {
+				fmt.Fprintf(w, "  %s\n", c)
+			}
+		}
+		if r.OK() {
+			fmt.Fprintln(w, "OK, no problems found")
+			return nil
+		}
+		fmt.Fprintf(w, "%d problem(s) found:\n", len(r.Problems))
+		for _, p := range r.Problems {
+			if p.Item != "" {
+				fmt.Fprintf(w, "  [%s] %s: %s\n", p.Section, p.Item, p.Message)
+			} else {
+				fmt.Fprintf(w, "  [%s] %s\n", p.Section, p.Message)
+			}
+		}
+	default:
+		return errors.Errorf("unknown report format '%s'", format)
+	}
+
+	return nil
+}
+
+func (r *Report) add(section, item, msg string) {
+	r.Problems = append(r.Problems, Problem{Section: section, Item: item, Message: msg})
+}
+
+// checkConfig verifies the configuration can be parsed and the template
+// validation mode is known
+func (r *Report) checkConfig() {
+	var cfg config.Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		r.add(SectionConfig, "", err.Error())
+	}
+
+	switch mode := strings.ToLower(viper.GetString(config.KeyTemplateValidation)); mode {
+	case "", templates.ValidationOff, templates.ValidationQuarantine, templates.ValidationFail:
+	default:
+		r.add(SectionConfig, config.KeyTemplateValidation, fmt.Sprintf("invalid mode (%s)", mode))
+	}
+}
+
+// checkValidators compiles each of the validation regular expressions
+func (r *Report) checkValidators() {
+	for _, v := range validators {
+		if _, err := regexp.Compile(viper.GetString(v.key)); err != nil {
+			r.add(SectionValidators, v.key, fmt.Sprintf("%s: %s", v.name, err))
+		}
+	}
+}
+
+// checkBrokers verifies broker ids are numeric and each default index is
+// -1 (random) or within the list, a single broker list ignores the default
+func (r *Report) checkBrokers() {
+	for _, b := range brokers {
+		list := viper.GetStringSlice(b.listKey)
+		for i, id := range list {
+			if _, err := strconv.ParseInt(id, 10, 32); err != nil {
+				r.add(SectionBrokers, b.listKey, fmt.Sprintf("invalid broker id (%s) at index %d", id, i))
+			}
+		}
+		if len(list) < 2 {
+			continue
+		}
+		idx := viper.GetInt(b.defaultKey)
+		if idx != -1 && (idx < 0 || idx >= len(list)) {
+			r.add(SectionBrokers, b.defaultKey, fmt.Sprintf("index %d out of range for list len %d", idx, len(list)))
+		}
+	}
+}
+
+// checkPackages checks the package configuration entries
+func (r *Report) checkPackages() {
+	problems, err := packages.Check(r.PackageConfigFile)
+	if err != nil {
+		r.add(SectionPackages, r.PackageConfigFile, err.Error())
+		return
+	}
+	for _, p := range problems {
+		r.add(SectionPackages, r.PackageConfigFile, p)
+	}
+	conflicts, err := packages.Conflicts(r.PackageConfigFile)
+	if err != nil {
+		return // reported by Check
+	}
+	r.PackageConflicts = conflicts
+}
+
+// checkTemplates validates every template in the content directory
+func (r *Report) checkTemplates() {
+	contentPath := viper.GetString(config.KeyContentPath)
+	if contentPath == "" {
+		r.add(SectionTemplates, "", "content path not set")
+		return
+	}
+	r.TemplateDir = filepath.Join(contentPath, "templates")
+	for _, p := range templates.ValidateDir(r.TemplateDir) {
+		r.add(SectionTemplates, p.File, p.Err)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func setup() {
+	viper.Reset()
+	viper.Set(config.KeyContentPath, "testdata/content")
+	viper.Set(config.KeyPackageConfigFile, "testdata/packages.yaml")
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyAgentPullModeRx, defaults.AgentPullModeRx)
+	viper.Set(config.KeyAgentPushModeRx, defaults.AgentPushModeRx)
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyBrokerFallbackList, defaults.BrokerFallbackList)
+	viper.Set(config.KeyBrokerFallbackDefault, defaults.BrokerFallbackDefault)
+	viper.Set(config.KeyBrokerPushList, defaults.BrokerPushList)
+	viper.Set(config.KeyBrokerPushDefault, defaults.BrokerPushDefault)
+	viper.Set(config.KeyBrokerPullList, defaults.BrokerPullList)
+	viper.Set(config.KeyBrokerPullDefault, defaults.BrokerPullDefault)
+	viper.Set(config.KeyTemplateValidation, defaults.TemplateValidation)
+}
+
+func TestRun(t *testing.T) {
+	t.Log("Testing Run")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer viper.Reset()
+
+	t.Log("\tvalid")
+	{
+		setup()
+		r := Run()
+		if !r.OK() {
+			t.Fatalf("expected no problems, got %#v", r.Problems)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		val     interface{}
+		section string
+		expect  string
+	}{
+		{"invalid regex", config.KeyParamTypeRx, "[a-z", SectionValidators, "os type regex"},
+		{"invalid broker id", config.KeyBrokerPushList, []string{"abc"}, SectionBrokers, "invalid broker id (abc)"},
+		{"broker default out of range", config.KeyBrokerPullDefault, 3, SectionBrokers, "index 3 out of range for list len 3"},
+		{"broker default negative", config.KeyBrokerFallbackDefault, -2, SectionBrokers, "index -2 out of range"},
+		{"invalid validation mode", config.KeyTemplateValidation, "bogus", SectionConfig, "invalid mode (bogus)"},
+		{"missing package config", config.KeyPackageConfigFile, "testdata/missing.yaml", SectionPackages, "loading package configuration"},
+		{"invalid package entries", config.KeyPackageConfigFile, "testdata/packages_invalid.yaml", SectionPackages, "duplicate of entry 0"},
+		{"invalid template", config.KeyContentPath, "testdata/invalid", SectionTemplates, "does not match type-name"},
+		{"missing content path", config.KeyContentPath, "", SectionTemplates, "content path not set"},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+		setup()
+		viper.Set(test.key, test.val)
+		r := Run()
+		if r.OK() {
+			t.Fatal("expected problems")
+		}
+		found := false
+		for _, p := range r.Problems {
+			if p.Section == test.section && strings.Contains(p.Message, test.expect) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("expected [%s] (%s) got %#v", test.section, test.expect, r.Problems)
+		}
+	}
+
+	t.Log("\tpackage configuration directory conflicts are not problems")
+	{
+		setup()
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/confd")
+		r := Run()
+		if !r.OK() {
+			t.Fatalf("expected no problems, got %#v", r.Problems)
+		}
+		if len(r.PackageConflicts) != 3 {
+			t.Fatalf("expected 3 conflicts, got %v", r.PackageConflicts)
+		}
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "text"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.Contains(buf.String(), "3 package configuration conflict(s)") {
+			t.Fatalf("unexpected output %s", buf.String())
+		}
+	}
+
+	t.Log("\tbroker single entry list ignores default")
+	{
+		setup()
+		viper.Set(config.KeyBrokerPushDefault, 5)
+		if r := Run(); !r.OK() {
+			t.Fatalf("expected no problems, got %#v", r.Problems)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Log("Testing Write")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer viper.Reset()
+
+	setup()
+	viper.Set(config.KeyContentPath, "testdata/invalid")
+	r := Run()
+
+	t.Log("\tjson")
+	{
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "json"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		var got Report
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(got.Problems) != len(r.Problems) {
+			t.Fatalf("expected %d problems, got %d", len(r.Problems), len(got.Problems))
+		}
+	}
+
+	t.Log("\ttext")
+	{
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "text"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.Contains(buf.String(), "1 problem(s) found") {
+			t.Fatalf("unexpected output %s", buf.String())
+		}
+		if !strings.Contains(buf.String(), "[templates]") {
+			t.Fatalf("unexpected output %s", buf.String())
+		}
+	}
+
+	t.Log("\tinvalid format")
+	{
+		var buf bytes.Buffer
+		if err := r.Write(&buf, "xml"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
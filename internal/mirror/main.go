@@ -0,0 +1,293 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package mirror is a caching pull-through mirror of upstream agent
+// package files. A missing file is fetched once from its upstream url,
+// verified and stored in the cache directory, it is served from the cache
+// directory from then on.
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// tmpPrefix is the prefix of files being fetched, they are ignored when
+// serving and evicting and removed when the mirror is created
+const tmpPrefix = ".fetch-"
+
+// Mirror fetches, stores and evicts package files in a cache directory
+type Mirror struct {
+	dir      string
+	maxSize  int64 // bytes, 0 is unlimited
+	client   *http.Client
+	logger   zerolog.Logger
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+// call is an in-flight fetch, concurrent requests for the same file wait
+// for it rather than fetching the file again
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// FetchTimeout is the time allowed to fetch a package file from upstream
+var FetchTimeout = 5 * time.Minute
+
+// New returns a mirror storing package files in dir, evicting the least
+// recently used files when the files exceed maxSize bytes (0 is unlimited)
+func New(dir string, maxSize int64) (*Mirror, error) {
+	if dir == "" {
+		return nil, errors.New("invalid mirror path (empty)")
+	}
+	if maxSize < 0 {
+		return nil, errors.Errorf("invalid mirror max size (%d)", maxSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating mirror directory")
+	}
+
+	// fetches interrupted by a restart
+	tmp, err := filepath.Glob(filepath.Join(dir, tmpPrefix+"*"))
+	if err != nil {
+		return nil, errors.Wrap(err, "mirror directory")
+	}
+	for _, f := range tmp {
+		_ = os.Remove(f)
+	}
+
+	return &Mirror{
+		dir:      dir,
+		maxSize:  maxSize,
+		client:   &http.Client{Timeout: FetchTimeout},
+		logger:   log.With().Str("pkg", "mirror").Logger(),
+		inflight: map[string]*call{},
+	}, nil
+}
+
+// Fetch opens a package file in the cache directory, fetching it from
+// baseURL if it is not cached. The file is verified against sum (a sha256,
+// if not blank) and the content length. hit is true if the file was already
+// cached. The caller closes the file, it stays readable if it is evicted
+// while open.
+func (m *Mirror) Fetch(ctx context.Context, file, baseURL, sum string) (f *os.File, hit bool, err error) {
+	if !validName(file) {
+		return nil, false, errors.Errorf("invalid package file name (%s)", file)
+	}
+
+	path := filepath.Join(m.dir, file)
+	if f, err := m.open(path); err == nil {
+		return f, true, nil
+	}
+
+	// a concurrent fetch of another file can evict the file before it is
+	// opened, fetch it again once
+	for i := 0; ; i++ {
+		if err := m.wait(ctx, file, baseURL, sum); err != nil {
+			return nil, false, err
+		}
+		f, err := m.open(path)
+		if err == nil {
+			return f, false, nil
+		}
+		if !os.IsNotExist(err) || i > 0 {
+			return nil, false, errors.Wrap(err, "opening mirror file")
+		}
+	}
+}
+
+// open opens a cached package file, updating its modification time (the
+// last use, for eviction)
+func (m *Mirror) open(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now) // gone if evicted since opened
+	return f, nil
+}
+
+// wait fetches a package file, or waits for the in-flight fetch of it to
+// finish
+func (m *Mirror) wait(ctx context.Context, file, baseURL, sum string) error {
+	m.mu.Lock()
+	c, ok := m.inflight[file]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		m.inflight[file] = c
+		// the fetch is not tied to the request which started it, other
+		// requests may be waiting for it
+		go func() {
+			c.err = m.fetch(file, baseURL, sum)
+			m.mu.Lock()
+			delete(m.inflight, file)
+			m.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+	}
+	return c.err
+}
+
+// Prewarm fetches every package file which is not cached, it returns the
+// number of files fetched. Files which cannot be fetched are logged, an
+// error is returned if any could not be fetched.
+func (m *Mirror) Prewarm(ctx context.Context, files []packages.PackageFile) (int, error) {
+	fetched := 0
+	failed := 0
+	for _, pf := range files {
+		f, hit, err := m.Fetch(ctx, pf.File, pf.URL, pf.SHA256)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fetched, ctx.Err()
+			}
+			m.logger.Error().Err(err).Str("file", pf.File).Msg("prewarm")
+			failed++
+			continue
+		}
+		f.Close()
+		if !hit {
+			fetched++
+		}
+	}
+	if failed > 0 {
+		return fetched, errors.Errorf("%d of %d package files could not be fetched", failed, len(files))
+	}
+	return fetched, nil
+}
+
+// fetch downloads a package file to a temporary file, verifies it and
+// moves it into place
+func (m *Mirror) fetch(file, baseURL, sum string) error {
+	if baseURL == "" {
+		return errors.Errorf("no upstream url for %s", file)
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u := baseURL + file
+
+	m.logger.Info().Str("url", u).Msg("fetching package")
+	start := time.Now()
+
+	resp, err := m.client.Get(u)
+	if err != nil {
+		return errors.Wrapf(err, "fetching %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("fetching %s (%s)", u, resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(m.dir, tmpPrefix)
+	if err != nil {
+		return errors.Wrap(err, "creating mirror file")
+	}
+	defer os.Remove(tmp.Name()) // noop once renamed
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fetching %s", u)
+	}
+
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return errors.Errorf("fetching %s, size mismatch, expected %d got %d", u, resp.ContentLength, n)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); sum != "" && !strings.EqualFold(got, sum) {
+		return errors.Errorf("fetching %s, checksum mismatch, expected %s got %s", u, sum, got)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrap(err, "mirror file")
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(m.dir, file)); err != nil {
+		return errors.Wrap(err, "mirror file")
+	}
+
+	m.logger.Info().Str("url", u).Int64("size", n).Str("duration", time.Since(start).String()).Msg("package fetched")
+
+	if err := m.evict(file); err != nil {
+		m.logger.Warn().Err(err).Msg("evicting packages")
+	}
+
+	return nil
+}
+
+// evict removes the least recently used package files until the files are
+// within the max size, keep (the file just fetched) is never removed
+func (m *Mirror) evict(keep string) error {
+	if m.maxSize == 0 {
+		return nil
+	}
+
+	fl, err := ioutil.ReadDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	files := []os.FileInfo{}
+	total := int64(0)
+	for _, fi := range fl {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		files = append(files, fi)
+		total += fi.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	for _, fi := range files {
+		if total <= m.maxSize {
+			break
+		}
+		if fi.Name() == keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.dir, fi.Name())); err != nil {
+			return err
+		}
+		total -= fi.Size()
+		m.logger.Info().Str("file", fi.Name()).Int64("size", fi.Size()).Msg("package evicted")
+	}
+
+	return nil
+}
+
+// validName returns true if file is a plain file name, not a path or a
+// temporary (hidden) file
+func validName(file string) bool {
+	return file != "" &&
+		!strings.HasPrefix(file, ".") &&
+		!strings.ContainsAny(file, `/\`) &&
+		filepath.Base(file) == file
+}
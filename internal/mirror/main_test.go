@@ -0,0 +1,321 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/rs/zerolog"
+)
+
+// sha256 of "test"
+const testSum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// upstream is a stand-in for the upstream package server, serving "test"
+// for every .deb/.rpm file and counting requests
+type upstream struct {
+	*httptest.Server
+	requests int32
+	gate     chan struct{} // requests wait for the gate, if set
+}
+
+func newUpstream(gate chan struct{}) *upstream {
+	u := &upstream{gate: gate}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&u.requests, 1)
+		if u.gate != nil {
+			<-u.gate
+		}
+		if !strings.HasSuffix(r.URL.Path, ".deb") && !strings.HasSuffix(r.URL.Path, ".rpm") {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("test"))
+	}))
+	return u
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cosi-mirror")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	return dir
+}
+
+func TestNew(t *testing.T) {
+	t.Log("Testing New")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	t.Log("\tinvalid")
+	{
+		if _, err := New("", 0); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := New(dir, -1); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tinterrupted fetch removed")
+	{
+		tmp := filepath.Join(dir, tmpPrefix+"123")
+		if err := ioutil.WriteFile(tmp, []byte("partial"), 0644); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if _, err := New(dir, 0); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+			t.Fatal("expected temporary file to be removed")
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	t.Log("Testing Fetch")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	up := newUpstream(nil)
+	defer up.Close()
+
+	m, err := New(dir, 0)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		desc       string
+		file       string
+		baseURL    string
+		sum        string
+		hit        bool
+		shouldFail bool
+	}{
+		{"invalid name", "../etc/passwd", up.URL, "", false, true},
+		{"hidden name", ".fetch-1", up.URL, "", false, true},
+		{"no url", "a.deb", "", "", false, true},
+		{"not found", "a.tgz", up.URL, "", false, true},
+		{"checksum mismatch", "a.deb", up.URL, "abc", false, true},
+		{"miss", "a.deb", up.URL, testSum, false, false},
+		{"hit", "a.deb", up.URL, testSum, true, false},
+		{"no checksum", "b.rpm", up.URL + "/", "", false, false},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+		f, hit, err := m.Fetch(context.Background(), tst.file, tst.baseURL, tst.sum)
+		if tst.shouldFail {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if _, err := os.Stat(filepath.Join(dir, filepath.Base(tst.file))); tst.file == "a.deb" && !os.IsNotExist(err) {
+				t.Fatal("expected unverified file to be removed")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if hit != tst.hit {
+			t.Fatalf("expected hit %v, got %v", tst.hit, hit)
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil || string(data) != "test" {
+			t.Fatalf("unexpected file %s (%v)", string(data), err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&up.requests); n != 4 {
+		t.Fatalf("expected 4 upstream requests, got %d", n)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, tmpPrefix+"*"))
+	if len(files) != 0 {
+		t.Fatalf("expected no temporary files, got %v", files)
+	}
+}
+
+func TestFetchCoalesce(t *testing.T) {
+	t.Log("Testing Fetch (concurrent requests)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	gate := make(chan struct{})
+	up := newUpstream(gate)
+	defer up.Close()
+
+	m, err := New(dir, 0)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, _, err := m.Fetch(context.Background(), "a.deb", up.URL, testSum)
+			if err == nil {
+				f.Close()
+			}
+			errs <- err
+		}()
+	}
+
+	t.Log("\tcancelled request")
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, _, err := m.Fetch(ctx, "a.deb", up.URL, testSum); err != context.DeadlineExceeded {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	}
+
+	close(gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&up.requests); n != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", n)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	t.Log("Testing evict")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	up := newUpstream(nil)
+	defer up.Close()
+
+	// room for two 4 byte files
+	m, err := New(dir, 8)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	for i, file := range []string{"a.deb", "b.deb"} {
+		f, _, err := m.Fetch(context.Background(), file, up.URL, "")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		f.Close()
+		mtime := old.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, file), mtime, mtime); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+	}
+
+	// a.deb is used, b.deb becomes the least recently used
+	a, hit, err := m.Fetch(context.Background(), "a.deb", up.URL, "")
+	if err != nil || !hit {
+		t.Fatalf("expected hit, got %v %v", hit, err)
+	}
+	a.Close()
+	// b.deb is being served when it is evicted
+	b, _, err := m.Fetch(context.Background(), "b.deb", up.URL, "")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	defer b.Close()
+	mtime := old.Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "b.deb"), mtime, mtime); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	c, _, err := m.Fetch(context.Background(), "c.deb", up.URL, "")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	c.Close()
+
+	for file, exists := range map[string]bool{"a.deb": true, "b.deb": false, "c.deb": true} {
+		_, err := os.Stat(filepath.Join(dir, file))
+		if exists && err != nil {
+			t.Fatalf("expected %s, got %v", file, err)
+		}
+		if !exists && !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be evicted", file)
+		}
+	}
+
+	// an open file stays readable once evicted
+	if data, err := ioutil.ReadAll(b); err != nil || string(data) != "test" {
+		t.Fatalf("unexpected file %s (%v)", string(data), err)
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	t.Log("Testing Prewarm")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	up := newUpstream(nil)
+	defer up.Close()
+
+	m, err := New(dir, 0)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	files := []packages.PackageFile{
+		{File: "a.deb", URL: up.URL, SHA256: testSum},
+		{File: "b.rpm", URL: up.URL},
+	}
+
+	t.Log("\tfetch")
+	{
+		n, err := m.Prewarm(context.Background(), files)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if n != 2 {
+			t.Fatalf("expected 2 fetched, got %d", n)
+		}
+	}
+
+	t.Log("\tcached and failed")
+	{
+		n, err := m.Prewarm(context.Background(), append(files, packages.PackageFile{File: "c.tgz", URL: up.URL}))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if n != 0 {
+			t.Fatalf("expected 0 fetched, got %d", n)
+		}
+	}
+}
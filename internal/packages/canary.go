@@ -0,0 +1,78 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+)
+
+// checkCanary returns an error if a canary cannot be used
+func checkCanary(c *Canary) error {
+	if c.File == "" && c.Name == "" {
+		return errors.New("no package_file or package_name provided")
+	}
+	if c.SHA256 != "" && !sha256rx.MatchString(c.SHA256) {
+		return errors.Errorf("invalid sha256 (%s)", c.SHA256)
+	}
+	if err := checkPackageType(c.Type); err != nil {
+		return err
+	}
+	if c.Percent < 0 || c.Percent > 100 {
+		return errors.Errorf("invalid percent (%d), expected 0-100", c.Percent)
+	}
+	return nil
+}
+
+// canaryBucket returns the rollout bucket (0-99) of a host for a canary
+// package. A host is always in the same bucket for the same canary package,
+// so raising the percent keeps the hosts already served the canary.
+func canaryBucket(hostKey, pkg string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(pkg + "\x00" + hostKey))
+	return int(h.Sum32() % 100)
+}
+
+// rollout returns the package to serve a host, the canary package if the
+// host is in the canary percentage. Hosts without a key are not served the
+// canary.
+func (pi PackageInfo) rollout(hostKey string) PackageInfo {
+	c := pi.Canary
+	if c == nil {
+		return pi
+	}
+	if hostKey != "" && canaryBucket(hostKey, c.File+c.Name) < c.Percent {
+		return pi.canaryPackage()
+	}
+	pi.Canary = nil
+	pi.Rollout = RolloutStable
+	return pi
+}
+
+// canaryPackage returns the canary package of an entry
+func (pi PackageInfo) canaryPackage() PackageInfo {
+	c := pi.Canary
+	return PackageInfo{
+		URL:          c.URL,
+		File:         c.File,
+		PubURL:       c.PubURL,
+		PubName:      c.PubName,
+		Name:         c.Name,
+		Type:         c.Type,
+		SHA256:       c.SHA256,
+		SignatureURL: c.SignatureURL,
+		Match:        pi.Match,
+		Channel:      pi.Channel,
+		AgentVersion: c.AgentVersion,
+		Rollout:      RolloutCanary,
+		Status:       pi.Status,
+		EOL:          pi.EOL,
+		Message:      pi.Message,
+		Source:       pi.Source,
+		Overrides:    pi.Overrides,
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestCanaryBucket(t *testing.T) {
+	t.Log("Testing canaryBucket")
+
+	t.Log("\tdeterministic")
+	{
+		if canaryBucket("host-a", "pkg-1") != canaryBucket("host-a", "pkg-1") {
+			t.Fatal("expected same bucket")
+		}
+	}
+
+	t.Log("\tdistribution")
+	{
+		n := 0
+		for i := 0; i < 1000; i++ {
+			b := canaryBucket(fmt.Sprintf("host-%d", i), "pkg-1")
+			if b < 0 || b > 99 {
+				t.Fatalf("invalid bucket %d", b)
+			}
+			if b < 25 {
+				n++
+			}
+		}
+		if n < 200 || n > 300 {
+			t.Fatalf("expected ~250 of 1000 hosts in 25%%, got %d", n)
+		}
+	}
+}
+
+func TestSelectPackageCanary(t *testing.T) {
+	t.Log("Testing SelectPackage (canary)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageBaseURL, "http://updates.example.com/packages")
+	defer viper.Set(config.KeyPackageBaseURL, nil)
+
+	p, err := New("testdata/canary.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\tpercent")
+	{
+		canary := 0
+		for i := 0; i < 400; i++ {
+			sel := Selection{HostKey: fmt.Sprintf("10.0.%d.%d", i/250, i%250)}
+			pi, err := p.SelectPackage("Linux", "Ubuntu", "18.04", "x86_64", sel)
+			if err != nil {
+				t.Fatalf("expected NO error, got %v", err)
+			}
+			again, _ := p.SelectPackage("Linux", "Ubuntu", "18.04", "x86_64", sel)
+			if pi.File != again.File {
+				t.Fatalf("expected same package for %s", sel.HostKey)
+			}
+			if pi.Canary != nil {
+				t.Fatalf("expected no canary block, got %#v", pi.Canary)
+			}
+			switch pi.Rollout {
+			case RolloutCanary:
+				canary++
+				if pi.AgentVersion != "1.1.0" || pi.File != "circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb" || pi.Match == nil {
+					t.Fatalf("unexpected canary package %#v", pi)
+				}
+			case RolloutStable:
+				if pi.AgentVersion != "1.0.0" {
+					t.Fatalf("unexpected stable package %#v", pi)
+				}
+			default:
+				t.Fatalf("unexpected rollout (%s)", pi.Rollout)
+			}
+		}
+		if canary < 60 || canary > 140 {
+			t.Fatalf("expected ~100 of 400 hosts served canary, got %d", canary)
+		}
+	}
+
+	tt := []struct {
+		name    string
+		dist    string
+		vers    string
+		sel     Selection
+		rollout string
+		url     string
+	}{
+		{"no host key", "Ubuntu", "18.04", Selection{}, RolloutStable, "http://updates.example.com/packages/"},
+		{"pinned canary version", "Ubuntu", "18.04", Selection{AgentVersion: "1.1.0"}, RolloutCanary, "http://updates.example.com/packages/"},
+		{"pinned stable version", "Ubuntu", "18.04", Selection{AgentVersion: "1.0.0", HostKey: "any"}, RolloutStable, "http://updates.example.com/packages/"},
+		{"0 percent", "Ubuntu", "20.04", Selection{HostKey: "10.0.0.1"}, RolloutStable, "http://updates.example.com/packages/"},
+		{"100 percent", "CentOS", "8", Selection{HostKey: "10.0.0.1"}, RolloutCanary, "http://example.com/canary/"},
+		{"invalid canary ignored", "CentOS", "7", Selection{HostKey: "10.0.0.1"}, "", "http://updates.example.com/packages/"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.name)
+		pi, err := p.SelectPackage("Linux", tst.dist, tst.vers, "x86_64", tst.sel)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.Rollout != tst.rollout || pi.URL != tst.url {
+			t.Fatalf("expected %s (%s), got %#v", tst.rollout, tst.url, pi)
+		}
+	}
+
+	t.Log("\tversions list canary")
+	{
+		list, err := p.Versions("Linux", "CentOS", "8", "x86_64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(list) != 1 || list[0].Canary == nil || list[0].Canary.Percent != 100 || list[0].Canary.URL != "http://example.com/canary/" {
+			t.Fatalf("unexpected versions %#v", list)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// sha256rx matches a hex encoded sha256 checksum
+var sha256rx = regexp.MustCompile(`^(?i)[0-9a-f]{64}$`)
+
+// Check loads a package configuration file, or the files of a package
+// configuration directory, and returns the problems found in its entries.
+// Unlike New, which ignores (with a warning) entries New cannot use, every
+// problem is reported. An error is returned only if the file cannot be
+// loaded.
+func Check(file string) ([]string, error) {
+	if file == "" {
+		return nil, errors.Errorf("package configuration file not set")
+	}
+
+	c, _, err := loadConfigFiles(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading package configuration")
+	}
+
+	channel := strings.ToLower(viper.GetString(config.KeyPackageChannel))
+	if channel == "" {
+		channel = ChannelStable
+	}
+
+	problems := []string{}
+	seen := map[string]string{}
+
+	for i, item := range c {
+		spec := platformKey(item)
+		entry := fmt.Sprintf("entry %d", i)
+		if item.Source != file {
+			// package configuration directory
+			entry = fmt.Sprintf("%s entry %d", filepath.Base(item.Source), item.index)
+		}
+
+		if item.Fallback != FallbackNone && item.Fallback != FallbackNearestLower {
+			problems = append(problems, fmt.Sprintf("%s (%s): invalid fallback (%s)", entry, spec, item.Fallback))
+		}
+		if item.Fallback != FallbackNone && item.Version == "" && item.Arch == "" && item.PackageInfo.File == "" && item.PackageInfo.Name == "" {
+			// policy only entry
+			if item.OSType == "" || item.Distro == "" {
+				problems = append(problems, fmt.Sprintf("%s (%s): type and dist are required", entry, spec))
+			}
+			continue
+		}
+
+		if item.OSType == "" || item.Distro == "" || item.Version == "" || item.Arch == "" {
+			problems = append(problems, fmt.Sprintf("%s (%s): type, dist, vers and arch are required", entry, spec))
+		}
+		if isVersionRange(item.Version) {
+			if _, err := parseVersionRange(item.Version); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s): invalid version range (%s)", entry, spec, err))
+			}
+		}
+		if err := checkLifecycle(item.Status, item.EOL); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): %s", entry, spec, err))
+		}
+		if item.PackageInfo.File == "" && item.PackageInfo.Name == "" && strings.ToLower(item.Status) != StatusBlocked {
+			problems = append(problems, fmt.Sprintf("%s (%s): no package_file or package_name provided", entry, spec))
+		}
+		if item.PackageInfo.SHA256 != "" && !sha256rx.MatchString(item.PackageInfo.SHA256) {
+			problems = append(problems, fmt.Sprintf("%s (%s): invalid sha256 (%s)", entry, spec, item.PackageInfo.SHA256))
+		}
+		if err := checkPackageType(item.PackageInfo.Type); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): %s", entry, spec, err))
+		}
+		if item.Canary != nil {
+			if err := checkCanary(item.Canary); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s): invalid canary, %s", entry, spec, err))
+			}
+		}
+		// one package per channel and agent version
+		itemChannel := strings.ToLower(item.Channel)
+		if itemChannel == "" {
+			itemChannel = channel
+		}
+		key := spec + " " + itemChannel + " " + item.AgentVersion
+		if prev, dup := seen[key]; dup {
+			problems = append(problems, fmt.Sprintf("%s (%s): duplicate of %s", entry, spec, prev))
+		} else {
+			seen[key] = entry
+		}
+	}
+
+	if len(c) == 0 {
+		problems = append(problems, "no package entries found")
+	}
+
+	return problems, nil
+}
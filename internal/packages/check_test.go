@@ -0,0 +1,135 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestCheck(t *testing.T) {
+	t.Log("Testing Check")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("\tno file")
+	{
+		if _, err := Check(""); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tmissing file")
+	{
+		if _, err := Check("testdata/missing.file"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tinvalid syntax")
+	{
+		if _, err := Check("testdata/invalid_syntax.yaml"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tvalid")
+	{
+		problems, err := Check("testdata/valid.yaml")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(problems) != 0 {
+			t.Fatalf("expected no problems, got %v", problems)
+		}
+	}
+
+	t.Log("\tdirectory")
+	{
+		problems, err := Check("testdata/confd")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(problems) != 0 {
+			t.Fatalf("expected no problems, got %v", problems)
+		}
+	}
+
+	t.Log("\tdirectory, problems name the file")
+	{
+		problems, err := Check("testdata/confd_invalid")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		expect := "20-team.yaml entry 1 (linux/ubuntu/20.04/): type, dist, vers and arch are required"
+		if len(problems) != 1 || problems[0] != expect {
+			t.Fatalf("expected [%s], got %v", expect, problems)
+		}
+	}
+
+	t.Log("\tpackage types")
+	{
+		problems, err := Check("testdata/package_types.yaml")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(problems) != 1 || !strings.HasPrefix(problems[0], "entry 4 (linux/ubuntu/20.04/x86_64): invalid package_type (zip)") {
+			t.Fatalf("unexpected problems %v", problems)
+		}
+	}
+
+	t.Log("\tranges and fallback")
+	{
+		problems, err := Check("testdata/ranges.yaml")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(problems) != 0 {
+			t.Fatalf("expected no problems, got %v", problems)
+		}
+	}
+
+	t.Log("\tlifecycle")
+	{
+		problems, err := Check("testdata/lifecycle.yaml")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		expect := []string{
+			"entry 4 (linux/centos/7/x86_64): invalid status (retired)",
+			"entry 5 (linux/centos/8/x86_64): invalid eol date (2030/01/01), expected YYYY-MM-DD",
+		}
+		if strings.Join(problems, "\n") != strings.Join(expect, "\n") {
+			t.Fatalf("expected %v, got %v", expect, problems)
+		}
+	}
+
+	t.Log("\tproblems")
+	{
+		problems, err := Check("testdata/check.yaml")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		expect := []string{
+			"entry 1 (linux/ubuntu/16.04/x86_64): duplicate of entry 0",
+			"entry 2 (linux/centos/7/x86_64): no package_file or package_name provided",
+			"entry 3 (linux/debian/>=9 <<10/x86_64): invalid version range",
+			"entry 4 (linux/debian//): invalid fallback (nearest)",
+			"entry 6 (linux/ubuntu/16.04/x86_64): duplicate of entry 0",
+			"entry 7 (linux/centos/8/x86_64): invalid canary, invalid percent (110), expected 0-100",
+			"entry 8 (linux/centos/6/x86_64): invalid sha256 (abc123)",
+		}
+		if len(problems) != len(expect) {
+			t.Fatalf("expected %d problems, got %v", len(expect), problems)
+		}
+		for i, p := range problems {
+			if !strings.Contains(p, expect[i]) {
+				t.Fatalf("expected (%s) got (%s)", expect[i], p)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/circonus-labs/cosi-server/internal/arch"
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/pkg/errors"
+)
+
+// Conflict is a package configuration directory file overriding the entries
+// of an earlier file for the same type/dist/vers/arch
+type Conflict struct {
+	Platform   string `json:"platform"`   // type/dist/vers/arch
+	File       string `json:"file"`       // file with the effective entries
+	Overridden string `json:"overridden"` // file with the entries overridden
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %s overrides %s", c.Platform, c.File, c.Overridden)
+}
+
+// configExtensions are the package configuration file types loaded from a
+// package configuration directory
+var configExtensions = []string{".yaml", ".json", ".toml"}
+
+// Conflicts returns the entries of the files in a package configuration
+// directory which are overridden by a later file, none for a file
+func Conflicts(file string) ([]Conflict, error) {
+	if file == "" {
+		return nil, errors.Errorf("package configuration file not set")
+	}
+	_, conflicts, err := loadConfigFiles(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading package configuration")
+	}
+	return conflicts, nil
+}
+
+// loadConfigFiles loads a package configuration file or, if file is a
+// directory, every package configuration file in it in lexical order. The
+// entries of a later file replace the entries of earlier files for the same
+// type/dist/vers/arch, each replacement is returned as a conflict. Entries
+// record the file they were loaded from.
+func loadConfigFiles(file string) (packageConfig, []Conflict, error) {
+	fi, err := os.Stat(file)
+	if err != nil || !fi.IsDir() {
+		// not a directory, LoadConfigFile also accepts a file without extension
+		var c packageConfig
+		if err := config.LoadConfigFile(file, &c); err != nil {
+			return nil, nil, err
+		}
+		for i := range c {
+			c[i].Source = file
+			c[i].index = i
+		}
+		return c, nil, nil
+	}
+
+	files, err := configFiles(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := packageConfig{}
+	conflicts := []Conflict{}
+	for _, f := range files {
+		var c packageConfig
+		if err := config.LoadConfigFile(f, &c); err != nil {
+			return nil, nil, err
+		}
+
+		platforms := map[string]bool{}
+		for i := range c {
+			c[i].Source = f
+			c[i].index = i
+			platforms[platformKey(c[i])] = true
+		}
+
+		keep := packageConfig{}
+		seen := map[string]bool{}
+		for _, item := range merged {
+			key := platformKey(item)
+			if !platforms[key] {
+				keep = append(keep, item)
+				continue
+			}
+			if !seen[key+" "+item.Source] {
+				seen[key+" "+item.Source] = true
+				conflicts = append(conflicts, Conflict{Platform: key, File: f, Overridden: item.Source})
+			}
+		}
+		merged = append(keep, c...)
+	}
+
+	return merged, conflicts, nil
+}
+
+// configFiles returns the package configuration files in dir, sorted
+func configFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading package configuration directory")
+	}
+
+	files := []string{}
+	for _, fi := range entries {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		for _, ext := range configExtensions {
+			if filepath.Ext(fi.Name()) == ext {
+				files = append(files, filepath.Join(dir, fi.Name()))
+				break
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no package configuration files in directory (%s)", dir)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// platformKey returns the type/dist/vers/arch of an entry, the granularity
+// at which the files of a package configuration directory override
+func platformKey(item osDetail) string {
+	return strings.Join([]string{
+		strings.ToLower(item.OSType),
+		strings.ToLower(item.Distro),
+		item.Version,
+		arch.Canonical(item.Arch),
+	}, "/")
+}
+
+// overriddenFiles returns, by type/dist/vers/arch, the files whose entries
+// were overridden
+func overriddenFiles(conflicts []Conflict) map[string][]string {
+	m := map[string][]string{}
+	for _, c := range conflicts {
+		m[c.Platform] = append(m[c.Platform], c.Overridden)
+	}
+	return m
+}
@@ -0,0 +1,145 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLoadConfigFiles(t *testing.T) {
+	t.Log("Testing loadConfigFiles")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("\tfile")
+	{
+		c, conflicts, err := loadConfigFiles("testdata/valid.yaml")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(conflicts) != 0 {
+			t.Fatalf("expected no conflicts, got %v", conflicts)
+		}
+		for _, item := range c {
+			if item.Source != "testdata/valid.yaml" {
+				t.Fatalf("expected source testdata/valid.yaml, got '%s'", item.Source)
+			}
+		}
+	}
+
+	t.Log("\tno config files in directory")
+	{
+		if _, _, err := loadConfigFiles("testdata/confd_empty"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tdirectory")
+	{
+		c, conflicts, err := loadConfigFiles("testdata/confd")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+
+		expect := []struct {
+			file   string
+			source string
+		}{
+			{"circonus-agent-1.0.0-1.ubuntu.16.04_x86_64.deb", "testdata/confd/10-base.yaml"},
+			{"circonus-agent-1.2.0-1.ubuntu.20.04_x86_64.deb", "testdata/confd/20-ubuntu.json"},
+			{"circonus-agent-1.2.0-1.el7.x86_64.rpm", "testdata/confd/30-centos.yaml"},
+			{"circonus-agent-1.3.0-beta.1-1.ubuntu.18.04_x86_64.deb", "testdata/confd/30-centos.yaml"},
+		}
+		if len(c) != len(expect) {
+			t.Fatalf("expected %d entries, got %d (%v)", len(expect), len(c), c)
+		}
+		for i, e := range expect {
+			if c[i].PackageInfo.File != e.file || c[i].Source != e.source {
+				t.Fatalf("entry %d, expected %s from %s, got %s from %s", i, e.file, e.source, c[i].PackageInfo.File, c[i].Source)
+			}
+		}
+
+		expectConflicts := []Conflict{
+			{"linux/ubuntu/18.04/x86_64", "testdata/confd/20-ubuntu.json", "testdata/confd/10-base.yaml"},
+			{"linux/centos/7/x86_64", "testdata/confd/30-centos.yaml", "testdata/confd/10-base.yaml"},
+			{"linux/ubuntu/18.04/x86_64", "testdata/confd/30-centos.yaml", "testdata/confd/20-ubuntu.json"},
+		}
+		if !reflect.DeepEqual(conflicts, expectConflicts) {
+			t.Fatalf("expected %v, got %v", expectConflicts, conflicts)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	t.Log("Testing Conflicts")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	if _, err := Conflicts(""); err == nil {
+		t.Fatal("expected error")
+	}
+
+	conflicts, err := Conflicts("testdata/confd")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if len(conflicts) != 3 {
+		t.Fatalf("expected 3 conflicts, got %v", conflicts)
+	}
+	expect := "linux/ubuntu/18.04/x86_64: testdata/confd/20-ubuntu.json overrides testdata/confd/10-base.yaml"
+	if conflicts[0].String() != expect {
+		t.Fatalf("expected '%s', got '%s'", expect, conflicts[0].String())
+	}
+}
+
+func TestNewConfigDir(t *testing.T) {
+	t.Log("Testing New (package configuration directory)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p, err := New("testdata/confd")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if len(p.Conflicts()) != 3 {
+		t.Fatalf("expected 3 conflicts, got %v", p.Conflicts())
+	}
+
+	t.Log("\tnot overridden")
+	{
+		pi, err := p.SelectPackage("linux", "ubuntu", "16.04", "x86_64", Selection{})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.Source != "testdata/confd/10-base.yaml" {
+			t.Fatalf("unexpected source (%s)", pi.Source)
+		}
+		if len(pi.Overrides) != 0 {
+			t.Fatalf("expected no overrides, got %v", pi.Overrides)
+		}
+	}
+
+	t.Log("\toverridden, every entry of the platform is replaced")
+	{
+		if _, err := p.SelectPackage("linux", "ubuntu", "18.04", "x86_64", Selection{}); err == nil {
+			t.Fatal("expected error, stable package overridden by a beta only file")
+		}
+		pi, err := p.SelectPackage("linux", "ubuntu", "18.04", "x86_64", Selection{Channel: ChannelBeta})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.File != "circonus-agent-1.3.0-beta.1-1.ubuntu.18.04_x86_64.deb" {
+			t.Fatalf("unexpected package (%s)", pi.File)
+		}
+		if pi.Source != "testdata/confd/30-centos.yaml" {
+			t.Fatalf("unexpected source (%s)", pi.Source)
+		}
+		expect := []string{"testdata/confd/10-base.yaml", "testdata/confd/20-ubuntu.json"}
+		if !reflect.DeepEqual(pi.Overrides, expect) {
+			t.Fatalf("expected overrides %v, got %v", expect, pi.Overrides)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/circonus-labs/cosi-server/internal/arch"
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// pattern is a compiled package file name pattern
+type pattern struct {
+	ostype string
+	dist   string
+	rx     *regexp.Regexp
+}
+
+// generated is a package file matched by a pattern
+type generated struct {
+	entry osDetail
+	ver   *semver.Version
+}
+
+// GenerateConfig returns the package configuration, as yaml, generated from
+// the package files in dir merged with the entries of the overrides package
+// configuration file or directory (if not blank). With all, an entry is generated for
+// every agent version of a platform, otherwise only for the newest.
+func GenerateConfig(dir, overrides string, all bool) ([]byte, error) {
+	c, _, err := generateConfig(dir, overrides, all)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding package configuration")
+	}
+
+	return data, nil
+}
+
+// generateConfig returns the package configuration generated from the
+// package files in dir merged with the overrides package configuration file
+// or directory, and the conflicts between the files of the directory
+func generateConfig(dir, overrides string, all bool) (packageConfig, []Conflict, error) {
+	pats, err := patterns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gen, err := generate(dir, pats, all)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range gen {
+		gen[i].Source = filepath.Join(dir, gen[i].PackageInfo.File)
+	}
+
+	var c packageConfig
+	var conflicts []Conflict
+	if overrides != "" {
+		c, conflicts, err = loadConfigFiles(overrides)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "loading package configuration")
+		}
+	}
+
+	return mergeConfig(gen, c), conflicts, nil
+}
+
+// patterns returns the compiled package file name patterns, the defaults if
+// none are configured
+func patterns() ([]pattern, error) {
+	var cfg []config.PackagePattern
+	if err := viper.UnmarshalKey(config.KeyPackagePatterns, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing package patterns")
+	}
+	if len(cfg) == 0 {
+		for _, p := range defaults.PackagePatterns {
+			cfg = append(cfg, config.PackagePattern{Type: p["type"], Dist: p["dist"], Regex: p["regex"]})
+		}
+	}
+
+	pats := make([]pattern, 0, len(cfg))
+	for i, p := range cfg {
+		rx, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "package pattern %d", i)
+		}
+		groups := map[string]bool{}
+		for _, name := range rx.SubexpNames() {
+			groups[name] = true
+		}
+		for _, name := range []string{"agent_version", "vers", "arch"} {
+			if !groups[name] {
+				return nil, errors.Errorf("package pattern %d: missing (?P<%s>) group", i, name)
+			}
+		}
+		if p.Type == "" && !groups["type"] {
+			return nil, errors.Errorf("package pattern %d: no type or (?P<type>) group", i)
+		}
+		if p.Dist == "" && !groups["dist"] {
+			return nil, errors.Errorf("package pattern %d: no dist or (?P<dist>) group", i)
+		}
+		pats = append(pats, pattern{ostype: p.Type, dist: p.Dist, rx: rx})
+	}
+
+	return pats, nil
+}
+
+// match returns the entry (type, dist, vers, arch, agent version) for a
+// package file name, if it matches the pattern
+func (p pattern) match(name string) (osDetail, bool) {
+	m := p.rx.FindStringSubmatch(name)
+	if m == nil {
+		return osDetail{}, false
+	}
+
+	entry := osDetail{OSType: p.ostype, Distro: p.dist}
+	for i, group := range p.rx.SubexpNames() {
+		switch group {
+		case "type":
+			entry.OSType = m[i]
+		case "dist":
+			entry.Distro = m[i]
+		case "vers":
+			entry.Version = m[i]
+		case "arch":
+			entry.Arch = arch.Canonical(m[i])
+		case "agent_version":
+			entry.AgentVersion = m[i]
+		}
+	}
+
+	return entry, true
+}
+
+// FilePlatforms returns the platforms (type, dist, vers, arch) of package
+// file names, from the package_patterns file name patterns. A file may be
+// for several platforms (e.g. el7 packages for CentOS and RedHat), files
+// not matching any pattern are not included.
+func FilePlatforms(names []string) (map[string][]Platform, error) {
+	pats, err := patterns()
+	if err != nil {
+		return nil, err
+	}
+
+	list := map[string][]Platform{}
+	for _, name := range names {
+		// rpm pre-release versions use '~' (e.g. 1.0.0~beta.1)
+		n := strings.Replace(name, `~`, `-`, -1)
+		for _, p := range pats {
+			entry, ok := p.match(n)
+			if !ok {
+				continue
+			}
+			list[name] = append(list[name], Platform{Type: entry.OSType, Dist: entry.Distro, Vers: entry.Version, Arch: entry.Arch})
+		}
+	}
+
+	return list, nil
+}
+
+// generate returns entries for the package files in dir matching a pattern.
+// A file may match several patterns (e.g. el7 packages for CentOS and
+// RedHat). Pre-release agent versions are in the beta channel. Without all,
+// only the newest agent version of each platform (and channel) is kept.
+func generate(dir string, pats []pattern, all bool) (packageConfig, error) {
+	if dir == "" {
+		return nil, errors.New("invalid package path (empty)")
+	}
+
+	fl, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading package directory")
+	}
+
+	byKey := map[string][]generated{}
+	for _, fi := range fl {
+		if fi.IsDir() {
+			continue
+		}
+		// rpm pre-release versions use '~' (e.g. 1.0.0~beta.1)
+		name := strings.Replace(fi.Name(), `~`, `-`, -1)
+		for _, p := range pats {
+			entry, ok := p.match(name)
+			if !ok {
+				continue
+			}
+			entry.PackageInfo.File = fi.Name()
+			g := generated{entry: entry}
+			v, err := semver.NewVersion(g.entry.AgentVersion)
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("pkg", "packages").
+					Str("file", fi.Name()).
+					Str("agent_version", g.entry.AgentVersion).
+					Msg("could not parse agent version, skipping")
+				continue
+			}
+			g.ver = v
+			if v.Prerelease() != "" {
+				g.entry.Channel = ChannelBeta
+			}
+			key := entryKey(g.entry, "")
+			byKey[key] = append(byKey[key], g)
+		}
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	c := packageConfig{}
+	for _, key := range keys {
+		list := byKey[key]
+		sort.Slice(list, func(i, j int) bool { return list[i].ver.GreaterThan(list[j].ver) })
+		if !all {
+			list = list[:1]
+		}
+		for _, g := range list {
+			c = append(c, g.entry)
+		}
+	}
+
+	return c, nil
+}
+
+// mergeConfig returns the generated entries, except those for a platform
+// and channel with an override entry, followed by the override entries
+func mergeConfig(gen, overrides packageConfig) packageConfig {
+	channel := strings.ToLower(viper.GetString(config.KeyPackageChannel))
+	if channel == "" {
+		channel = ChannelStable
+	}
+
+	overridden := map[string]bool{}
+	for _, item := range overrides {
+		overridden[entryKey(item, channel)] = true
+	}
+
+	c := packageConfig{}
+	for _, item := range gen {
+		if overridden[entryKey(item, channel)] {
+			log.Debug().
+				Str("pkg", "packages").
+				Str("file", item.PackageInfo.File).
+				Msg("generated entry overridden")
+			continue
+		}
+		c = append(c, item)
+	}
+
+	return append(c, overrides...)
+}
+
+// entryKey returns the type/dist/vers/arch/channel of an entry, blank
+// channels are the default channel
+func entryKey(item osDetail, channel string) string {
+	ch := strings.ToLower(item.Channel)
+	if ch == "" {
+		ch = channel
+	}
+	return strings.Join([]string{
+		strings.ToLower(item.OSType),
+		strings.ToLower(item.Distro),
+		item.Version,
+		arch.Canonical(item.Arch),
+		ch,
+	}, "/")
+}
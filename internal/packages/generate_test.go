@@ -0,0 +1,201 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Log("Testing generate")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	pats, err := patterns()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\tinvalid dir")
+	{
+		if _, err := generate("", pats, false); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := generate("testdata/missing", pats, false); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	tt := []struct {
+		all    bool
+		expect []string
+	}{
+		{false, []string{
+			"bsd/freebsd/12.1/x86_64/ circonus-agent-1.0.0-1.freebsd.12.1_amd64.tgz",
+			"linux/centos/7/x86_64/ circonus-agent-1.1.0-1.el7.x86_64.rpm",
+			"linux/oracle/7/x86_64/ circonus-agent-1.1.0-1.el7.x86_64.rpm",
+			"linux/redhat/7/x86_64/ circonus-agent-1.1.0-1.el7.x86_64.rpm",
+			"linux/ubuntu/18.04/x86_64/ circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb",
+			"linux/ubuntu/18.04/x86_64/beta circonus-agent-1.2.0-beta.1-1.ubuntu.18.04_x86_64.deb",
+			"linux/ubuntu/20.04/x86_64/ circonus-agent-1.1.0-1.ubuntu.20.04_amd64.deb",
+		}},
+		{true, []string{
+			"bsd/freebsd/12.1/x86_64/ circonus-agent-1.0.0-1.freebsd.12.1_amd64.tgz",
+			"linux/centos/7/x86_64/ circonus-agent-1.1.0-1.el7.x86_64.rpm",
+			"linux/oracle/7/x86_64/ circonus-agent-1.1.0-1.el7.x86_64.rpm",
+			"linux/redhat/7/x86_64/ circonus-agent-1.1.0-1.el7.x86_64.rpm",
+			"linux/ubuntu/18.04/x86_64/ circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb",
+			"linux/ubuntu/18.04/x86_64/ circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb",
+			"linux/ubuntu/18.04/x86_64/beta circonus-agent-1.2.0-beta.1-1.ubuntu.18.04_x86_64.deb",
+			"linux/ubuntu/20.04/x86_64/ circonus-agent-1.1.0-1.ubuntu.20.04_amd64.deb",
+		}},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\tall=%v", tst.all)
+
+		c, err := generate("testdata/generate", pats, tst.all)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(c) != len(tst.expect) {
+			t.Fatalf("expected %d entries, got %d %#v", len(tst.expect), len(c), c)
+		}
+		for i, item := range c {
+			got := entryKey(item, "") + " " + item.PackageInfo.File
+			if got != tst.expect[i] {
+				t.Fatalf("entry %d expected (%s) got (%s)", i, tst.expect[i], got)
+			}
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	t.Log("Testing patterns")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	tt := []struct {
+		name   string
+		pat    config.PackagePattern
+		errMsg string
+	}{
+		{"invalid regex", config.PackagePattern{Type: "Linux", Dist: "Ubuntu", Regex: `(`}, "package pattern 0"},
+		{"missing group", config.PackagePattern{Type: "Linux", Dist: "Ubuntu", Regex: `^(?P<vers>.+)_(?P<arch>.+)$`}, "missing (?P<agent_version>) group"},
+		{"missing dist", config.PackagePattern{Type: "Linux", Regex: `^(?P<agent_version>.+)-(?P<vers>.+)_(?P<arch>.+)$`}, "no dist or (?P<dist>) group"},
+		{"dist group", config.PackagePattern{Type: "Linux", Regex: `^(?P<agent_version>.+)-(?P<dist>.+)\.(?P<vers>.+)_(?P<arch>.+)$`}, ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.name)
+
+		viper.Set(config.KeyPackagePatterns, []config.PackagePattern{tst.pat})
+		_, err := patterns()
+		if tst.errMsg == "" {
+			if err != nil {
+				t.Fatalf("expected NO error, got %v", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), tst.errMsg) {
+			t.Fatalf("expected (%s) got (%s)", tst.errMsg, err)
+		}
+	}
+}
+
+func TestGenerateConfig(t *testing.T) {
+	t.Log("Testing GenerateConfig")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	data, err := GenerateConfig("testdata/generate", "testdata/generate_overrides.yaml", false)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	var c packageConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	// 7 generated, ubuntu 20.04 overridden, 2 overrides
+	if len(c) != 8 {
+		t.Fatalf("expected 8 entries, got %d\n%s", len(c), string(data))
+	}
+	for _, item := range c {
+		if item.PackageInfo.File == "circonus-agent-1.1.0-1.ubuntu.20.04_amd64.deb" {
+			t.Fatalf("expected generated entry to be overridden\n%s", string(data))
+		}
+	}
+	if strings.Contains(string(data), "canary") || strings.Contains(string(data), "sha256") {
+		t.Fatalf("expected unset attributes to be omitted\n%s", string(data))
+	}
+}
+
+func TestNewGenerate(t *testing.T) {
+	t.Log("Testing New (generate)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyPackageGenerate, true)
+	viper.Set(config.KeyLocalPackagePath, "testdata/generate")
+	viper.Set(config.KeyPackageConfigFile, "testdata/generate_overrides.yaml")
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	defer viper.Reset()
+
+	p, err := New("")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		ostype, dist, vers, arch string
+		sel                      Selection
+		file                     string
+	}{
+		{"Linux", "Ubuntu", "18.04", "x86_64", Selection{}, "circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb"},
+		{"Linux", "Ubuntu", "18.04", "x86_64", Selection{Channel: ChannelBeta}, "circonus-agent-1.2.0-beta.1-1.ubuntu.18.04_x86_64.deb"},
+		{"Linux", "Ubuntu", "20.04", "amd64", Selection{}, "circonus-agent-1.0.5-1.ubuntu.20.04_x86_64.deb"},
+		{"Linux", "Ubuntu", "19.10", "x86_64", Selection{}, "circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb"}, // override fallback policy
+		{"Linux", "RedHat", "7", "x86_64", Selection{}, "circonus-agent-1.1.0-1.el7.x86_64.rpm"},
+		{"BSD", "FreeBSD", "12.1", "amd64", Selection{}, "circonus-agent-1.0.0-1.freebsd.12.1_amd64.tgz"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s %s %s %s", tst.ostype, tst.dist, tst.vers, tst.arch, tst.sel.Channel)
+
+		pi, err := p.SelectPackage(tst.ostype, tst.dist, tst.vers, tst.arch, tst.sel)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.File != tst.file {
+			t.Fatalf("expected (%s) got (%s)", tst.file, pi.File)
+		}
+	}
+
+	t.Log("\tinvalid package dir")
+	{
+		viper.Set(config.KeyLocalPackagePath, "testdata/missing")
+		if _, err := New(""); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
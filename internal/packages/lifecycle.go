@@ -0,0 +1,76 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EOLLayout is the format of entry eol dates
+const EOLLayout = "2006-01-02"
+
+// now returns the current time, replaced in tests
+var now = time.Now
+
+// checkLifecycle returns an error if the status or eol date of an entry
+// cannot be used
+func checkLifecycle(status, eol string) error {
+	switch strings.ToLower(status) {
+	case "", StatusSupported, StatusDeprecated, StatusEOL, StatusBlocked:
+	default:
+		return errors.Errorf("invalid status (%s)", status)
+	}
+	if eol != "" {
+		if _, err := time.Parse(EOLLayout, eol); err != nil {
+			return errors.Errorf("invalid eol date (%s), expected YYYY-MM-DD", eol)
+		}
+	}
+	return nil
+}
+
+// lifecycle returns the effective lifecycle status of an entry and, for
+// platforms which are not supported, a warning (the entry's message if it
+// has one). Supported and deprecated platforms past their eol date are eol.
+func lifecycle(status, eol, message, distro, version string) (string, string) {
+	status = strings.ToLower(status)
+	if status == "" {
+		status = StatusSupported
+	}
+	if eol != "" && (status == StatusSupported || status == StatusDeprecated) {
+		if t, err := time.Parse(EOLLayout, eol); err == nil && !now().Before(t) {
+			status = StatusEOL
+		}
+	}
+
+	if status == StatusSupported || message != "" {
+		return status, message
+	}
+
+	platform := strings.TrimSpace(distro + " " + version)
+	switch status {
+	case StatusDeprecated:
+		if eol != "" {
+			return status, fmt.Sprintf("%s is deprecated, end of life %s", platform, eol)
+		}
+		return status, fmt.Sprintf("%s is deprecated", platform)
+	case StatusEOL:
+		if eol != "" {
+			return status, fmt.Sprintf("%s is end of life (%s), it is no longer supported", platform, eol)
+		}
+		return status, fmt.Sprintf("%s is end of life, it is no longer supported", platform)
+	default:
+		return status, fmt.Sprintf("%s is no longer supported, agent packages are not available", platform)
+	}
+}
+
+// setLifecycle sets the effective lifecycle status and warning of a package
+func (pi *PackageInfo) setLifecycle(distro, version string) {
+	pi.Status, pi.Warning = lifecycle(pi.Status, pi.EOL, pi.Message, distro, version)
+}
@@ -0,0 +1,145 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLifecycle(t *testing.T) {
+	t.Log("Testing lifecycle")
+
+	now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tt := []struct {
+		status  string
+		eol     string
+		message string
+		expect  string
+		warning string
+	}{
+		{"", "", "", StatusSupported, ""},
+		{"Supported", "2030-01-01", "", StatusSupported, ""},
+		{"", "2024-12-31", "", StatusEOL, "Ubuntu 14.04 is end of life (2024-12-31), it is no longer supported"},
+		{"deprecated", "", "", StatusDeprecated, "Ubuntu 14.04 is deprecated"},
+		{"deprecated", "2025-01-02", "", StatusDeprecated, "Ubuntu 14.04 is deprecated, end of life 2025-01-02"},
+		{"deprecated", "2025-01-01", "", StatusEOL, "Ubuntu 14.04 is end of life (2025-01-01), it is no longer supported"},
+		{"deprecated", "", "upgrade", StatusDeprecated, "upgrade"},
+		{"eol", "", "", StatusEOL, "Ubuntu 14.04 is end of life, it is no longer supported"},
+		{"blocked", "2020-01-01", "", StatusBlocked, "Ubuntu 14.04 is no longer supported, agent packages are not available"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s %s", tst.status, tst.eol, tst.message)
+		status, warning := lifecycle(tst.status, tst.eol, tst.message, "Ubuntu", "14.04")
+		if status != tst.expect {
+			t.Fatalf("expected status '%s', got '%s'", tst.expect, status)
+		}
+		if warning != tst.warning {
+			t.Fatalf("expected warning '%s', got '%s'", tst.warning, warning)
+		}
+	}
+}
+
+func TestCheckLifecycle(t *testing.T) {
+	t.Log("Testing checkLifecycle")
+
+	tt := []struct {
+		status     string
+		eol        string
+		shouldFail bool
+	}{
+		{"", "", false},
+		{"Deprecated", "2020-01-01", false},
+		{"blocked", "", false},
+		{"retired", "", true},
+		{"eol", "2020/01/01", true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.status, tst.eol)
+		err := checkLifecycle(tst.status, tst.eol)
+		if tst.shouldFail && err == nil {
+			t.Fatal("expected error")
+		}
+		if !tst.shouldFail && err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+	}
+}
+
+func TestSelectPackageLifecycle(t *testing.T) {
+	t.Log("Testing SelectPackage (lifecycle)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	now = func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	p, err := New("testdata/lifecycle.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		dist    string
+		vers    string
+		status  string
+		eol     string
+		file    string
+		warning string
+	}{
+		{"Ubuntu", "20.04", StatusSupported, "", "circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb", ""},
+		{"Ubuntu", "16.04", StatusDeprecated, "2099-04-30", "circonus-agent-1.0.0-1.ubuntu.16.04_x86_64.deb", "Ubuntu 16.04 is deprecated, end of life 2099-04-30"},
+		{"Ubuntu", "14.04", StatusEOL, "2019-04-30", "circonus-agent-1.0.0-1.ubuntu.14.04_x86_64.deb", "Ubuntu 14.04 is end of life (2019-04-30), it is no longer supported"},
+		{"CentOS", "6", StatusBlocked, "", "", "CentOS 6 is not supported, upgrade to CentOS 7 or later"},
+		// invalid lifecycle is ignored
+		{"CentOS", "7", StatusSupported, "", "circonus-agent-1.0.0-1.el7.x86_64.rpm", ""},
+		{"CentOS", "8", StatusSupported, "", "circonus-agent-1.0.0-1.el8.x86_64.rpm", ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.dist, tst.vers)
+		pi, err := p.SelectPackage("Linux", tst.dist, tst.vers, "x86_64", Selection{})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.Status != tst.status || pi.EOL != tst.eol || pi.File != tst.file || pi.Warning != tst.warning {
+			t.Fatalf("unexpected package %#v", pi)
+		}
+	}
+
+	t.Log("\tsupported platforms")
+	{
+		statuses := map[string]string{}
+		for _, pi := range p.SupportedPlatforms() {
+			statuses[pi.Platform.String()] = pi.Status
+		}
+		if statuses["linux/ubuntu/14.04/x86_64"] != StatusEOL || statuses["linux/centos/6/x86_64"] != StatusBlocked {
+			t.Fatalf("unexpected statuses %v", statuses)
+		}
+	}
+
+	t.Log("\tend of life date passed, same status from SelectPackage and SupportedPlatforms")
+	{
+		now = func() time.Time { return time.Date(2099, 5, 1, 0, 0, 0, 0, time.UTC) }
+		pi, err := p.SelectPackage("Linux", "Ubuntu", "16.04", "x86_64", Selection{})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.Status != StatusEOL {
+			t.Fatalf("expected %s, got %s", StatusEOL, pi.Status)
+		}
+		for _, info := range p.SupportedPlatforms() {
+			if info.Platform.String() == "linux/ubuntu/16.04/x86_64" && info.Status != StatusEOL {
+				t.Fatalf("expected %s, got %s", StatusEOL, info.Status)
+			}
+		}
+	}
+}
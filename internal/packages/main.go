@@ -7,8 +7,11 @@ package packages
 
 import (
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
+	"github.com/circonus-labs/cosi-server/internal/arch"
 	"github.com/circonus-labs/cosi-server/internal/config"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -17,23 +20,73 @@ import (
 
 // New creates new instance of packages
 func New(file string) (*Packages, error) {
-	if file == "" {
-		file = viper.GetString(config.KeyPackageConfigFile)
-		if file == "" {
-			return nil, errors.Errorf("package configuration file not set")
-		}
+	c, conflicts, err := loadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, cf := range conflicts {
+		log.Warn().
+			Str("pkg", "packages").
+			Str("platform", cf.Platform).
+			Str("file", cf.File).
+			Str("overridden", cf.Overridden).
+			Msg("package configuration conflict, later file overrides")
 	}
+	overridden := overriddenFiles(conflicts)
 
-	var c packageConfig
-	if err := config.LoadConfigFile(file, &c); err != nil {
-		return nil, errors.Wrap(err, "loading package configuration")
+	channel := strings.ToLower(viper.GetString(config.KeyPackageChannel))
+	if channel == "" {
+		channel = ChannelStable
 	}
 
 	list := packageList{}
+	ranges := rangeList{}
+	fallback := map[string]map[string]string{}
 	supported := []string{}
 
 	for _, item := range c {
-		if item.PackageInfo.File == "" && item.PackageInfo.Name == "" {
+		ostype := strings.ToLower(item.OSType)
+		dist := strings.ToLower(item.Distro)
+
+		if item.Fallback != FallbackNone {
+			if item.Fallback == FallbackNearestLower {
+				if _, ok := fallback[ostype]; !ok {
+					fallback[ostype] = map[string]string{}
+				}
+				fallback[ostype][dist] = item.Fallback
+			} else {
+				log.Warn().
+					Str("pkg", "packages").
+					Str("type", item.OSType).
+					Str("dist", item.Distro).
+					Str("fallback", item.Fallback).
+					Msg("invalid version fallback policy, ignoring")
+			}
+			if item.Version == "" && item.Arch == "" && item.PackageInfo.File == "" && item.PackageInfo.Name == "" {
+				continue // policy only entry
+			}
+		}
+
+		if err := checkLifecycle(item.Status, item.EOL); err != nil {
+			log.Warn().
+				Err(err).
+				Str("pkg", "packages").
+				Str("type", item.OSType).
+				Str("dist", item.Distro).
+				Str("vers", item.Version).
+				Str("arch", item.Arch).
+				Msg("invalid lifecycle, ignoring")
+			item.Status = ""
+			item.EOL = ""
+		}
+		item.PackageInfo.Status = strings.ToLower(item.Status)
+		item.PackageInfo.EOL = item.EOL
+		item.PackageInfo.Message = item.Message
+		item.PackageInfo.Source = item.Source
+		item.PackageInfo.Overrides = overridden[platformKey(item)]
+
+		// blocked platforms do not need a package
+		if item.PackageInfo.File == "" && item.PackageInfo.Name == "" && item.PackageInfo.Status != StatusBlocked {
 			log.Warn().
 				Str("pkg", "packages").
 				Str("type", item.OSType).
@@ -44,19 +97,81 @@ func New(file string) (*Packages, error) {
 			continue
 		}
 
-		ostype := strings.ToLower(item.OSType)
-		dist := strings.ToLower(item.Distro)
-
-		if _, ok := list[ostype]; !ok {
-			list[ostype] = map[string]map[string]map[string]PackageInfo{}
+		item.PackageInfo.Channel = strings.ToLower(item.Channel)
+		if item.PackageInfo.Channel == "" {
+			item.PackageInfo.Channel = channel
 		}
-		if _, ok := list[ostype][dist]; !ok {
-			list[ostype][dist] = map[string]map[string]PackageInfo{}
+		item.PackageInfo.AgentVersion = item.AgentVersion
+		item.PackageInfo.SHA256 = strings.ToLower(item.PackageInfo.SHA256)
+		if err := checkPackageType(item.PackageInfo.Type); err != nil {
+			log.Warn().
+				Err(err).
+				Str("pkg", "packages").
+				Str("type", item.OSType).
+				Str("dist", item.Distro).
+				Str("vers", item.Version).
+				Str("arch", item.Arch).
+				Msg("invalid package type, ignoring")
+			item.PackageInfo.Type = ""
 		}
-		if _, ok := list[ostype][dist][item.Version]; !ok {
-			list[ostype][dist][item.Version] = map[string]PackageInfo{}
+		item.PackageInfo.Type = strings.ToLower(item.PackageInfo.Type)
+		if item.Canary != nil {
+			if err := checkCanary(item.Canary); err != nil {
+				log.Warn().
+					Err(err).
+					Str("pkg", "packages").
+					Str("type", item.OSType).
+					Str("dist", item.Distro).
+					Str("vers", item.Version).
+					Str("arch", item.Arch).
+					Msg("invalid canary, ignoring")
+			} else {
+				item.Canary.Type = strings.ToLower(item.Canary.Type)
+				item.PackageInfo.Canary = item.Canary
+			}
+		}
+		sysarch := arch.Canonical(item.Arch)
+
+		if isVersionRange(item.Version) {
+			constraint, err := parseVersionRange(item.Version)
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("pkg", "packages").
+					Str("type", item.OSType).
+					Str("dist", item.Distro).
+					Str("vers", item.Version).
+					Msg("invalid version range, ignoring")
+				continue
+			}
+			if _, ok := ranges[ostype]; !ok {
+				ranges[ostype] = map[string][]*versionRange{}
+			}
+			var vr *versionRange
+			for _, r := range ranges[ostype][dist] {
+				if r.vers == item.Version {
+					vr = r
+					break
+				}
+			}
+			if vr == nil {
+				vr = &versionRange{vers: item.Version, constraint: constraint, archs: map[string][]PackageInfo{}}
+				ranges[ostype][dist] = append(ranges[ostype][dist], vr)
+			}
+			vr.archs[sysarch] = addPackage(vr.archs[sysarch], item.PackageInfo)
+		} else {
+			if _, ok := list[ostype]; !ok {
+				list[ostype] = map[string]map[string]map[string][]PackageInfo{}
+			}
+			if _, ok := list[ostype][dist]; !ok {
+				list[ostype][dist] = map[string]map[string][]PackageInfo{}
+			}
+			if _, ok := list[ostype][dist][item.Version]; !ok {
+				list[ostype][dist][item.Version] = map[string][]PackageInfo{}
+			}
+			archs := list[ostype][dist][item.Version]
+			archs[sysarch] = addPackage(archs[sysarch], item.PackageInfo)
 		}
-		list[ostype][dist][item.Version][item.Arch] = item.PackageInfo
 		supported = append(supported, fmt.Sprintf("%s %s %s", item.Distro, item.Version, item.Arch))
 		log.Debug().
 			Str("pkg", "packages").
@@ -64,14 +179,72 @@ func New(file string) (*Packages, error) {
 			Str("dist", item.Distro).
 			Str("vers", item.Version).
 			Str("arch", item.Arch).
+			Str("channel", item.PackageInfo.Channel).
+			Str("agent_version", item.AgentVersion).
+			Str("source", item.Source).
 			Msg("added")
 	}
 
-	if len(list) == 0 {
+	if len(list) == 0 && len(ranges) == 0 {
 		return nil, errors.New("no valid packages found")
 	}
 
-	return &Packages{supported, list}, nil
+	return &Packages{
+		supported:   supported,
+		packageList: list,
+		ranges:      ranges,
+		fallback:    fallback,
+		channel:     channel,
+		conflicts:   conflicts,
+	}, nil
+}
+
+// loadConfig loads the package configuration file, or the files of the
+// package configuration directory, or, if package_generate is enabled,
+// generates the package configuration from the package files in
+// local_package_path with the package configuration file (if set) entries
+// as overrides
+func loadConfig(file string) (packageConfig, []Conflict, error) {
+	if file == "" {
+		file = viper.GetString(config.KeyPackageConfigFile)
+	}
+
+	if viper.GetBool(config.KeyPackageGenerate) {
+		c, conflicts, err := generateConfig(viper.GetString(config.KeyLocalPackagePath), file, viper.GetBool(config.KeyPackageGenerateAll))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "generating package configuration")
+		}
+		return c, conflicts, nil
+	}
+
+	if file == "" {
+		return nil, nil, errors.Errorf("package configuration file not set")
+	}
+
+	c, conflicts, err := loadConfigFiles(file)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "loading package configuration")
+	}
+
+	return c, conflicts, nil
+}
+
+// Conflicts returns the entries of the package configuration directory
+// files overridden by a later file
+func (p *Packages) Conflicts() []Conflict {
+	return p.conflicts
+}
+
+// addPackage adds a package to the packages of an entry, replacing a package
+// with the same channel and agent version
+func addPackage(pkgs []PackageInfo, pi PackageInfo) []PackageInfo {
+	for i, p := range pkgs {
+		if p.Channel == pi.Channel && p.AgentVersion == pi.AgentVersion {
+			pkgs[i] = pi
+			return pkgs
+		}
+	}
+	return append(pkgs, pi)
 }
 
 // ListSupported returns list of supported distro, version, architecture combinations
@@ -79,49 +252,344 @@ func (p *Packages) ListSupported() []string {
 	return p.supported
 }
 
+// Platforms returns the supported type, distro, version, architecture
+// combinations, as they are matched against (normalized) request
+// parameters, sorted
+func (p *Packages) Platforms() []Platform {
+	list := []Platform{}
+	for ostype, dists := range p.packageList {
+		for dist, versions := range dists {
+			for vers, archs := range versions {
+				for arch := range archs {
+					list = append(list, Platform{Type: ostype, Dist: dist, Vers: vers, Arch: arch})
+				}
+			}
+		}
+	}
+	// version ranges are listed as configured
+	for ostype, dists := range p.ranges {
+		for dist, ranges := range dists {
+			for _, r := range ranges {
+				for arch := range r.archs {
+					list = append(list, Platform{Type: ostype, Dist: dist, Vers: r.vers, Arch: arch})
+				}
+			}
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+
+	return list
+}
+
+// SupportedPlatforms returns a record for every package of every supported
+// type, distro, version, architecture combination (as Platforms), with the
+// package kind, agent version, release channel and lifecycle status, sorted
+// by platform then in the order packages are matched
+func (p *Packages) SupportedPlatforms() []PlatformInfo {
+	list := []PlatformInfo{}
+	add := func(plat Platform, pkgs []PackageInfo) {
+		for _, pi := range pkgs {
+			pi.setLifecycle(plat.Dist, plat.Vers)
+			list = append(list, PlatformInfo{
+				Platform:     plat,
+				PackageKind:  packageKind(pi),
+				AgentVersion: pi.AgentVersion,
+				Channel:      pi.Channel,
+				Status:       pi.Status,
+				EOL:          pi.EOL,
+				Warning:      pi.Warning,
+			})
+		}
+	}
+	for ostype, dists := range p.packageList {
+		for dist, versions := range dists {
+			for vers, archs := range versions {
+				for sysarch, pkgs := range archs {
+					add(Platform{Type: ostype, Dist: dist, Vers: vers, Arch: sysarch}, pkgs)
+				}
+			}
+		}
+	}
+	for ostype, dists := range p.ranges {
+		for dist, ranges := range dists {
+			for _, r := range ranges {
+				for sysarch, pkgs := range r.archs {
+					add(Platform{Type: ostype, Dist: dist, Vers: r.vers, Arch: sysarch}, pkgs)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Platform.String() < list[j].Platform.String() })
+
+	return list
+}
+
+// packageKind returns the package_type of a package or, if not configured,
+// the kind of package the file extension indicates (the extension if it is
+// not a known kind), KindIPS for a package name (and publisher)
+func packageKind(pi PackageInfo) string {
+	if pi.Type != "" {
+		return pi.Type
+	}
+	if pi.File == "" {
+		if pi.Name != "" {
+			return KindIPS
+		}
+		return ""
+	}
+	file := strings.ToLower(pi.File)
+	if strings.HasSuffix(file, ".tar.gz") {
+		return KindTGZ
+	}
+	switch ext := path.Ext(file); ext {
+	case ".rpm":
+		return KindRPM
+	case ".deb":
+		return KindDeb
+	case ".apk":
+		return KindAPK
+	case ".pkg", ".txz":
+		return KindFreeBSDPkg
+	case ".msi":
+		return KindMSI
+	case ".tgz":
+		return KindTGZ
+	default:
+		return strings.TrimPrefix(ext, ".")
+	}
+}
+
+// checkPackageType returns an error if a configured package_type is not a
+// known package kind
+func checkPackageType(t string) error {
+	if t == "" {
+		return nil
+	}
+	for _, k := range packageKinds {
+		if strings.ToLower(t) == k {
+			return nil
+		}
+	}
+	return errors.Errorf("invalid package_type (%s), expected one of %s", t, strings.Join(packageKinds, ", "))
+}
+
+// Files returns every package file (including canary packages) of the
+// package configuration, with its base url and sha256, sorted by file name
+func (p *Packages) Files() []PackageFile {
+	files := map[string]PackageFile{}
+	add := func(pkgs []PackageInfo) {
+		for _, pi := range pkgs {
+			p.setDefaults(&pi, "")
+			if pi.File != "" {
+				files[pi.File] = PackageFile{File: pi.File, URL: pi.URL, SHA256: pi.SHA256}
+			}
+			if pi.Canary != nil && pi.Canary.File != "" {
+				files[pi.Canary.File] = PackageFile{File: pi.Canary.File, URL: pi.Canary.URL, SHA256: pi.Canary.SHA256}
+			}
+		}
+	}
+	for _, dists := range p.packageList {
+		for _, versions := range dists {
+			for _, archs := range versions {
+				for _, pkgs := range archs {
+					add(pkgs)
+				}
+			}
+		}
+	}
+	for _, dists := range p.ranges {
+		for _, ranges := range dists {
+			for _, r := range ranges {
+				for _, pkgs := range r.archs {
+					add(pkgs)
+				}
+			}
+		}
+	}
+
+	list := make([]PackageFile, 0, len(files))
+	for _, pf := range files {
+		list = append(list, pf)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].File < list[j].File })
+
+	return list
+}
+
+// HasDistro returns true if the package configuration has entries for the
+// os type and distro
+func (p *Packages) HasDistro(ostype, distro string) bool {
+	ost := strings.ToLower(ostype)
+	dist := strings.ToLower(distro)
+	if _, ok := p.packageList[ost][dist]; ok {
+		return true
+	}
+	return len(p.ranges[ost][dist]) > 0
+}
+
 // GetPackageInfo returns package information for type, distro, version, architecture
 // combination or error indicating what is not supported
-func (p *Packages) GetPackageInfo(ostype, distro, version, arch string) (*PackageInfo, error) {
+func (p *Packages) GetPackageInfo(ostype, distro, version, sysarch string) (*PackageInfo, error) {
+	return p.SelectPackage(ostype, distro, version, sysarch, Selection{})
+}
+
+// SelectPackage returns package information for type, distro, version,
+// architecture combination and the selected channel, agent version or error
+// indicating what is not supported
+func (p *Packages) SelectPackage(ostype, distro, version, sysarch string, sel Selection) (*PackageInfo, error) {
+	if err := p.checkPlatform(ostype, distro, version, sysarch); err != nil {
+		return nil, err
+	}
+
+	dist := strings.ToLower(distro)
+
+	pi, match, err := p.findPackage(strings.ToLower(ostype), dist, version, arch.Canonical(sysarch), sel)
+	if err != nil {
+		switch err {
+		case errUnsupportedVersion:
+			return nil, errors.Errorf("unsupported %s version (v%s)", distro, version)
+		case errUnsupportedArch:
+			return nil, errors.Errorf("unsupported architecture (%s) for %s %s", sysarch, distro, version)
+		case errUnsupportedChannel:
+			channel := sel.Channel
+			if channel == "" {
+				channel = p.channel
+			}
+			return nil, errors.Errorf("unsupported channel (%s) for %s %s", channel, distro, version)
+		case errUnsupportedAgentVersion:
+			return nil, errors.Errorf("unsupported agent version (%s) for %s %s", sel.AgentVersion, distro, version)
+		}
+		return nil, err
+	}
+	match.Dist = dist
+	pi.Match = match
+	if sel.AgentVersion == "" {
+		pi = pi.rollout(sel.HostKey)
+	} else if pi.Canary != nil {
+		// pinned to the entry's agent version
+		pi.Canary = nil
+		pi.Rollout = RolloutStable
+	}
+	p.setDefaults(&pi, sel.BaseURL)
+	pi.setLifecycle(distro, version)
+
+	return &pi, nil
+}
+
+// Versions returns every package (channel, agent version) available for
+// type, distro, version, architecture combination, in the order entries are
+// matched, or error indicating what is not supported
+func (p *Packages) Versions(ostype, distro, version, sysarch string) ([]PackageInfo, error) {
+	if err := p.checkPlatform(ostype, distro, version, sysarch); err != nil {
+		return nil, err
+	}
+
+	dist := strings.ToLower(distro)
+
+	cands, versionFound := p.candidates(strings.ToLower(ostype), dist, version, arch.Canonical(sysarch))
+	if len(cands) == 0 {
+		if versionFound {
+			return nil, errors.Errorf("unsupported architecture (%s) for %s %s", sysarch, distro, version)
+		}
+		return nil, errors.Errorf("unsupported %s version (v%s)", distro, version)
+	}
+
+	list := []PackageInfo{}
+	for _, c := range cands {
+		for _, pi := range c.pkgs {
+			match := c.match
+			match.Dist = dist
+			pi.Match = &match
+			p.setDefaults(&pi, "")
+			pi.setLifecycle(distro, version)
+			list = append(list, pi)
+		}
+	}
+
+	return list, nil
+}
+
+// DefaultChannel returns the release channel used when none is selected
+func (p *Packages) DefaultChannel() string {
+	return p.channel
+}
+
+// checkPlatform verifies the type, distro, version and architecture are set
+// and the type and distro are in the package configuration
+func (p *Packages) checkPlatform(ostype, distro, version, sysarch string) error {
 	if ostype == "" {
-		return nil, errors.Errorf("invalid OS type (blank)")
+		return errors.Errorf("invalid OS type (blank)")
 	}
 	if distro == "" {
-		return nil, errors.Errorf("invalid OS distro (blank)")
+		return errors.Errorf("invalid OS distro (blank)")
 	}
 	if version == "" {
-		return nil, errors.Errorf("invalid OS distro version (blank)")
+		return errors.Errorf("invalid OS distro version (blank)")
 	}
-	if arch == "" {
-		return nil, errors.Errorf("invalid system arch (blank)")
+	if sysarch == "" {
+		return errors.Errorf("invalid system arch (blank)")
 	}
 
 	ost := strings.ToLower(ostype)
 	dist := strings.ToLower(distro)
 
-	if _, ok := p.packageList[ost]; !ok {
-		return nil, errors.Errorf("unsupported OS Type (%s)", ostype)
+	if _, ok := p.packageList[ost]; !ok && len(p.ranges[ost]) == 0 {
+		return errors.Errorf("unsupported OS Type (%s)", ostype)
 	}
-	if _, ok := p.packageList[ost][dist]; !ok {
-		return nil, errors.Errorf("unsupported OS Distro (%s)", distro)
-	}
-	if _, ok := p.packageList[ost][dist][version]; !ok {
-		return nil, errors.Errorf("unsupported %s version (v%s)", distro, version)
+	if !p.HasDistro(ost, dist) {
+		return errors.Errorf("unsupported OS Distro (%s)", distro)
 	}
 
-	pi, ok := p.packageList[ost][dist][version][arch]
-	if !ok {
-		return nil, errors.Errorf("unsupported architecture (%s) for %s %s", arch, distro, version)
-	}
+	return nil
+}
 
+// setDefaults sets the package (and canary package) url, baseURL (or the
+// default base url, if blank) if the entry has none, sha256, the local
+// package file checksum if the entry has none, and package type, from the
+// package file if the entry has none
+func (p *Packages) setDefaults(pi *PackageInfo, baseURL string) {
+	pi.Type = packageKind(*pi)
 	if pi.File != "" {
 		if pi.URL == "" {
-			pi.URL = viper.GetString(config.KeyPackageBaseURL)
+			pi.URL = baseURL
 		}
-		pi.URL = strings.Replace(pi.URL, pi.File, "", -1)
-		pathSep := "/"
-		if !strings.HasSuffix(pi.URL, pathSep) {
-			pi.URL += pathSep
+		pi.URL = packageURL(pi.URL, pi.File)
+		if pi.SHA256 == "" {
+			pi.SHA256 = p.checksums[pi.File]
 		}
 	}
-	return &pi, nil
+	if pi.Canary != nil && pi.Canary.File != "" {
+		c := *pi.Canary
+		c.Type = packageKind(PackageInfo{File: c.File, Name: c.Name, Type: c.Type})
+		if c.URL == "" {
+			c.URL = baseURL
+		}
+		c.URL = packageURL(c.URL, c.File)
+		if c.SHA256 == "" {
+			c.SHA256 = p.checksums[c.File]
+		}
+		pi.Canary = &c
+	}
+}
+
+// SetChecksums sets the sha256 checksums (by file name) of local package
+// files, used for entries without a sha256. It must be called before the
+// package list is used.
+func (p *Packages) SetChecksums(sums map[string]string) {
+	p.checksums = sums
+}
+
+// packageURL returns the base url for a package file
+func packageURL(u, file string) string {
+	if u == "" {
+		u = viper.GetString(config.KeyPackageBaseURL)
+	}
+	u = strings.Replace(u, file, "", -1)
+	pathSep := "/"
+	if !strings.HasSuffix(u, pathSep) {
+		u += pathSep
+	}
+	return u
 }
@@ -6,6 +6,7 @@
 package packages
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/circonus-labs/cosi-server/internal/config"
@@ -89,6 +90,26 @@ func TestListSupported(t *testing.T) {
 	}
 }
 
+func TestPlatforms(t *testing.T) {
+	t.Log("Testing Platforms")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	{
+		viper.Set(config.KeyPackageConfigFile, "testdata/valid.yaml")
+		p, err := New("")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		list := p.Platforms()
+		if len(list) != 1 {
+			t.Fatalf("expected 1 platform, got %d", len(list))
+		}
+		if list[0].String() != "linux/ubuntu/16.04/x86_64" {
+			t.Fatalf("unexpected platform (%s)", list[0])
+		}
+	}
+}
+
 func TestGetPackageInfo(t *testing.T) {
 	t.Log("Testing GetPackageInfo")
 	zerolog.SetGlobalLevel(zerolog.Disabled)
@@ -133,3 +154,464 @@ func TestGetPackageInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPackageInfoRanges(t *testing.T) {
+	t.Log("Testing GetPackageInfo (ranges, fallback)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p, err := New("testdata/ranges.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		dist   string
+		vers   string
+		arch   string
+		rule   string
+		mvers  string
+		errMsg string
+	}{
+		{"exact", "Ubuntu", "18.04", "x86_64", MatchExact, "18.04", ""},
+		{"range", "Ubuntu", "16.10", "x86_64", MatchRange, ">=16.04 <18.04", ""},
+		{"range lower bound", "Ubuntu", "16.04", "x86_64", MatchRange, ">=16.04 <18.04", ""},
+		{"range wildcard", "Debian", "9.13", "x86_64", MatchRange, "9.x", ""},
+		{"nearest lower", "Ubuntu", "20.04", "x86_64", MatchNearestLower, "18.04", ""},
+		{"nearest lower, below range", "Ubuntu", "15.10", "x86_64", MatchNearestLower, "14.04", ""},
+		{"no fallback policy", "Debian", "10", "x86_64", "", "", "unsupported Debian version (v10)"},
+		{"nothing lower", "Ubuntu", "12.04", "x86_64", "", "", "unsupported Ubuntu version (v12.04)"},
+		{"range, unsupported arch", "Ubuntu", "17.10", "i386", "", "", "unsupported architecture (i386)"},
+		{"not semver", "Ubuntu", "foo", "x86_64", "", "", "unsupported Ubuntu version (vfoo)"},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+		pi, err := p.GetPackageInfo("Linux", test.dist, test.vers, test.arch)
+		if test.errMsg != "" {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), test.errMsg) {
+				t.Fatalf("expected (%s) got (%s)", test.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.Match == nil || pi.Match.Rule != test.rule || pi.Match.Vers != test.mvers {
+			t.Fatalf("expected %s (%s), got %#v", test.rule, test.mvers, pi.Match)
+		}
+	}
+
+	t.Log("\tplatforms include ranges")
+	{
+		found := false
+		for _, plat := range p.Platforms() {
+			if plat.Vers == "9.x" {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected 9.x in %v", p.Platforms())
+		}
+	}
+}
+
+func TestGetPackageInfoArch(t *testing.T) {
+	t.Log("Testing GetPackageInfo (architecture aliases)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p, err := New("testdata/arch.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		dist   string
+		vers   string
+		arch   string
+		expect string
+	}{
+		{"Ubuntu", "20.04", "x86_64", "circonus-agent-1.0.0-1.ubuntu.20.04_amd64.deb"},
+		{"Ubuntu", "20.04", "amd64", "circonus-agent-1.0.0-1.ubuntu.20.04_amd64.deb"},
+		{"Ubuntu", "20.04", "aarch64", "circonus-agent-1.0.0-1.ubuntu.20.04_arm64.deb"},
+		{"Ubuntu", "20.04", "armv7l", "circonus-agent-1.0.0-1.ubuntu.20.04_armhf.deb"},
+		{"CentOS", "8", "arm64", "circonus-agent-1.0.0-1.el8.aarch64.rpm"},
+		{"CentOS", "8", "ppc64le", "circonus-agent-1.0.0-1.el8.ppc64le.rpm"},
+		{"CentOS", "8", "s390x", ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s %s", tst.dist, tst.vers, tst.arch)
+		pi, err := p.GetPackageInfo("Linux", tst.dist, tst.vers, tst.arch)
+		if tst.expect == "" {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), "unsupported architecture ("+tst.arch+")") {
+				t.Fatalf("unexpected error %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.File != tst.expect {
+			t.Fatalf("expected %s, got %s", tst.expect, pi.File)
+		}
+	}
+}
+
+func TestSelectPackage(t *testing.T) {
+	t.Log("Testing SelectPackage")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageChannel, "")
+	defer viper.Set(config.KeyPackageChannel, nil)
+
+	p, err := New("testdata/channels.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if p.DefaultChannel() != ChannelStable {
+		t.Fatalf("expected default channel %s, got %s", ChannelStable, p.DefaultChannel())
+	}
+
+	tt := []struct {
+		name   string
+		vers   string
+		sel    Selection
+		expect string // agent version or error
+		match  string
+	}{
+		{"default channel, latest", "18.04", Selection{}, "1.1.0", MatchExact},
+		{"channel", "18.04", Selection{Channel: "Beta"}, "1.2.0-beta.1", MatchExact},
+		{"channel from range", "18.04", Selection{Channel: ChannelLTS}, "0.9.5", MatchRange},
+		{"agent version, any channel", "18.04", Selection{AgentVersion: "v1.2.0-beta.1"}, "1.2.0-beta.1", MatchExact},
+		{"agent version in channel", "18.04", Selection{Channel: ChannelStable, AgentVersion: "1.0.0"}, "1.0.0", MatchExact},
+		{"agent version not in channel", "18.04", Selection{Channel: ChannelBeta, AgentVersion: "1.0.0"}, "unsupported agent version (1.0.0) for Ubuntu 18.04", ""},
+		{"unknown agent version", "18.04", Selection{AgentVersion: "2.0.0"}, "unsupported agent version (2.0.0)", ""},
+		{"unknown channel", "18.04", Selection{Channel: "nightly"}, "unsupported channel (nightly) for Ubuntu 18.04", ""},
+		{"default channel not available", "16.04", Selection{}, "unsupported channel (stable) for Ubuntu 16.04", ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.name)
+		pi, err := p.SelectPackage("Linux", "Ubuntu", tst.vers, "x86_64", tst.sel)
+		if tst.match == "" {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tst.expect) {
+				t.Fatalf("expected (%s) got (%s)", tst.expect, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.AgentVersion != tst.expect || pi.Match.Rule != tst.match {
+			t.Fatalf("expected %s (%s), got %s (%s)", tst.expect, tst.match, pi.AgentVersion, pi.Match.Rule)
+		}
+	}
+
+	t.Log("\tconfigured default channel")
+	{
+		viper.Set(config.KeyPackageChannel, "LTS")
+		p, err := New("testdata/channels.yaml")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		pi, err := p.GetPackageInfo("Linux", "Ubuntu", "16.04", "x86_64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.Channel != ChannelLTS || pi.AgentVersion != "0.9.5" {
+			t.Fatalf("unexpected package %#v", pi)
+		}
+		// entries without a channel are in the default channel
+		pi, err = p.GetPackageInfo("Linux", "Ubuntu", "18.04", "x86_64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.AgentVersion != "1.0.0" {
+			t.Fatalf("expected 1.0.0, got %#v", pi)
+		}
+	}
+}
+
+func TestVersions(t *testing.T) {
+	t.Log("Testing Versions")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p, err := New("testdata/channels.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\tunsupported")
+	{
+		if _, err := p.Versions("Linux", "Ubuntu", "14.04", "x86_64"); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := p.Versions("Linux", "Ubuntu", "18.04", "aarch64"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tall channels")
+	{
+		list, err := p.Versions("Linux", "Ubuntu", "18.04", "amd64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		got := []string{}
+		for _, pi := range list {
+			got = append(got, pi.Channel+"/"+pi.AgentVersion+"/"+pi.Match.Rule)
+			if pi.URL == "" {
+				t.Fatalf("expected package url, got %#v", pi)
+			}
+		}
+		expect := "stable/1.0.0/exact stable/1.1.0/exact beta/1.2.0-beta.1/exact lts/0.9.5/range"
+		if strings.Join(got, " ") != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, strings.Join(got, " "))
+		}
+	}
+}
+
+func TestGetPackageInfoIntegrity(t *testing.T) {
+	t.Log("Testing GetPackageInfo (integrity)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p, err := New("testdata/integrity.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	configured := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	local := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	t.Log("\tconfigured")
+	{
+		pi, err := p.GetPackageInfo("Linux", "Ubuntu", "18.04", "x86_64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.SHA256 != configured || pi.SignatureURL == "" {
+			t.Fatalf("unexpected integrity %#v", pi)
+		}
+		pi, err = p.GetPackageInfo("Linux", "Ubuntu", "20.04", "x86_64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.SHA256 != "" || pi.SignatureURL != "" {
+			t.Fatalf("unexpected integrity %#v", pi)
+		}
+	}
+
+	t.Log("\tlocal checksums")
+	{
+		p.SetChecksums(map[string]string{
+			"circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb": local,
+			"circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb": local,
+		})
+		pi, err := p.GetPackageInfo("Linux", "Ubuntu", "18.04", "x86_64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.SHA256 != configured {
+			t.Fatalf("expected configured sha256, got %s", pi.SHA256)
+		}
+		pi, err = p.GetPackageInfo("Linux", "Ubuntu", "20.04", "x86_64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.SHA256 != local {
+			t.Fatalf("expected local sha256, got %s", pi.SHA256)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	t.Log("Testing Files")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageBaseURL, "http://updates.example.com/packages")
+	defer viper.Set(config.KeyPackageBaseURL, nil)
+
+	p, err := New("testdata/canary.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	got := []string{}
+	for _, pf := range p.Files() {
+		got = append(got, pf.URL+pf.File)
+	}
+	expect := strings.Join([]string{
+		"http://updates.example.com/packages/circonus-agent-1.0.0-1.el7.x86_64.rpm",
+		"http://updates.example.com/packages/circonus-agent-1.0.0-1.el8.x86_64.rpm",
+		"http://updates.example.com/packages/circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb",
+		"http://updates.example.com/packages/circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb",
+		"http://example.com/canary/circonus-agent-1.1.0-1.el8.x86_64.rpm",
+		"http://updates.example.com/packages/circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb",
+		"http://updates.example.com/packages/circonus-agent-1.1.0-1.ubuntu.20.04_x86_64.deb",
+	}, "\n")
+	if strings.Join(got, "\n") != expect {
+		t.Fatalf("expected\n%s\ngot\n%s", expect, strings.Join(got, "\n"))
+	}
+}
+
+func TestSupportedPlatforms(t *testing.T) {
+	t.Log("Testing SupportedPlatforms")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageChannel, "stable")
+	defer viper.Set(config.KeyPackageChannel, nil)
+
+	p, err := New("testdata/channels.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	got := []string{}
+	for _, pi := range p.SupportedPlatforms() {
+		got = append(got, strings.Join([]string{pi.Platform.String(), pi.PackageKind, pi.Channel, pi.AgentVersion, pi.Status}, " "))
+	}
+	expect := strings.Join([]string{
+		"linux/ubuntu/18.04/x86_64 deb stable 1.0.0 supported",
+		"linux/ubuntu/18.04/x86_64 deb stable 1.1.0 supported",
+		"linux/ubuntu/18.04/x86_64 deb beta 1.2.0-beta.1 supported",
+		"linux/ubuntu/>=16.04/x86_64 deb lts 0.9.5 supported",
+	}, "\n")
+	if strings.Join(got, "\n") != expect {
+		t.Fatalf("expected\n%s\ngot\n%s", expect, strings.Join(got, "\n"))
+	}
+}
+
+func TestPackageKind(t *testing.T) {
+	t.Log("Testing packageKind")
+
+	tt := []struct {
+		pi   PackageInfo
+		kind string
+	}{
+		{PackageInfo{File: "circonus-agent-1.0.0-1.el7.x86_64.rpm"}, KindRPM},
+		{PackageInfo{File: "circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.DEB"}, KindDeb},
+		{PackageInfo{File: "circonus-agent-1.0.0-1.freebsd.12.1_amd64.tgz"}, KindTGZ},
+		{PackageInfo{File: "circonus-agent_1.0.0_linux_x86_64.tar.gz"}, KindTGZ},
+		{PackageInfo{File: "circonus-agent-1.0.0-r0.apk"}, KindAPK},
+		{PackageInfo{File: "circonus-agent-1.0.0.pkg"}, KindFreeBSDPkg},
+		{PackageInfo{File: "circonus-agent-1.0.0.txz"}, KindFreeBSDPkg},
+		{PackageInfo{File: "circonus-agent-1.0.0-x64.msi"}, KindMSI},
+		{PackageInfo{File: "circonus-agent-1.0.0.zip"}, "zip"},
+		{PackageInfo{File: "circonus-agent-1.0.0.zip", Type: KindTGZ}, KindTGZ},
+		{PackageInfo{Name: "field/nad", PubName: "circonus"}, KindIPS},
+		{PackageInfo{}, ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s%s", tst.pi.File, tst.pi.Name)
+		if kind := packageKind(tst.pi); kind != tst.kind {
+			t.Fatalf("expected '%s', got '%s'", tst.kind, kind)
+		}
+	}
+}
+
+func TestCheckPackageType(t *testing.T) {
+	t.Log("Testing checkPackageType")
+
+	tt := []struct {
+		typ        string
+		shouldFail bool
+	}{
+		{"", false},
+		{"rpm", false},
+		{"FreeBSD-Pkg", false},
+		{"msi", false},
+		{"zip", true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("	'%s'", tst.typ)
+		err := checkPackageType(tst.typ)
+		if tst.shouldFail && err == nil {
+			t.Fatal("expected error")
+		}
+		if !tst.shouldFail && err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+	}
+}
+
+func TestSelectPackageType(t *testing.T) {
+	t.Log("Testing SelectPackage (package type)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	p, err := New("testdata/package_types.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		ostype string
+		dist   string
+		vers   string
+		arch   string
+		kind   string
+	}{
+		{"windows", "windows", "10.0.17763", "amd64", KindMSI},
+		{"freebsd", "freebsd", "12.1", "amd64", KindFreeBSDPkg},
+		{"linux", "alpine", "3.12", "x86_64", KindAPK},
+		{"linux", "ubuntu", "18.04", "x86_64", KindTGZ},
+		{"linux", "ubuntu", "20.04", "x86_64", KindDeb}, // invalid package_type ignored
+		{"solaris", "omnios", "151014", "x86_64", KindIPS},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s %s %s", tst.ostype, tst.dist, tst.vers, tst.arch)
+		pi, err := p.SelectPackage(tst.ostype, tst.dist, tst.vers, tst.arch, Selection{})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.Type != tst.kind {
+			t.Fatalf("expected '%s', got '%s'", tst.kind, pi.Type)
+		}
+	}
+}
+
+func TestSelectPackageBaseURL(t *testing.T) {
+	t.Log("Testing SelectPackage (base url)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageBaseURL, "http://updates.example.com/packages")
+	defer viper.Set(config.KeyPackageBaseURL, nil)
+
+	p, err := New("testdata/canary.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		desc string
+		sel  Selection
+		url  string
+	}{
+		{"default", Selection{}, "http://updates.example.com/packages/"},
+		{"mirror", Selection{BaseURL: "http://mirror.example.com/packages"}, "http://mirror.example.com/packages/"},
+		{"entry url", Selection{BaseURL: "http://mirror.example.com/packages/", HostKey: "host"}, "http://example.com/canary/"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+		pi, err := p.SelectPackage("linux", "centos", "8", "x86_64", tst.sel)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if pi.URL != tst.url {
+			t.Fatalf("expected '%s', got '%s'", tst.url, pi.URL)
+		}
+	}
+}
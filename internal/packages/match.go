@@ -0,0 +1,211 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+var (
+	errUnsupportedVersion      = errors.New("unsupported version")
+	errUnsupportedArch         = errors.New("unsupported architecture")
+	errUnsupportedChannel      = errors.New("unsupported channel")
+	errUnsupportedAgentVersion = errors.New("unsupported agent version")
+)
+
+// isVersionRange returns true if a package configuration vers is a semver
+// constraint (e.g. ">=16.04 <18.04", "9.x", "~7") rather than a version
+func isVersionRange(vers string) bool {
+	if strings.ContainsAny(vers, "<>=!~^*|, ") {
+		return true
+	}
+	for _, part := range strings.Split(vers, ".") {
+		if part == "x" || part == "X" {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeAndRx matches whitespace separating the terms of a constraint, the
+// semver package requires a comma (e.g. ">=16.04 <18.04" is ">=16.04, <18.04")
+var rangeAndRx = regexp.MustCompile(`([0-9xX*])\s+([<>=!~^])`)
+
+// parseVersionRange parses a package configuration vers constraint
+func parseVersionRange(vers string) (*semver.Constraints, error) {
+	return semver.NewConstraint(rangeAndRx.ReplaceAllString(vers, "$1, $2"))
+}
+
+// candidate is a package configuration entry matching a version, the
+// packages (one per channel, agent version) for the arch
+type candidate struct {
+	match Match
+	pkgs  []PackageInfo
+}
+
+// candidates returns the entries with packages for arch matching a (lower
+// cased) type, distro and version, in rule order: an exact version entry, the
+// version range entries (in configuration order) and, only if no entry
+// matched the version and the distro has the policy, the lower version
+// entries, nearest first. versionFound is true if any entry matched the
+// version, with or without packages for arch.
+func (p *Packages) candidates(ost, dist, version, arch string) ([]candidate, bool) {
+	cands := []candidate{}
+	versionFound := false
+
+	if archs, ok := p.packageList[ost][dist][version]; ok {
+		versionFound = true
+		if pkgs, ok := archs[arch]; ok {
+			cands = append(cands, candidate{match: Match{Rule: MatchExact, Vers: version}, pkgs: pkgs})
+		}
+	}
+
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		// only exact entries can match a version which is not semver-like
+		return cands, versionFound
+	}
+
+	for _, r := range p.ranges[ost][dist] {
+		if !r.constraint.Check(v) {
+			continue
+		}
+		versionFound = true
+		if pkgs, ok := r.archs[arch]; ok {
+			cands = append(cands, candidate{match: Match{Rule: MatchRange, Vers: r.vers}, pkgs: pkgs})
+		}
+	}
+
+	if !versionFound && p.fallback[ost][dist] == FallbackNearestLower {
+		cands = append(cands, p.lowerVersions(ost, dist, v, arch)...)
+	}
+
+	return cands, versionFound
+}
+
+// findPackage returns the package for a (lower cased) type, distro and the
+// version, arch and selection (channel, agent version) from the first
+// candidate entry with a package for the selection.
+func (p *Packages) findPackage(ost, dist, version, arch string, sel Selection) (PackageInfo, *Match, error) {
+	cands, versionFound := p.candidates(ost, dist, version, arch)
+
+	var selErr error
+	for _, c := range cands {
+		pi, err := p.selectPackage(c.pkgs, sel)
+		if err != nil {
+			if selErr == nil {
+				selErr = err
+			}
+			continue
+		}
+		match := c.match
+		return pi, &match, nil
+	}
+
+	switch {
+	case selErr != nil:
+		return PackageInfo{}, nil, selErr
+	case versionFound:
+		return PackageInfo{}, nil, errUnsupportedArch
+	}
+
+	return PackageInfo{}, nil, errUnsupportedVersion
+}
+
+// lowerVersions returns the exact version entries, lower than v, with
+// packages for arch, nearest first
+func (p *Packages) lowerVersions(ost, dist string, v *semver.Version, arch string) []candidate {
+	type lower struct {
+		v *semver.Version
+		c candidate
+	}
+	list := []lower{}
+
+	for vers, archs := range p.packageList[ost][dist] {
+		pkgs, ok := archs[arch]
+		if !ok {
+			continue
+		}
+		ev, err := semver.NewVersion(vers)
+		if err != nil || !ev.LessThan(v) {
+			continue
+		}
+		list = append(list, lower{v: ev, c: candidate{match: Match{Rule: MatchNearestLower, Vers: vers}, pkgs: pkgs}})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].v.GreaterThan(list[j].v) })
+
+	cands := make([]candidate, 0, len(list))
+	for _, l := range list {
+		cands = append(cands, l.c)
+	}
+	return cands
+}
+
+// selectPackage returns the package for a selection from the packages of an
+// entry. With an agent version, the package for that version (in the
+// channel, if one is selected); otherwise the latest agent version in the
+// channel (the default channel if none is selected).
+func (p *Packages) selectPackage(pkgs []PackageInfo, sel Selection) (PackageInfo, error) {
+	channel := strings.ToLower(sel.Channel)
+	if channel == "" && sel.AgentVersion == "" {
+		channel = p.channel
+	}
+	agentVersion := strings.TrimPrefix(sel.AgentVersion, "v")
+
+	var (
+		best  PackageInfo
+		found bool
+		inCh  bool // any package in the channel
+	)
+
+	for _, pi := range pkgs {
+		if channel != "" && pi.Channel != channel {
+			continue
+		}
+		inCh = true
+		if agentVersion != "" {
+			if strings.TrimPrefix(pi.AgentVersion, "v") == agentVersion {
+				return pi, nil
+			}
+			if pi.Canary != nil && strings.TrimPrefix(pi.Canary.AgentVersion, "v") == agentVersion {
+				return pi.canaryPackage(), nil
+			}
+			continue
+		}
+		if !found || newerAgent(pi.AgentVersion, best.AgentVersion) {
+			best, found = pi, true
+		}
+	}
+
+	switch {
+	case found:
+		return best, nil
+	case inCh:
+		return PackageInfo{}, errUnsupportedAgentVersion
+	}
+
+	return PackageInfo{}, errUnsupportedChannel
+}
+
+// newerAgent returns true if agent version a is newer than b, versions which
+// are not semver are older than any version which is
+func newerAgent(a, b string) bool {
+	av, err := semver.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	bv, err := semver.NewVersion(b)
+	if err != nil {
+		return true
+	}
+	return av.GreaterThan(bv)
+}
@@ -0,0 +1,54 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package packages
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+)
+
+func TestVersionRange(t *testing.T) {
+	t.Log("Testing isVersionRange/parseVersionRange")
+
+	tests := []struct {
+		vers    string
+		isRange bool
+		match   string
+		noMatch string
+	}{
+		{"16.04", false, "", ""},
+		{"7", false, "", ""},
+		{"151014", false, "", ""},
+		{"9.x", true, "9.13", "10"},
+		{"9.X", true, "9.1", "8.11"},
+		{">=16.04 <18.04", true, "17.10", "18.04"},
+		{">= 16.04 < 18.04", true, "16.04", "14.04"},
+		{">=16.04, <18.04", true, "16.10", "18.10"},
+		{"~7", true, "7.6", "8"},
+		{"8 || >=10", true, "10.2", "9"},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.vers)
+		if isVersionRange(test.vers) != test.isRange {
+			t.Fatalf("expected range %v", test.isRange)
+		}
+		if !test.isRange {
+			continue
+		}
+		c, err := parseVersionRange(test.vers)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !c.Check(semver.MustParse(test.match)) {
+			t.Fatalf("expected %s to match", test.match)
+		}
+		if c.Check(semver.MustParse(test.noMatch)) {
+			t.Fatalf("expected %s NOT to match", test.noMatch)
+		}
+	}
+}
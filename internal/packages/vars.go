@@ -5,29 +5,198 @@
 
 package packages
 
+import "github.com/Masterminds/semver"
+
 // Packages defines the list of supported distro, version, architecture combinations
 // and the agent package details
 type Packages struct {
 	supported   []string
 	packageList packageList
+	ranges      rangeList
+	fallback    map[string]map[string]string // version fallback policy by type, distro
+	channel     string                       // default release channel
+	checksums   map[string]string            // sha256 of local package files, by file name
+	conflicts   []Conflict                   // entries overridden by a later package configuration directory file
 }
 
 // PackageInfo defines the package to use for the specific distro, version, architecture combination
 type PackageInfo struct {
-	URL     string `json:"package_url,omitempty" yaml:"package_url" toml:"package_url"`
-	File    string `json:"package_file,omitempty" yaml:"package_file" toml:"package_file"`
-	PubURL  string `json:"publisher_url,omitempty" yaml:"publisher_url" toml:"publisher_url"`
-	PubName string `json:"publisher_name,omitempty" yaml:"publisher_name" toml:"publisher_name"`
-	Name    string `json:"package_name,omitempty" yaml:"package_name" toml:"package_name"`
+	URL     string `json:"package_url,omitempty" yaml:"package_url,omitempty" toml:"package_url"`
+	File    string `json:"package_file,omitempty" yaml:"package_file,omitempty" toml:"package_file"`
+	PubURL  string `json:"publisher_url,omitempty" yaml:"publisher_url,omitempty" toml:"publisher_url"`
+	PubName string `json:"publisher_name,omitempty" yaml:"publisher_name,omitempty" toml:"publisher_name"`
+	Name    string `json:"package_name,omitempty" yaml:"package_name,omitempty" toml:"package_name"`
+	// package kind (e.g. rpm, msi), from the package file extension if not configured
+	Type string `json:"package_type,omitempty" yaml:"package_type,omitempty" toml:"package_type"`
+	// integrity, the sha256 is computed for local packages if not configured
+	SHA256       string `json:"sha256,omitempty" yaml:"sha256,omitempty" toml:"sha256"`
+	SignatureURL string `json:"signature_url,omitempty" yaml:"signature_url,omitempty" toml:"signature_url"`
+	Match        *Match `json:"match,omitempty" yaml:"-" toml:"-"`
+	// set from the package configuration entry
+	Channel      string  `json:"channel,omitempty" yaml:"-" toml:"-"`
+	AgentVersion string  `json:"agent_version,omitempty" yaml:"-" toml:"-"`
+	Canary       *Canary `json:"canary,omitempty" yaml:"-" toml:"-"`
+	Rollout      string  `json:"rollout,omitempty" yaml:"-" toml:"-"` // RolloutStable or RolloutCanary, if the entry has a canary
+	// set when local package repositories are generated
+	Repo *Repo `json:"repo,omitempty" yaml:"-" toml:"-"`
+	// platform lifecycle, set from the package configuration entry, status
+	// is the effective status (e.g. eol once past the eol date)
+	Status  string `json:"status,omitempty" yaml:"-" toml:"-"`
+	EOL     string `json:"eol,omitempty" yaml:"-" toml:"-"`
+	Message string `json:"-" yaml:"-" toml:"-"`
+	Warning string `json:"warning,omitempty" yaml:"-" toml:"-"` // for platforms which are not supported
+	// provenance, the package configuration file of the entry and the files
+	// of a package configuration directory whose entries it overrides
+	Source    string   `json:"-" yaml:"-" toml:"-"`
+	Overrides []string `json:"-" yaml:"-" toml:"-"`
+}
+
+// Repo is the yum or apt repository containing a local package
+type Repo struct {
+	Type string `json:"type"` // yum or apt
+	URL  string `json:"url"`  // yum baseurl, apt repository url (suite stable, component main)
+}
+
+// PlatformInfo is a supported platform and one of its packages
+type PlatformInfo struct {
+	Platform
+	PackageKind  string `json:"package_kind"` // package_type of the package, e.g. KindRPM, or the package file extension
+	AgentVersion string `json:"agent_version,omitempty"`
+	Channel      string `json:"channel"`
+	Status       string `json:"status"` // lifecycle status
+	EOL          string `json:"eol,omitempty"`
+	Warning      string `json:"warning,omitempty"`
+}
+
+// Package kinds, the package_type of a package
+const (
+	KindRPM        = "rpm"
+	KindDeb        = "deb"
+	KindIPS        = "ips" // pkg based (solaris), package name and publisher
+	KindAPK        = "apk"
+	KindFreeBSDPkg = "freebsd-pkg"
+	KindMSI        = "msi"
+	KindTGZ        = "tgz" // tarball, extracted in /
+)
+
+// packageKinds are the valid package_type values
+var packageKinds = []string{KindRPM, KindDeb, KindIPS, KindAPK, KindFreeBSDPkg, KindMSI, KindTGZ}
+
+// Lifecycle status of a platform, set with status on an entry. Deprecated
+// and eol platforms are served with a warning, blocked platforms are not
+// served.
+const (
+	StatusSupported  = "supported"
+	StatusDeprecated = "deprecated"
+	StatusEOL        = "eol"
+	StatusBlocked    = "blocked"
+)
+
+// PackageFile is a package file of the package configuration
+type PackageFile struct {
+	File   string
+	URL    string // base url
+	SHA256 string // configured or local package file checksum, if any
+}
+
+// Canary is a package served, in place of the entry's package, to a
+// percentage of hosts
+type Canary struct {
+	URL          string `json:"package_url,omitempty" yaml:"package_url,omitempty" toml:"package_url"`
+	File         string `json:"package_file,omitempty" yaml:"package_file,omitempty" toml:"package_file"`
+	PubURL       string `json:"publisher_url,omitempty" yaml:"publisher_url,omitempty" toml:"publisher_url"`
+	PubName      string `json:"publisher_name,omitempty" yaml:"publisher_name,omitempty" toml:"publisher_name"`
+	Name         string `json:"package_name,omitempty" yaml:"package_name,omitempty" toml:"package_name"`
+	Type         string `json:"package_type,omitempty" yaml:"package_type,omitempty" toml:"package_type"`
+	SHA256       string `json:"sha256,omitempty" yaml:"sha256,omitempty" toml:"sha256"`
+	SignatureURL string `json:"signature_url,omitempty" yaml:"signature_url,omitempty" toml:"signature_url"`
+	AgentVersion string `json:"agent_version,omitempty" yaml:"agent_version,omitempty" toml:"agent_version"`
+	Percent      int    `json:"percent" yaml:"percent" toml:"percent"`
+}
+
+// Canary rollout, the package a host was served
+const (
+	RolloutStable = "stable"
+	RolloutCanary = "canary"
+)
+
+// Selection selects one of the packages for a platform
+type Selection struct {
+	Channel      string // release channel, the default channel if blank (and no AgentVersion)
+	AgentVersion string // pinned agent version, in any channel if Channel is blank
+	HostKey      string // host identifier (e.g. host id, ip) for canary rollout
+	BaseURL      string // base url of packages without a package_url (e.g. a region mirror), package_base_url if blank
+}
+
+// Release channels, entries without a channel are in the default channel
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+	ChannelLTS    = "lts"
+)
+
+// Match identifies the package configuration rule a request matched
+type Match struct {
+	Dist string `json:"dist"` // distro of the entry matched (e.g. the alias of the requested distro)
+	Rule string `json:"rule"` // MatchExact, MatchRange or MatchNearestLower
+	Vers string `json:"vers"` // vers of the entry matched, e.g. 16.04 or ">=16.04 <18.04"
+}
+
+// String returns the match as rule (vers)
+func (m Match) String() string {
+	return m.Rule + " (" + m.Vers + ")"
+}
+
+// Package configuration rules
+const (
+	MatchExact        = "exact"         // vers is the requested version
+	MatchRange        = "range"         // vers is a constraint satisfied by the requested version
+	MatchNearestLower = "nearest_lower" // vers is the nearest lower version (fallback policy)
+)
+
+// Version fallback policies, set with fallback on any entry for a distro
+const (
+	FallbackNone         = ""
+	FallbackNearestLower = "nearest_lower"
+)
+
+// Platform identifies a supported os type, distro, version, architecture combination
+type Platform struct {
+	Type string `json:"type"`
+	Dist string `json:"dist"`
+	Vers string `json:"vers"`
+	Arch string `json:"arch"`
+}
+
+// String returns the platform as type/dist/vers/arch
+func (p Platform) String() string {
+	return p.Type + "/" + p.Dist + "/" + p.Vers + "/" + p.Arch
 }
 
 type osDetail struct {
-	Distro      string      `json:"dist" yaml:"dist" toml:"dist"`
-	Version     string      `json:"vers" yaml:"vers" toml:"vers"`
-	OSType      string      `json:"type" yaml:"type" toml:"type"`
-	Arch        string      `json:"arch" yaml:"arch" toml:"arch"`
-	PackageInfo PackageInfo `json:"package_info" yaml:"package_info" toml:"package_info"`
+	Distro       string      `json:"dist" yaml:"dist" toml:"dist"`
+	Version      string      `json:"vers" yaml:"vers" toml:"vers"`
+	OSType       string      `json:"type" yaml:"type" toml:"type"`
+	Arch         string      `json:"arch" yaml:"arch" toml:"arch"`
+	Fallback     string      `json:"fallback" yaml:"fallback,omitempty" toml:"fallback"`
+	Channel      string      `json:"channel" yaml:"channel,omitempty" toml:"channel"`
+	AgentVersion string      `json:"agent_version" yaml:"agent_version,omitempty" toml:"agent_version"`
+	PackageInfo  PackageInfo `json:"package_info" yaml:"package_info" toml:"package_info"`
+	Canary       *Canary     `json:"canary" yaml:"canary,omitempty" toml:"canary"`
+	Status       string      `json:"status" yaml:"status,omitempty" toml:"status"` // lifecycle status, StatusSupported if blank
+	EOL          string      `json:"eol" yaml:"eol,omitempty" toml:"eol"`          // end of life date, YYYY-MM-DD
+	Message      string      `json:"message" yaml:"message,omitempty" toml:"message"`
+	Source       string      `json:"-" yaml:"-" toml:"-"` // file the entry was loaded from
+	index        int         // position of the entry in its file
+}
+
+// versionRange is an entry with a semver constraint for vers (e.g. 9.x)
+type versionRange struct {
+	vers       string
+	constraint *semver.Constraints
+	archs      map[string][]PackageInfo
 }
 
 type packageConfig []osDetail
-type packageList map[string]map[string]map[string]map[string]PackageInfo
+type packageList map[string]map[string]map[string]map[string][]PackageInfo
+type rangeList map[string]map[string][]*versionRange
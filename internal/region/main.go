@@ -0,0 +1,342 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package region selects the package mirror for a host, by the region it
+// requests or the network it is in. Mirrors are health checked, a mirror
+// which is not healthy is skipped and hosts get the default package url.
+package region
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// HealthTimeout is the time allowed for a mirror health check
+var HealthTimeout = 5 * time.Second
+
+// Mirrors is the table of region mirrors
+type Mirrors struct {
+	mirrors []*mirror
+	client  *http.Client
+	logger  zerolog.Logger
+}
+
+// mirror is a region mirror and its health
+type mirror struct {
+	region    string
+	url       string
+	healthURL string
+	networks  []*net.IPNet
+	mu        sync.RWMutex
+	healthy   bool
+	checked   time.Time
+	lastErr   string
+}
+
+// Status is the health of a region mirror
+type Status struct {
+	Region  string    `json:"region"`
+	URL     string    `json:"url"`
+	Healthy bool      `json:"healthy"`
+	Checked time.Time `json:"checked,omitempty"` // zero if not checked yet
+	Error   string    `json:"error,omitempty"`   // last health check error
+}
+
+// New returns the table of region mirrors. Region names are case
+// insensitive and must be unique, networks are CIDRs or addresses. Mirrors
+// are healthy until a health check fails.
+func New(cfg []config.RegionMirror) (*Mirrors, error) {
+	m := &Mirrors{
+		mirrors: make([]*mirror, 0, len(cfg)),
+		client: &http.Client{
+			Timeout: HealthTimeout,
+			// a redirect is an answer, the mirror is up
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: log.With().Str("pkg", "region").Logger(),
+	}
+
+	seen := map[string]bool{}
+	for i, c := range cfg {
+		region := strings.ToLower(c.Region)
+		if region == "" {
+			return nil, errors.Errorf("region mirror %d: region not set", i)
+		}
+		if seen[region] {
+			return nil, errors.Errorf("region mirror %d: duplicate region (%s)", i, c.Region)
+		}
+		seen[region] = true
+
+		u, err := checkURL(c.URL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "region mirror %s: url", c.Region)
+		}
+		hu := u
+		if c.HealthURL != "" {
+			if _, err := checkURL(c.HealthURL); err != nil {
+				return nil, errors.Wrapf(err, "region mirror %s: health_url", c.Region)
+			}
+			hu = c.HealthURL
+		}
+		if !strings.HasSuffix(u, "/") {
+			u += "/"
+		}
+
+		nets := make([]*net.IPNet, 0, len(c.Networks))
+		for _, n := range c.Networks {
+			ipnet, err := parseNetwork(n)
+			if err != nil {
+				return nil, errors.Wrapf(err, "region mirror %s", c.Region)
+			}
+			nets = append(nets, ipnet)
+		}
+
+		m.mirrors = append(m.mirrors, &mirror{
+			region:    region,
+			url:       u,
+			healthURL: hu,
+			networks:  nets,
+			healthy:   true,
+		})
+	}
+
+	return m, nil
+}
+
+// Inherit copies the health state of the mirrors in prev to the mirrors of
+// the same region and health url, e.g. when the table is rebuilt on reload,
+// so a mirror known to be unhealthy is not selected until checked again.
+func (m *Mirrors) Inherit(prev *Mirrors) {
+	if prev == nil {
+		return
+	}
+	for _, mr := range m.mirrors {
+		for _, pm := range prev.mirrors {
+			if pm.region != mr.region || pm.healthURL != mr.healthURL {
+				continue
+			}
+			pm.mu.RLock()
+			healthy, checked, lastErr := pm.healthy, pm.checked, pm.lastErr
+			pm.mu.RUnlock()
+
+			mr.mu.Lock()
+			mr.healthy, mr.checked, mr.lastErr = healthy, checked, lastErr
+			mr.mu.Unlock()
+			break
+		}
+	}
+}
+
+// Select returns the region and base url of the mirror for a host, the
+// mirror of the region requested or, if none was, the mirror with the most
+// specific network containing ip. ok is false if there is no such mirror or
+// it is not healthy.
+func (m *Mirrors) Select(region string, ip net.IP) (name, baseURL string, ok bool) {
+	if region != "" {
+		region = strings.ToLower(region)
+		for _, mr := range m.mirrors {
+			if mr.region == region && mr.isHealthy() {
+				return mr.region, mr.url, true
+			}
+		}
+		return "", "", false
+	}
+
+	if ip == nil {
+		return "", "", false
+	}
+
+	var best *mirror
+	bestBits := -1
+	for _, mr := range m.mirrors {
+		if !mr.isHealthy() {
+			continue
+		}
+		for _, n := range mr.networks {
+			if !n.Contains(ip) {
+				continue
+			}
+			if bits, _ := n.Mask.Size(); bits > bestBits {
+				best = mr
+				bestBits = bits
+			}
+		}
+	}
+	if best == nil {
+		return "", "", false
+	}
+	return best.region, best.url, true
+}
+
+// Has returns true if there is a mirror for region
+func (m *Mirrors) Has(region string) bool {
+	region = strings.ToLower(region)
+	for _, mr := range m.mirrors {
+		if mr.region == region {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of mirrors
+func (m *Mirrors) Len() int {
+	return len(m.mirrors)
+}
+
+// Status returns the health of each mirror
+func (m *Mirrors) Status() []Status {
+	list := make([]Status, 0, len(m.mirrors))
+	for _, mr := range m.mirrors {
+		mr.mu.RLock()
+		list = append(list, Status{
+			Region:  mr.region,
+			URL:     mr.url,
+			Healthy: mr.healthy,
+			Checked: mr.checked,
+			Error:   mr.lastErr,
+		})
+		mr.mu.RUnlock()
+	}
+	return list
+}
+
+// Check health checks every mirror, a mirror is healthy if its health url
+// answers a HEAD request with a 2xx or 3xx status
+func (m *Mirrors) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, mr := range m.mirrors {
+		wg.Add(1)
+		go func(mr *mirror) {
+			defer wg.Done()
+			err := m.check(ctx, mr.healthURL)
+			if ctx.Err() != nil {
+				return // shutting down, not a mirror problem
+			}
+
+			mr.mu.Lock()
+			was := mr.healthy
+			mr.healthy = err == nil
+			mr.checked = time.Now()
+			mr.lastErr = ""
+			if err != nil {
+				mr.lastErr = err.Error()
+			}
+			mr.mu.Unlock()
+
+			switch {
+			case was && err != nil:
+				m.logger.Warn().Err(err).Str("region", mr.region).Str("url", mr.healthURL).Msg("mirror unhealthy, skipping")
+			case !was && err == nil:
+				m.logger.Info().Str("region", mr.region).Str("url", mr.healthURL).Msg("mirror healthy")
+			}
+		}(mr)
+	}
+	wg.Wait()
+}
+
+// Start health checks the mirrors every interval until ctx is done
+func (m *Mirrors) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || len(m.mirrors) == 0 {
+		return
+	}
+
+	m.Check(ctx)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// check requests a mirror health url
+func (m *Mirrors) check(ctx context.Context, u string) error {
+	req, err := http.NewRequest(http.MethodHead, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return errors.Errorf("health check %s (%s)", u, resp.Status)
+	}
+	return nil
+}
+
+func (mr *mirror) isHealthy() bool {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	return mr.healthy
+}
+
+// checkURL verifies a mirror url is an absolute http(s) url
+func checkURL(u string) (string, error) {
+	if u == "" {
+		return "", errors.New("not set")
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+		return "", errors.Errorf("invalid url (%s), expected http(s)://host/...", u)
+	}
+	return u, nil
+}
+
+// parseNetwork parses a CIDR or an address (a single host network)
+func parseNetwork(n string) (*net.IPNet, error) {
+	if !strings.Contains(n, "/") {
+		ip := net.ParseIP(n)
+		if ip == nil {
+			return nil, errors.Errorf("invalid network (%s)", n)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(n)
+	if err != nil {
+		return nil, errors.Errorf("invalid network (%s)", n)
+	}
+	return ipnet, nil
+}
+
+// ParseNetworks parses a list of CIDRs or addresses, e.g. trusted proxies
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, n := range list {
+		ipnet, err := parseNetwork(n)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
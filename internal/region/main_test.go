@@ -0,0 +1,242 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package region
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/rs/zerolog"
+)
+
+func TestNew(t *testing.T) {
+	t.Log("Testing New")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	tt := []struct {
+		desc      string
+		cfg       []config.RegionMirror
+		shouldErr bool
+	}{
+		{"none", []config.RegionMirror{}, false},
+		{"valid", []config.RegionMirror{{Region: "us-east", URL: "http://mirror/", Networks: []string{"192.0.2.0/24", "198.51.100.7", "2001:db8::/32"}}}, false},
+		{"health url", []config.RegionMirror{{Region: "us-east", URL: "https://mirror/packages", HealthURL: "https://mirror/health"}}, false},
+		{"no region", []config.RegionMirror{{URL: "http://mirror/"}}, true},
+		{"duplicate region", []config.RegionMirror{{Region: "us-east", URL: "http://a/"}, {Region: "US-East", URL: "http://b/"}}, true},
+		{"no url", []config.RegionMirror{{Region: "us-east"}}, true},
+		{"invalid url", []config.RegionMirror{{Region: "us-east", URL: "ftp://mirror/"}}, true},
+		{"relative url", []config.RegionMirror{{Region: "us-east", URL: "/packages/"}}, true},
+		{"invalid health url", []config.RegionMirror{{Region: "us-east", URL: "http://mirror/", HealthURL: "mirror/health"}}, true},
+		{"invalid network", []config.RegionMirror{{Region: "us-east", URL: "http://mirror/", Networks: []string{"192.0.2.0/33"}}}, true},
+		{"invalid address", []config.RegionMirror{{Region: "us-east", URL: "http://mirror/", Networks: []string{"mirror"}}}, true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+		m, err := New(tst.cfg)
+		if tst.shouldErr {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if m.Len() != len(tst.cfg) {
+			t.Fatalf("expected %d mirrors, got %d", len(tst.cfg), m.Len())
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Log("Testing Select")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	m, err := New([]config.RegionMirror{
+		{Region: "us", URL: "http://us.mirror/packages", Networks: []string{"192.0.0.0/8"}},
+		{Region: "US-East", URL: "http://us-east.mirror/packages/", Networks: []string{"192.0.2.0/24", "2001:db8::/32"}},
+		{Region: "eu-west", URL: "http://eu-west.mirror/", Networks: []string{"198.51.100.7"}},
+	})
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		desc   string
+		region string
+		ip     string
+		ok     bool
+		name   string
+		url    string
+	}{
+		{"network", "", "192.168.1.1", true, "us", "http://us.mirror/packages/"},
+		{"most specific network", "", "192.0.2.10", true, "us-east", "http://us-east.mirror/packages/"},
+		{"ipv6 network", "", "2001:db8::1", true, "us-east", "http://us-east.mirror/packages/"},
+		{"address", "", "198.51.100.7", true, "eu-west", "http://eu-west.mirror/"},
+		{"no network", "", "198.51.100.8", false, "", ""},
+		{"no address", "", "", false, "", ""},
+		{"region", "EU-WEST", "192.0.2.10", true, "eu-west", "http://eu-west.mirror/"},
+		{"unknown region", "ap-south", "192.0.2.10", false, "", ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+		name, u, ok := m.Select(tst.region, net.ParseIP(tst.ip))
+		if ok != tst.ok {
+			t.Fatalf("expected %v, got %v", tst.ok, ok)
+		}
+		if name != tst.name || u != tst.url {
+			t.Fatalf("expected %s %s, got %s %s", tst.name, tst.url, name, u)
+		}
+	}
+
+	if !m.Has("us-east") || m.Has("ap-south") {
+		t.Fatal("unexpected Has result")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Log("Testing Check")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	up := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+	defer ts.Close()
+
+	m, err := New([]config.RegionMirror{
+		{Region: "us", URL: ts.URL + "/packages/", Networks: []string{"192.0.0.0/8"}},
+		{Region: "us-east", URL: down.URL + "/packages/", HealthURL: down.URL + "/health", Networks: []string{"192.0.2.0/24"}},
+	})
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	ip := net.ParseIP("192.0.2.10")
+
+	t.Log("\tbefore check, healthy")
+	{
+		if name, _, ok := m.Select("", ip); !ok || name != "us-east" {
+			t.Fatalf("expected us-east, got %s %v", name, ok)
+		}
+	}
+
+	t.Log("\tunreachable mirror skipped")
+	{
+		m.Check(context.Background())
+		name, u, ok := m.Select("", ip)
+		if !ok || name != "us" || u != ts.URL+"/packages/" {
+			t.Fatalf("expected us, got %s %s %v", name, u, ok)
+		}
+		if _, _, ok := m.Select("us-east", ip); ok {
+			t.Fatal("expected unhealthy region to not be selected")
+		}
+		for _, st := range m.Status() {
+			if st.Checked.IsZero() {
+				t.Fatalf("expected %s checked", st.Region)
+			}
+			if st.Region == "us-east" && (st.Healthy || st.Error == "") {
+				t.Fatalf("expected us-east unhealthy with error, got %+v", st)
+			}
+		}
+	}
+
+	t.Log("\tunhealthy status")
+	{
+		up = false
+		m.Check(context.Background())
+		if _, _, ok := m.Select("", ip); ok {
+			t.Fatal("expected no healthy mirror")
+		}
+	}
+
+	t.Log("\trecovered")
+	{
+		up = true
+		m.Check(context.Background())
+		if name, _, ok := m.Select("", ip); !ok || name != "us" {
+			t.Fatalf("expected us, got %s %v", name, ok)
+		}
+	}
+
+	t.Log("\tstart, no interval")
+	{
+		m.Start(context.Background(), 0) // returns immediately
+	}
+}
+
+func TestInherit(t *testing.T) {
+	t.Log("Testing Inherit")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	cfg := []config.RegionMirror{
+		{Region: "us-east", URL: down.URL + "/packages/", Networks: []string{"192.0.2.0/24"}},
+		{Region: "us-west", URL: down.URL + "/packages/", Networks: []string{"198.51.100.0/24"}},
+	}
+	prev, err := New(cfg)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	prev.Check(context.Background())
+
+	t.Log("\tnil previous")
+	{
+		m, err := New(cfg)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		m.Inherit(nil)
+		if _, _, ok := m.Select("us-east", nil); !ok {
+			t.Fatal("expected new mirror to be healthy")
+		}
+	}
+
+	t.Log("\tsame region and health url, unhealthy kept")
+	{
+		m, err := New(cfg)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		m.Inherit(prev)
+		for _, st := range m.Status() {
+			if st.Healthy || st.Checked.IsZero() || st.Error == "" {
+				t.Fatalf("expected %s unhealthy with error, got %+v", st.Region, st)
+			}
+		}
+	}
+
+	t.Log("\tchanged health url, healthy until checked")
+	{
+		m, err := New([]config.RegionMirror{
+			{Region: "US-East", URL: "http://mirror/packages/", Networks: []string{"192.0.2.0/24"}},
+		})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		m.Inherit(prev)
+		if _, _, ok := m.Select("", net.ParseIP("192.0.2.10")); !ok {
+			t.Fatal("expected mirror with new url to be healthy")
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package repo
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// addApt generates the dists/ tree (Release, main/binary-<arch>/Packages
+// and Packages.gz) of an apt repository, the package files are served from
+// the repository pool/ directory
+func (r *Repos) addApt(ref Ref, list []*pkgFile) error {
+	// architecture independent (all) packages are listed for every architecture
+	byArch := map[string][]*pkgFile{}
+	indep := []*pkgFile{}
+	for _, pf := range list {
+		if pf.deb.Arch == "all" {
+			indep = append(indep, pf)
+			continue
+		}
+		byArch[pf.deb.Arch] = append(byArch[pf.deb.Arch], pf)
+	}
+	if len(byArch) == 0 && len(indep) > 0 {
+		byArch["all"] = nil
+	}
+
+	archs := make([]string, 0, len(byArch))
+	for a := range byArch {
+		archs = append(archs, a)
+	}
+	sort.Strings(archs)
+
+	dist := ref.Path + "dists/" + Suite + "/"
+	type index struct {
+		name string
+		data []byte
+	}
+	indexes := []index{}
+
+	for _, a := range archs {
+		pkgs := append(append([]*pkgFile{}, byArch[a]...), indep...)
+		data := aptPackages(pkgs)
+		gz, err := compress(data)
+		if err != nil {
+			return err
+		}
+		name := Component + "/binary-" + a + "/Packages"
+		indexes = append(indexes, index{name, data}, index{name + ".gz", gz})
+		r.metadata[dist+name] = data
+		r.metadata[dist+name+".gz"] = gz
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Origin: cosi-server\n")
+	fmt.Fprintf(&b, "Label: cosi-server\n")
+	fmt.Fprintf(&b, "Suite: %s\n", Suite)
+	fmt.Fprintf(&b, "Codename: %s\n", Suite)
+	fmt.Fprintf(&b, "Date: %s\n", newest(list).Format(time.RFC1123))
+	fmt.Fprintf(&b, "Architectures: %s\n", strings.Join(archs, " "))
+	fmt.Fprintf(&b, "Components: %s\n", Component)
+	fmt.Fprintf(&b, "Description: Circonus agent packages for %s %s\n", ref.Dist, ref.Vers)
+	fmt.Fprintf(&b, "MD5Sum:\n")
+	for _, idx := range indexes {
+		sum := md5.Sum(idx.data)
+		fmt.Fprintf(&b, " %s %d %s\n", hex.EncodeToString(sum[:]), len(idx.data), idx.name)
+	}
+	fmt.Fprintf(&b, "SHA256:\n")
+	for _, idx := range indexes {
+		fmt.Fprintf(&b, " %s %d %s\n", sha256sum(idx.data), len(idx.data), idx.name)
+	}
+	r.metadata[dist+"Release"] = b.Bytes()
+
+	for _, pf := range list {
+		r.files[ref.Path+"pool/"+pf.name] = pf.name
+	}
+
+	return nil
+}
+
+// aptPackages returns the Packages index of packages, the control file of
+// each package with the repository fields (file name, size, checksums)
+func aptPackages(list []*pkgFile) []byte {
+	sorted := append([]*pkgFile{}, list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	var b bytes.Buffer
+	for i, pf := range sorted {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(pf.deb.Control)
+		fmt.Fprintf(&b, "\nFilename: pool/%s\n", pf.name)
+		fmt.Fprintf(&b, "Size: %d\n", pf.size)
+		fmt.Fprintf(&b, "MD5sum: %s\n", pf.md5)
+		fmt.Fprintf(&b, "SHA1: %s\n", pf.sha1)
+		fmt.Fprintf(&b, "SHA256: %s\n", pf.sha256)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,163 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const arMagic = "!<arch>\n"
+
+// debPackage is the metadata of a deb package file
+type debPackage struct {
+	Name    string
+	Version string
+	Arch    string
+	Control string // the control file paragraph, without a trailing newline
+}
+
+// readDeb reads the control file from the control archive of a deb package
+// file, control.tar and control.tar.gz are supported
+func readDeb(file string) (*debPackage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, errors.Wrap(err, "reading deb")
+	}
+	if string(magic) != arMagic {
+		return nil, errors.New("invalid deb (ar magic)")
+	}
+
+	for {
+		hdr := make([]byte, 60)
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("invalid deb (no control archive)")
+			}
+			return nil, errors.Wrap(err, "reading deb member")
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(hdr[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid deb member (%s) size", name)
+		}
+
+		if !strings.HasPrefix(name, "control.tar") {
+			// members are padded to an even size
+			if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+				return nil, errors.Wrap(err, "reading deb member")
+			}
+			continue
+		}
+
+		var tr io.Reader = io.LimitReader(r, size)
+		switch name {
+		case "control.tar":
+		case "control.tar.gz":
+			zr, err := gzip.NewReader(tr)
+			if err != nil {
+				return nil, errors.Wrap(err, "reading control archive")
+			}
+			defer zr.Close()
+			tr = zr
+		default:
+			return nil, errors.Errorf("unsupported control archive compression (%s)", name)
+		}
+
+		control, err := readControl(tar.NewReader(tr))
+		if err != nil {
+			return nil, err
+		}
+		return parseControl(control)
+	}
+}
+
+// readControl returns the control file from a control archive
+func readControl(tr *tar.Reader) (string, error) {
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return "", errors.New("invalid control archive (no control file)")
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "reading control archive")
+		}
+		if path.Clean(h.Name) != "control" {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return "", errors.Wrap(err, "reading control file")
+		}
+		return string(data), nil
+	}
+}
+
+// parseControl returns the package metadata of a control file
+func parseControl(control string) (*debPackage, error) {
+	p := debPackage{Control: strings.TrimRight(control, "\n")}
+
+	for _, line := range strings.Split(p.Control, "\n") {
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+1:])
+		switch strings.ToLower(line[:i]) {
+		case "package":
+			p.Name = value
+		case "version":
+			p.Version = value
+		case "architecture":
+			p.Arch = value
+		}
+	}
+
+	if p.Name == "" || p.Version == "" || p.Arch == "" {
+		return nil, errors.New("invalid control file (package, version and architecture are required)")
+	}
+
+	// repository fields are generated
+	lines := []string{}
+	skip := false
+	for _, line := range strings.Split(p.Control, "\n") {
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			field := strings.ToLower(strings.SplitN(line, ":", 2)[0])
+			switch field {
+			case "filename", "size", "md5sum", "sha1", "sha256":
+				skip = true
+			default:
+				skip = false
+			}
+		}
+		if !skip {
+			lines = append(lines, line)
+		}
+	}
+	p.Control = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+
+	return &p, nil
+}
@@ -0,0 +1,272 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+// Package repo generates yum and apt repository metadata for the agent
+// packages in the local package directory
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Repository types
+const (
+	TypeYum = "yum"
+	TypeApt = "apt"
+)
+
+// Suite is the apt repository distribution (suite) and Component its only component
+const (
+	Suite     = "stable"
+	Component = "main"
+)
+
+// Ref identifies a repository, one is generated per package type, dist and
+// vers (e.g. yum/centos/7/, apt/ubuntu/18.04/)
+type Ref struct {
+	Type string // TypeYum or TypeApt
+	Dist string // lower cased distro
+	Vers string
+	Path string // relative to the packages/ endpoint, e.g. yum/centos/7/
+}
+
+// Repos holds the generated repository metadata and the package files of
+// each repository, by path relative to the packages/ endpoint
+type Repos struct {
+	metadata map[string][]byte // metadata content by path
+	files    map[string]string // package file name by path
+	refs     map[string][]Ref  // repositories by package file name
+}
+
+// pkgFile is a package file in the local package directory
+type pkgFile struct {
+	name   string
+	size   int64
+	mtime  time.Time
+	md5    string
+	sha1   string
+	sha256 string
+	rpm    *rpmPackage
+	deb    *debPackage
+}
+
+// Build generates yum (.rpm) and apt (.deb) repositories from the package
+// files in dir. The platforms of each file are derived from the package
+// file name patterns. Files which cannot be read are logged and skipped.
+func Build(dir string) (*Repos, error) {
+	if dir == "" {
+		return nil, errors.New("invalid package path (empty)")
+	}
+
+	fl, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading package directory")
+	}
+
+	names := []string{}
+	infos := map[string]os.FileInfo{}
+	for _, fi := range fl {
+		if fi.IsDir() {
+			continue
+		}
+		switch path.Ext(fi.Name()) {
+		case ".rpm", ".deb":
+			names = append(names, fi.Name())
+			infos[fi.Name()] = fi
+		}
+	}
+	sort.Strings(names)
+
+	platforms, err := packages.FilePlatforms(names)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Repos{
+		metadata: map[string][]byte{},
+		files:    map[string]string{},
+		refs:     map[string][]Ref{},
+	}
+
+	byRepo := map[Ref][]*pkgFile{}
+	refs := []Ref{}
+	for _, name := range names {
+		if len(platforms[name]) == 0 {
+			continue
+		}
+		pf, err := readPackage(dir, infos[name])
+		if err != nil {
+			log.Warn().Err(err).Str("pkg", "repo").Str("file", name).Msg("reading package, skipping")
+			continue
+		}
+		typ := TypeYum
+		if pf.deb != nil {
+			typ = TypeApt
+		}
+		for _, p := range platforms[name] {
+			dist := strings.ToLower(p.Dist)
+			ref := Ref{Type: typ, Dist: dist, Vers: p.Vers, Path: typ + "/" + dist + "/" + p.Vers + "/"}
+			if _, ok := byRepo[ref]; !ok {
+				refs = append(refs, ref)
+			}
+			if !hasFile(byRepo[ref], name) {
+				byRepo[ref] = append(byRepo[ref], pf)
+				r.refs[name] = append(r.refs[name], ref)
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		list := byRepo[ref]
+		switch ref.Type {
+		case TypeYum:
+			if err := r.addYum(ref, list); err != nil {
+				return nil, errors.Wrapf(err, "yum repository %s", ref.Path)
+			}
+		case TypeApt:
+			if err := r.addApt(ref, list); err != nil {
+				return nil, errors.Wrapf(err, "apt repository %s", ref.Path)
+			}
+		}
+	}
+
+	return &r, nil
+}
+
+// Metadata returns generated repository metadata (e.g.
+// yum/centos/7/repodata/repomd.xml) by path
+func (r *Repos) Metadata(p string) ([]byte, bool) {
+	data, ok := r.metadata[p]
+	return data, ok
+}
+
+// File returns the package file name for a repository package path (e.g.
+// apt/ubuntu/18.04/pool/circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb)
+func (r *Repos) File(p string) (string, bool) {
+	name, ok := r.files[p]
+	return name, ok
+}
+
+// Repo returns the repository containing a package file, the repository
+// for dist if there are several (e.g. centos and redhat for el7 packages)
+func (r *Repos) Repo(file, dist string) (Ref, bool) {
+	refs := r.refs[file]
+	if len(refs) == 0 {
+		return Ref{}, false
+	}
+	dist = strings.ToLower(dist)
+	for _, ref := range refs {
+		if ref.Dist == dist {
+			return ref, true
+		}
+	}
+	return refs[0], true
+}
+
+// Repos returns every repository, sorted by path
+func (r *Repos) Repos() []Ref {
+	seen := map[string]bool{}
+	list := []Ref{}
+	for _, refs := range r.refs {
+		for _, ref := range refs {
+			if !seen[ref.Path] {
+				seen[ref.Path] = true
+				list = append(list, ref)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+func hasFile(list []*pkgFile, name string) bool {
+	for _, pf := range list {
+		if pf.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readPackage reads the metadata and checksums of a package file
+func readPackage(dir string, fi os.FileInfo) (*pkgFile, error) {
+	file := path.Join(dir, fi.Name())
+	pf := pkgFile{name: fi.Name(), size: fi.Size(), mtime: fi.ModTime().UTC()}
+
+	var err error
+	if path.Ext(fi.Name()) == ".rpm" {
+		pf.rpm, err = readRPM(file)
+	} else {
+		pf.deb, err = readDeb(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := md5.New()
+	s1 := sha1.New()
+	s256 := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(m, s1, s256), f); err != nil {
+		return nil, errors.Wrap(err, "checksum")
+	}
+	pf.md5 = hex.EncodeToString(m.Sum(nil))
+	pf.sha1 = hex.EncodeToString(s1.Sum(nil))
+	pf.sha256 = hex.EncodeToString(s256.Sum(nil))
+
+	return &pf, nil
+}
+
+// newest returns the latest modification time of package files, used as
+// the repository timestamp so metadata only changes when packages do
+func newest(list []*pkgFile) time.Time {
+	var t time.Time
+	for _, pf := range list {
+		if pf.mtime.After(t) {
+			t = pf.mtime
+		}
+	}
+	return t
+}
+
+// compress returns gzip compressed data, without a name or timestamp so
+// the output only depends on the data
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sha256sum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
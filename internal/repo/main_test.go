@@ -0,0 +1,438 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// rpmTag is a tag written by buildRPM
+type rpmTag struct {
+	tag  int32
+	typ  int32
+	data interface{} // string, []string, []int32 or []uint16
+}
+
+// buildHeader returns an rpm header structure with the tags
+func buildHeader(tags []rpmTag) []byte {
+	var index, store bytes.Buffer
+	for _, t := range tags {
+		var count int
+		offset := store.Len()
+		switch v := t.data.(type) {
+		case string:
+			store.WriteString(v)
+			store.WriteByte(0)
+			count = 1
+		case []string:
+			for _, s := range v {
+				store.WriteString(s)
+				store.WriteByte(0)
+			}
+			count = len(v)
+		case []uint16:
+			for store.Len()%2 != 0 {
+				store.WriteByte(0)
+			}
+			offset = store.Len()
+			_ = binary.Write(&store, binary.BigEndian, v)
+			count = len(v)
+		case []int32:
+			for store.Len()%4 != 0 {
+				store.WriteByte(0)
+			}
+			offset = store.Len()
+			_ = binary.Write(&store, binary.BigEndian, v)
+			count = len(v)
+		}
+		_ = binary.Write(&index, binary.BigEndian, []int32{t.tag, t.typ, int32(offset), int32(count)})
+	}
+
+	var h bytes.Buffer
+	h.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	_ = binary.Write(&h, binary.BigEndian, []int32{int32(len(tags)), int32(store.Len())})
+	h.Write(index.Bytes())
+	h.Write(store.Bytes())
+	return h.Bytes()
+}
+
+// buildRPM writes a minimal rpm package file (lead, signature and header,
+// no payload)
+func buildRPM(t *testing.T, file, name, version, release, arch string) {
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+
+	sig := buildHeader([]rpmTag{{sigTagPayloadSize, typeInt32, []int32{2048}}})
+	for len(sig)%8 != 0 {
+		sig = append(sig, 0)
+	}
+
+	hdr := buildHeader([]rpmTag{
+		{tagName, typeString, name},
+		{tagVersion, typeString, version},
+		{tagRelease, typeString, release},
+		{tagSummary, typeI18NString, []string{"Circonus agent"}},
+		{tagDescription, typeI18NString, []string{"Circonus agent <test>"}},
+		{tagBuildTime, typeInt32, []int32{1600000000}},
+		{tagSize, typeInt32, []int32{4096}},
+		{tagLicense, typeString, "BSD"},
+		{tagArch, typeString, arch},
+		{tagFileModes, typeInt16, []uint16{040755, 0100755}},
+		{tagProvideName, typeStringArray, []string{name}},
+		{tagProvideFlags, typeInt32, []int32{8}},
+		{tagProvideVersion, typeStringArray, []string{version + "-" + release}},
+		{tagRequireName, typeStringArray, []string{"/bin/sh", "rpmlib(CompressedFileNames)"}},
+		{tagRequireFlags, typeInt32, []int32{0, 0x1000000 | 8}},
+		{tagRequireVersion, typeStringArray, []string{"", "3.0.4-1"}},
+		{tagDirIndexes, typeInt32, []int32{0, 1}},
+		{tagBaseNames, typeStringArray, []string{"agent", "circonus-agentd"}},
+		{tagDirNames, typeStringArray, []string{"/opt/circonus/", "/opt/circonus/agent/sbin/"}},
+	})
+
+	data := append(append(lead, sig...), hdr...)
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+}
+
+func TestReadRPM(t *testing.T) {
+	t.Log("Testing readRPM")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "cosi-repo")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Log("\tinvalid")
+	{
+		file := filepath.Join(dir, "invalid.rpm")
+		if err := ioutil.WriteFile(file, []byte("not an rpm"), 0644); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := readRPM(file); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tvalid")
+	{
+		file := filepath.Join(dir, "circonus-agent-1.0.0-1.el7.x86_64.rpm")
+		buildRPM(t, file, "circonus-agent", "1.0.0", "1.el7", "x86_64")
+
+		p, err := readRPM(file)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if p.Name != "circonus-agent" || p.Arch != "x86_64" || p.EVR.Version != "1.0.0" || p.EVR.Release != "1.el7" {
+			t.Fatalf("unexpected package %#v", p)
+		}
+		if p.Summary != "Circonus agent" || p.BuildTime != 1600000000 || p.Installed != 4096 || p.Archive != 2048 {
+			t.Fatalf("unexpected package %#v", p)
+		}
+		if p.HeaderStart != 96+40 || p.HeaderEnd <= p.HeaderStart {
+			t.Fatalf("unexpected header range %d-%d", p.HeaderStart, p.HeaderEnd)
+		}
+		if len(p.Dirs) != 1 || p.Dirs[0] != "/opt/circonus/agent" {
+			t.Fatalf("unexpected dirs %v", p.Dirs)
+		}
+		if len(p.Files) != 1 || p.Files[0] != "/opt/circonus/agent/sbin/circonus-agentd" {
+			t.Fatalf("unexpected files %v", p.Files)
+		}
+		if len(p.Provides) != 1 || p.Provides[0].Flags != "EQ" || p.Provides[0].EVR.Release != "1.el7" {
+			t.Fatalf("unexpected provides %#v", p.Provides)
+		}
+		// rpmlib() requires are not included
+		if len(p.Requires) != 1 || p.Requires[0].Name != "/bin/sh" || p.Requires[0].Flags != "" {
+			t.Fatalf("unexpected requires %#v", p.Requires)
+		}
+	}
+}
+
+func TestReadRPMHeader(t *testing.T) {
+	t.Log("Testing readRPMHeader (malformed)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	// header builds a header structure with one entry and size bytes of data
+	header := func(typ, offset, count uint32, size int) []byte {
+		b := append([]byte{}, rpmHeaderMagic...)
+		b = append(b, 0x01, 0, 0, 0, 0)
+		n := make([]byte, 24)
+		binary.BigEndian.PutUint32(n[0:4], 1)
+		binary.BigEndian.PutUint32(n[4:8], uint32(size))
+		binary.BigEndian.PutUint32(n[8:12], 1000)
+		binary.BigEndian.PutUint32(n[12:16], typ)
+		binary.BigEndian.PutUint32(n[16:20], offset)
+		binary.BigEndian.PutUint32(n[20:24], count)
+		b = append(b, n...)
+		return append(b, make([]byte, size)...)
+	}
+
+	tt := []struct {
+		desc      string
+		data      []byte
+		shouldErr bool
+	}{
+		{"valid int32", header(typeInt32, 0, 2, 8), false},
+		{"valid string", header(typeString, 4, 1, 8), false},
+		{"negative count", header(typeInt32, 0, 0xffffffff, 8), true},
+		{"negative offset", header(typeInt32, 0x80000000, 1, 8), true},
+		{"count beyond data", header(typeInt32, 0, 3, 8), true},
+		{"int16 count beyond data", header(typeInt16, 6, 2, 8), true},
+		{"offset beyond data", header(typeInt32, 9, 0, 8), true},
+		{"string offset beyond data", header(typeStringArray, 8, 1, 8), true},
+		{"truncated", header(typeInt32, 0, 2, 8)[:20], true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+		h, err := readRPMHeader(bytes.NewReader(tst.data), 0)
+		if tst.shouldErr {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		h.ints(1000)
+		h.strs(1000)
+	}
+
+	t.Log("\tinvalid entries are ignored")
+	{
+		h := &rpmHeader{
+			entries: map[int32]rpmEntry{
+				1: {typ: typeInt32, offset: 0, count: -1},
+				2: {typ: typeStringArray, offset: 0, count: -1},
+				3: {typ: typeInt16, offset: -2, count: 1},
+			},
+			data: make([]byte, 8),
+		}
+		if v := h.ints(1); v != nil {
+			t.Fatalf("expected nil, got %v", v)
+		}
+		if v := h.strs(2); v != nil {
+			t.Fatalf("expected nil, got %v", v)
+		}
+		if v := h.ints(3); v != nil {
+			t.Fatalf("expected nil, got %v", v)
+		}
+	}
+}
+
+func TestReadDeb(t *testing.T) {
+	t.Log("Testing readDeb")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	t.Log("\tinvalid")
+	{
+		if _, err := readDeb("main.go"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tvalid")
+	{
+		p, err := readDeb(filepath.Join("testdata", "circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb"))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if p.Name != "circonus-agent" || p.Version != "1.0.0-1" || p.Arch != "amd64" {
+			t.Fatalf("unexpected package %#v", p)
+		}
+		if !strings.HasSuffix(p.Control, " Test package for repository metadata.") {
+			t.Fatalf("unexpected control %q", p.Control)
+		}
+	}
+
+	t.Log("\tcontrol repository fields")
+	{
+		p, err := parseControl("Package: a\nVersion: 1\nArchitecture: all\nSize: 10\nSHA256: abc\nDescription: a\n multi\n")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if p.Control != "Package: a\nVersion: 1\nArchitecture: all\nDescription: a\n multi" {
+			t.Fatalf("unexpected control %q", p.Control)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	t.Log("Testing Build")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	if _, err := Build(""); err == nil {
+		t.Fatal("expected error")
+	}
+
+	dir, err := ioutil.TempDir("", "cosi-repo")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	buildRPM(t, filepath.Join(dir, "circonus-agent-1.0.0-1.el7.x86_64.rpm"), "circonus-agent", "1.0.0", "1.el7", "x86_64")
+	buildRPM(t, filepath.Join(dir, "circonus-agent-1.0.0-1.el8.x86_64.rpm"), "circonus-agent", "1.0.0", "1.el8", "x86_64")
+	deb, err := ioutil.ReadFile(filepath.Join("testdata", "circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb"))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	for name, data := range map[string][]byte{
+		"circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb": deb,
+		"circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb": []byte("invalid"), // skipped
+		"circonus-agent-1.0.0-1.freebsd.12.1_amd64.tgz":  []byte("tgz"),     // not a repository package
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	r, err := Build(dir)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Log("\trepositories")
+	{
+		paths := []string{}
+		for _, ref := range r.Repos() {
+			paths = append(paths, ref.Path)
+		}
+		expect := "apt/ubuntu/18.04/ yum/centos/7/ yum/centos/8/ yum/oracle/7/ yum/oracle/8/ yum/redhat/7/ yum/redhat/8/"
+		if strings.Join(paths, " ") != expect {
+			t.Fatalf("expected (%s) got (%s)", expect, strings.Join(paths, " "))
+		}
+
+		ref, ok := r.Repo("circonus-agent-1.0.0-1.el7.x86_64.rpm", "RedHat")
+		if !ok || ref.Path != "yum/redhat/7/" {
+			t.Fatalf("unexpected repo %#v", ref)
+		}
+		ref, ok = r.Repo("circonus-agent-1.0.0-1.el7.x86_64.rpm", "rocky")
+		if !ok || ref.Path != "yum/centos/7/" {
+			t.Fatalf("unexpected repo %#v", ref)
+		}
+		if _, ok := r.Repo("circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb", "ubuntu"); ok {
+			t.Fatal("expected no repo for invalid package")
+		}
+	}
+
+	t.Log("\tyum")
+	{
+		md, ok := r.Metadata("yum/centos/7/repodata/repomd.xml")
+		if !ok {
+			t.Fatal("expected repomd.xml")
+		}
+		var repomd struct {
+			Data []struct {
+				Type     string `xml:"type,attr"`
+				Checksum string `xml:"checksum"`
+				Location struct {
+					Href string `xml:"href,attr"`
+				} `xml:"location"`
+			} `xml:"data"`
+		}
+		if err := xml.Unmarshal(md, &repomd); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(repomd.Data) != 2 {
+			t.Fatalf("unexpected repomd %s", string(md))
+		}
+		for _, d := range repomd.Data {
+			gz, ok := r.Metadata("yum/centos/7/" + d.Location.Href)
+			if !ok {
+				t.Fatalf("expected %s", d.Location.Href)
+			}
+			if sha256sum(gz) != d.Checksum {
+				t.Fatalf("%s checksum mismatch", d.Type)
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(gz))
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			data, _ := ioutil.ReadAll(zr)
+			if d.Type == "primary" {
+				for _, s := range []string{
+					`<name>circonus-agent</name>`,
+					`<version epoch="0" ver="1.0.0" rel="1.el7"/>`,
+					`<location href="circonus-agent-1.0.0-1.el7.x86_64.rpm"/>`,
+					`<description>Circonus agent &lt;test&gt;</description>`,
+					`<rpm:entry name="circonus-agent" flags="EQ" epoch="0" ver="1.0.0" rel="1.el7"/>`,
+				} {
+					if !strings.Contains(string(data), s) {
+						t.Fatalf("primary missing (%s)\n%s", s, string(data))
+					}
+				}
+				if strings.Contains(string(data), "el8") {
+					t.Fatalf("unexpected el8 package in el7 repository\n%s", string(data))
+				}
+			}
+			if d.Type == "filelists" && !strings.Contains(string(data), `<file>/opt/circonus/agent/sbin/circonus-agentd</file>`) {
+				t.Fatalf("unexpected filelists\n%s", string(data))
+			}
+		}
+
+		if name, ok := r.File("yum/centos/7/circonus-agent-1.0.0-1.el7.x86_64.rpm"); !ok || name != "circonus-agent-1.0.0-1.el7.x86_64.rpm" {
+			t.Fatalf("unexpected file (%s)", name)
+		}
+		if _, ok := r.File("yum/centos/7/circonus-agent-1.0.0-1.el8.x86_64.rpm"); ok {
+			t.Fatal("expected no el8 file in el7 repository")
+		}
+	}
+
+	t.Log("\tapt")
+	{
+		pkgs, ok := r.Metadata("apt/ubuntu/18.04/dists/stable/main/binary-amd64/Packages")
+		if !ok {
+			t.Fatal("expected Packages")
+		}
+		for _, s := range []string{
+			"Package: circonus-agent\n",
+			"\nFilename: pool/circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb\n",
+			"\nSize: " + strconv.Itoa(len(deb)) + "\n",
+			"\nSHA256: " + sha256sum(deb) + "\n",
+		} {
+			if !strings.Contains(string(pkgs), s) {
+				t.Fatalf("Packages missing (%q)\n%s", s, string(pkgs))
+			}
+		}
+		rel, ok := r.Metadata("apt/ubuntu/18.04/dists/stable/Release")
+		if !ok {
+			t.Fatal("expected Release")
+		}
+		for _, s := range []string{
+			"Architectures: amd64\n",
+			" " + sha256sum(pkgs) + " " + strconv.Itoa(len(pkgs)) + " main/binary-amd64/Packages\n",
+		} {
+			if !strings.Contains(string(rel), s) {
+				t.Fatalf("Release missing (%q)\n%s", s, string(rel))
+			}
+		}
+		if _, ok := r.Metadata("apt/ubuntu/18.04/dists/stable/main/binary-amd64/Packages.gz"); !ok {
+			t.Fatal("expected Packages.gz")
+		}
+		if _, ok := r.File("apt/ubuntu/18.04/pool/circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb"); !ok {
+			t.Fatal("expected pool file")
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// rpm header tags used for repository metadata
+const (
+	tagName           = 1000
+	tagVersion        = 1001
+	tagRelease        = 1002
+	tagEpoch          = 1003
+	tagSummary        = 1004
+	tagDescription    = 1005
+	tagBuildTime      = 1006
+	tagBuildHost      = 1007
+	tagSize           = 1009
+	tagVendor         = 1011
+	tagLicense        = 1014
+	tagPackager       = 1015
+	tagGroup          = 1016
+	tagURL            = 1020
+	tagArch           = 1022
+	tagFileModes      = 1030
+	tagSourceRPM      = 1044
+	tagProvideName    = 1047
+	tagRequireFlags   = 1048
+	tagRequireName    = 1049
+	tagRequireVersion = 1050
+	tagProvideFlags   = 1112
+	tagProvideVersion = 1113
+	tagDirIndexes     = 1116
+	tagBaseNames      = 1117
+	tagDirNames       = 1118
+
+	sigTagPayloadSize = 1007
+)
+
+// rpm header data types
+const (
+	typeInt16       = 3
+	typeInt32       = 4
+	typeString      = 6
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+const rpmLeadSize = 96
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8}
+)
+
+// rpmHeader is a parsed rpm header structure
+type rpmHeader struct {
+	entries map[int32]rpmEntry
+	data    []byte
+	start   int64 // offset of the header in the file
+	end     int64 // offset of the end of the header
+}
+
+type rpmEntry struct {
+	typ    int32
+	offset int32
+	count  int32
+}
+
+// rpmDep is a provides or requires entry
+type rpmDep struct {
+	Name  string
+	Flags string // EQ, LT, GT, LE, GE or blank
+	EVR   evr
+}
+
+// evr is an rpm epoch, version, release
+type evr struct {
+	Epoch   string
+	Version string
+	Release string
+}
+
+// rpmPackage is the metadata of an rpm package file
+type rpmPackage struct {
+	Name        string
+	Arch        string
+	EVR         evr
+	Summary     string
+	Description string
+	Packager    string
+	URL         string
+	License     string
+	Vendor      string
+	Group       string
+	BuildHost   string
+	SourceRPM   string
+	BuildTime   int64
+	Installed   int64 // installed size
+	Archive     int64 // payload size
+	HeaderStart int64
+	HeaderEnd   int64
+	Provides    []rpmDep
+	Requires    []rpmDep
+	Files       []string
+	Dirs        []string
+}
+
+// readRPM reads the metadata from the signature and main headers of an rpm
+// package file
+func readRPM(file string) (*rpmPackage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(f, lead); err != nil {
+		return nil, errors.Wrap(err, "reading rpm lead")
+	}
+	if !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return nil, errors.New("invalid rpm lead (magic)")
+	}
+
+	sig, err := readRPMHeader(f, rpmLeadSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading rpm signature")
+	}
+
+	// the signature is padded to a multiple of 8 bytes
+	start := sig.end
+	if pad := start % 8; pad != 0 {
+		start += 8 - pad
+	}
+
+	h, err := readRPMHeader(f, start)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading rpm header")
+	}
+
+	p := rpmPackage{
+		Name:        h.str(tagName),
+		Arch:        h.str(tagArch),
+		EVR:         evr{Version: h.str(tagVersion), Release: h.str(tagRelease)},
+		Summary:     h.str(tagSummary),
+		Description: h.str(tagDescription),
+		Packager:    h.str(tagPackager),
+		URL:         h.str(tagURL),
+		License:     h.str(tagLicense),
+		Vendor:      h.str(tagVendor),
+		Group:       h.str(tagGroup),
+		BuildHost:   h.str(tagBuildHost),
+		SourceRPM:   h.str(tagSourceRPM),
+		HeaderStart: h.start,
+		HeaderEnd:   h.end,
+	}
+	if p.Name == "" {
+		return nil, errors.New("invalid rpm header (no name)")
+	}
+	if v := h.ints(tagEpoch); len(v) > 0 {
+		p.EVR.Epoch = strconv.FormatInt(v[0], 10)
+	}
+	if v := h.ints(tagBuildTime); len(v) > 0 {
+		p.BuildTime = v[0]
+	}
+	if v := h.ints(tagSize); len(v) > 0 {
+		p.Installed = v[0]
+	}
+	if v := sig.ints(sigTagPayloadSize); len(v) > 0 {
+		p.Archive = v[0]
+	}
+
+	p.Provides = h.deps(tagProvideName, tagProvideFlags, tagProvideVersion)
+	p.Requires = h.deps(tagRequireName, tagRequireFlags, tagRequireVersion)
+
+	dirs := h.strs(tagDirNames)
+	idxs := h.ints(tagDirIndexes)
+	modes := h.ints(tagFileModes)
+	for i, base := range h.strs(tagBaseNames) {
+		if i >= len(idxs) || int(idxs[i]) >= len(dirs) {
+			break
+		}
+		name := dirs[idxs[i]] + base
+		if i < len(modes) && modes[i]&0170000 == 040000 {
+			p.Dirs = append(p.Dirs, name)
+			continue
+		}
+		p.Files = append(p.Files, name)
+	}
+
+	return &p, nil
+}
+
+// readRPMHeader reads a header structure at offset
+func readRPMHeader(r io.ReaderAt, offset int64) (*rpmHeader, error) {
+	intro := make([]byte, 16)
+	if _, err := r.ReadAt(intro, offset); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(intro[:3], rpmHeaderMagic) {
+		return nil, errors.New("invalid header (magic)")
+	}
+
+	nindex := int64(binary.BigEndian.Uint32(intro[8:12]))
+	hsize := int64(binary.BigEndian.Uint32(intro[12:16]))
+	if nindex > 65536 || hsize > 256<<20 {
+		return nil, errors.New("invalid header (size)")
+	}
+
+	buf := make([]byte, nindex*16+hsize)
+	if _, err := r.ReadAt(buf, offset+16); err != nil {
+		return nil, err
+	}
+
+	h := rpmHeader{
+		entries: make(map[int32]rpmEntry, nindex),
+		data:    buf[nindex*16:],
+		start:   offset,
+		end:     offset + 16 + int64(len(buf)),
+	}
+	for i := int64(0); i < nindex; i++ {
+		e := buf[i*16 : i*16+16]
+		tag := int32(binary.BigEndian.Uint32(e[0:4]))
+		entry := rpmEntry{
+			typ:    int32(binary.BigEndian.Uint32(e[4:8])),
+			offset: int32(binary.BigEndian.Uint32(e[8:12])),
+			count:  int32(binary.BigEndian.Uint32(e[12:16])),
+		}
+		if !entry.valid(len(h.data)) {
+			return nil, errors.Errorf("invalid header (tag %d, offset %d, count %d)", tag, entry.offset, entry.count)
+		}
+		h.entries[tag] = entry
+	}
+
+	return &h, nil
+}
+
+// valid returns true if the data of an entry is within a header data store
+// of size n, the values of int tags and at least the start of string tags
+func (e rpmEntry) valid(n int) bool {
+	if e.offset < 0 || e.count < 0 || int64(e.offset) > int64(n) {
+		return false
+	}
+	switch e.typ {
+	case typeInt16:
+		return int64(e.offset)+int64(e.count)*2 <= int64(n)
+	case typeInt32:
+		return int64(e.offset)+int64(e.count)*4 <= int64(n)
+	case typeString, typeStringArray, typeI18NString:
+		return e.count == 0 || int64(e.offset) < int64(n)
+	}
+	return true
+}
+
+// strs returns the strings of a string, string array or i18n string tag
+func (h *rpmHeader) strs(tag int32) []string {
+	e, ok := h.entries[tag]
+	if !ok || e.offset < 0 || e.count < 0 || int(e.offset) >= len(h.data) {
+		return nil
+	}
+	switch e.typ {
+	case typeString, typeStringArray, typeI18NString:
+	default:
+		return nil
+	}
+
+	list := []string{}
+	data := h.data[e.offset:]
+	for i := int32(0); i < e.count; i++ {
+		n := bytes.IndexByte(data, 0)
+		if n < 0 {
+			break
+		}
+		list = append(list, string(data[:n]))
+		data = data[n+1:]
+		if e.typ == typeString {
+			break
+		}
+	}
+	return list
+}
+
+// str returns the (first) string of a tag
+func (h *rpmHeader) str(tag int32) string {
+	if v := h.strs(tag); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// ints returns the values of an int16 or int32 tag
+func (h *rpmHeader) ints(tag int32) []int64 {
+	e, ok := h.entries[tag]
+	if !ok || !e.valid(len(h.data)) {
+		return nil
+	}
+
+	size := 0
+	switch e.typ {
+	case typeInt16:
+		size = 2
+	case typeInt32:
+		size = 4
+	default:
+		return nil
+	}
+
+	list := make([]int64, 0, e.count)
+	for i := 0; i < int(e.count); i++ {
+		b := h.data[int(e.offset)+i*size:]
+		if size == 2 {
+			list = append(list, int64(binary.BigEndian.Uint16(b)))
+		} else {
+			list = append(list, int64(binary.BigEndian.Uint32(b)))
+		}
+	}
+	return list
+}
+
+// deps returns the provides or requires of a package, rpmlib() requires
+// are not included (as createrepo)
+func (h *rpmHeader) deps(nameTag, flagsTag, versionTag int32) []rpmDep {
+	names := h.strs(nameTag)
+	flags := h.ints(flagsTag)
+	versions := h.strs(versionTag)
+
+	list := []rpmDep{}
+	for i, name := range names {
+		if strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+		d := rpmDep{Name: name}
+		if i < len(flags) {
+			d.Flags = depFlags(flags[i])
+		}
+		if i < len(versions) && d.Flags != "" {
+			d.EVR = parseEVR(versions[i])
+		}
+		list = append(list, d)
+	}
+	return list
+}
+
+// depFlags returns the repository metadata flags of rpm sense flags
+func depFlags(f int64) string {
+	const (
+		less    = 0x02
+		greater = 0x04
+		equal   = 0x08
+	)
+	switch f & (less | greater | equal) {
+	case equal:
+		return "EQ"
+	case less:
+		return "LT"
+	case greater:
+		return "GT"
+	case less | equal:
+		return "LE"
+	case greater | equal:
+		return "GE"
+	}
+	return ""
+}
+
+// parseEVR parses [epoch:]version[-release]
+func parseEVR(s string) evr {
+	v := evr{}
+	if i := strings.Index(s, ":"); i >= 0 {
+		v.Epoch = s[:i]
+		s = s[i+1:]
+	}
+	if i := strings.LastIndex(s, "-"); i >= 0 {
+		v.Release = s[i+1:]
+		s = s[:i]
+	}
+	v.Version = s
+	return v
+}
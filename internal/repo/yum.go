@@ -0,0 +1,153 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package repo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// addYum generates the repodata/ (repomd.xml, primary.xml.gz and
+// filelists.xml.gz) of a yum repository, the package files are served from
+// the repository directory
+func (r *Repos) addYum(ref Ref, list []*pkgFile) error {
+	primary := yumPrimary(list)
+	filelists := yumFilelists(list)
+
+	var md bytes.Buffer
+	md.WriteString(xml.Header)
+	fmt.Fprintf(&md, "<repomd xmlns=\"http://linux.duke.edu/metadata/repo\" xmlns:rpm=\"http://linux.duke.edu/metadata/rpm\">\n")
+	ts := newest(list).Unix()
+	fmt.Fprintf(&md, "  <revision>%d</revision>\n", ts)
+
+	for _, d := range []struct {
+		name string
+		data []byte
+	}{
+		{"primary", primary},
+		{"filelists", filelists},
+	} {
+		gz, err := compress(d.data)
+		if err != nil {
+			return err
+		}
+		loc := "repodata/" + d.name + ".xml.gz"
+		r.metadata[ref.Path+loc] = gz
+
+		fmt.Fprintf(&md, "  <data type=\"%s\">\n", d.name)
+		fmt.Fprintf(&md, "    <checksum type=\"sha256\">%s</checksum>\n", sha256sum(gz))
+		fmt.Fprintf(&md, "    <open-checksum type=\"sha256\">%s</open-checksum>\n", sha256sum(d.data))
+		fmt.Fprintf(&md, "    <location href=\"%s\"/>\n", loc)
+		fmt.Fprintf(&md, "    <timestamp>%d</timestamp>\n", ts)
+		fmt.Fprintf(&md, "    <size>%d</size>\n", len(gz))
+		fmt.Fprintf(&md, "    <open-size>%d</open-size>\n", len(d.data))
+		fmt.Fprintf(&md, "  </data>\n")
+	}
+	md.WriteString("</repomd>\n")
+
+	r.metadata[ref.Path+"repodata/repomd.xml"] = md.Bytes()
+	for _, pf := range list {
+		r.files[ref.Path+pf.name] = pf.name
+	}
+
+	return nil
+}
+
+// yumPrimary returns the primary.xml of a yum repository
+func yumPrimary(list []*pkgFile) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, "<metadata xmlns=\"http://linux.duke.edu/metadata/common\" xmlns:rpm=\"http://linux.duke.edu/metadata/rpm\" packages=\"%d\">\n", len(list))
+
+	for _, pf := range list {
+		p := pf.rpm
+		fmt.Fprintf(&b, "<package type=\"rpm\">\n")
+		fmt.Fprintf(&b, "  <name>%s</name>\n", esc(p.Name))
+		fmt.Fprintf(&b, "  <arch>%s</arch>\n", esc(p.Arch))
+		fmt.Fprintf(&b, "  <version %s/>\n", evrAttrs(p.EVR))
+		fmt.Fprintf(&b, "  <checksum type=\"sha256\" pkgid=\"YES\">%s</checksum>\n", pf.sha256)
+		fmt.Fprintf(&b, "  <summary>%s</summary>\n", esc(p.Summary))
+		fmt.Fprintf(&b, "  <description>%s</description>\n", esc(p.Description))
+		fmt.Fprintf(&b, "  <packager>%s</packager>\n", esc(p.Packager))
+		fmt.Fprintf(&b, "  <url>%s</url>\n", esc(p.URL))
+		fmt.Fprintf(&b, "  <time file=\"%d\" build=\"%d\"/>\n", pf.mtime.Unix(), p.BuildTime)
+		fmt.Fprintf(&b, "  <size package=\"%d\" installed=\"%d\" archive=\"%d\"/>\n", pf.size, p.Installed, p.Archive)
+		fmt.Fprintf(&b, "  <location href=\"%s\"/>\n", esc(pf.name))
+		fmt.Fprintf(&b, "  <format>\n")
+		fmt.Fprintf(&b, "    <rpm:license>%s</rpm:license>\n", esc(p.License))
+		fmt.Fprintf(&b, "    <rpm:vendor>%s</rpm:vendor>\n", esc(p.Vendor))
+		fmt.Fprintf(&b, "    <rpm:group>%s</rpm:group>\n", esc(p.Group))
+		fmt.Fprintf(&b, "    <rpm:buildhost>%s</rpm:buildhost>\n", esc(p.BuildHost))
+		fmt.Fprintf(&b, "    <rpm:sourcerpm>%s</rpm:sourcerpm>\n", esc(p.SourceRPM))
+		fmt.Fprintf(&b, "    <rpm:header-range start=\"%d\" end=\"%d\"/>\n", p.HeaderStart, p.HeaderEnd)
+		writeDeps(&b, "provides", p.Provides)
+		writeDeps(&b, "requires", p.Requires)
+		fmt.Fprintf(&b, "  </format>\n")
+		fmt.Fprintf(&b, "</package>\n")
+	}
+
+	b.WriteString("</metadata>\n")
+	return b.Bytes()
+}
+
+// yumFilelists returns the filelists.xml of a yum repository
+func yumFilelists(list []*pkgFile) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, "<filelists xmlns=\"http://linux.duke.edu/metadata/filelists\" packages=\"%d\">\n", len(list))
+
+	for _, pf := range list {
+		p := pf.rpm
+		fmt.Fprintf(&b, "<package pkgid=\"%s\" name=\"%s\" arch=\"%s\">\n", pf.sha256, esc(p.Name), esc(p.Arch))
+		fmt.Fprintf(&b, "  <version %s/>\n", evrAttrs(p.EVR))
+		for _, d := range p.Dirs {
+			fmt.Fprintf(&b, "  <file type=\"dir\">%s</file>\n", esc(d))
+		}
+		for _, f := range p.Files {
+			fmt.Fprintf(&b, "  <file>%s</file>\n", esc(f))
+		}
+		fmt.Fprintf(&b, "</package>\n")
+	}
+
+	b.WriteString("</filelists>\n")
+	return b.Bytes()
+}
+
+func writeDeps(b *bytes.Buffer, name string, deps []rpmDep) {
+	if len(deps) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "    <rpm:%s>\n", name)
+	for _, d := range deps {
+		if d.Flags == "" {
+			fmt.Fprintf(b, "      <rpm:entry name=\"%s\"/>\n", esc(d.Name))
+			continue
+		}
+		fmt.Fprintf(b, "      <rpm:entry name=\"%s\" flags=\"%s\" %s/>\n", esc(d.Name), d.Flags, evrAttrs(d.EVR))
+	}
+	fmt.Fprintf(b, "    </rpm:%s>\n", name)
+}
+
+// evrAttrs returns the epoch, ver and rel attributes of a version
+func evrAttrs(v evr) string {
+	epoch := v.Epoch
+	if epoch == "" {
+		epoch = "0"
+	}
+	s := fmt.Sprintf("epoch=\"%s\" ver=\"%s\"", esc(epoch), esc(v.Version))
+	if v.Release != "" {
+		s += fmt.Sprintf(" rel=\"%s\"", esc(v.Release))
+	}
+	return s
+}
+
+// esc returns s escaped for xml text and attributes
+func esc(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -9,7 +9,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/circonus-labs/cosi-server/internal/packages"
 	"github.com/rs/zerolog/hlog"
 	"github.com/xi2/httpgzip"
 )
@@ -39,6 +42,29 @@ func (s *Server) agentPackage() http.Handler {
 					return
 				}
 
+				c := s.snapshot()
+
+				sel, err := s.validatePackageSelection(c, r)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("invalid parameter")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusBadRequest))
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				textFormat, err := s.validateTextFormat(r)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("invalid parameter")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusBadRequest))
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				// region mirror, package_base_url is used if there is none for
+				// the request or it is not healthy
+				pkgRegion, baseURL := c.regionMirror(r)
+				sel.BaseURL = baseURL
+
 				//
 				// tracking metrics
 				//
@@ -57,7 +83,7 @@ func (s *Server) agentPackage() http.Handler {
 				// os dist ver arch
 				s.stats.Increment(fmt.Sprintf("%s`%s`%s`%s", r.URL.Path, args.osDistro, args.osVers, args.sysArch))
 
-				pkg, err := s.packageList.GetPackageInfo(args.osType, args.osDistro, args.osVers, args.sysArch)
+				pkg, err := s.packageInfo(c.packageList, args, sel)
 				if err != nil {
 					hlog.FromRequest(r).Error().Err(err).Interface("args", args).Msg("unsupported os")
 					// generic unsupported metric
@@ -70,6 +96,61 @@ func (s *Server) agentPackage() http.Handler {
 					return
 				}
 
+				// the package configuration rule matched, e.g. range (>=16.04 <18.04)
+				if pkg.Match != nil {
+					w.Header().Set("X-Package-Match", pkg.Match.String())
+				}
+
+				// platform lifecycle, the warning is only in headers for text
+				// responses (the text format is parsed by cosi-install)
+				s.stats.Increment(fmt.Sprintf("%s`status`%s", r.URL.Path, pkg.Status))
+				if pkg.Status != packages.StatusSupported {
+					s.stats.Increment(fmt.Sprintf("%s`status`%s`%s`%s`%s`%s", r.URL.Path, pkg.Status, args.osType, args.osDistro, args.osVers, args.sysArch))
+					w.Header().Set("X-Platform-Status", pkg.Status)
+					w.Header().Set("Warning", fmt.Sprintf("299 cosi-server %q", pkg.Warning))
+				}
+				if pkg.Status == packages.StatusBlocked {
+					hlog.FromRequest(r).Warn().Interface("args", args).Str("warning", pkg.Warning).Msg("blocked platform")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusGone))
+					http.Error(w, pkg.Warning, http.StatusGone)
+					return
+				}
+				if pkg.Status != packages.StatusSupported {
+					hlog.FromRequest(r).Info().Interface("args", args).Str("status", pkg.Status).Msg("platform not supported")
+				}
+				// mirrored packages are served by this server rather than upstream
+				if s.mirror != nil && pkg.File != "" {
+					if _, ok := c.mirrorFiles[pkg.File]; ok {
+						pkg.URL = s.packagesURL(r)
+					}
+				}
+				// local package repository (yum baseurl, apt repository url), served
+				// by this server whatever the package url (upstream, region mirror)
+				if c.repos != nil && pkg.File != "" {
+					dist := args.osDistro
+					if pkg.Match != nil && pkg.Match.Dist != "" {
+						dist = pkg.Match.Dist
+					}
+					if ref, ok := c.repos.Repo(pkg.File, dist); ok {
+						pkg.Repo = &packages.Repo{Type: ref.Type, URL: s.packagesURL(r) + ref.Path}
+					}
+				}
+				// release channel
+				s.stats.Increment(fmt.Sprintf("%s`channel`%s", r.URL.Path, pkg.Channel))
+				// region mirror
+				if c.regions != nil {
+					w.Header().Set("X-Package-Region", pkgRegion)
+					s.stats.Increment(fmt.Sprintf("%s`region`%s", r.URL.Path, pkgRegion))
+				}
+				// package type
+				s.stats.Increment(fmt.Sprintf("%s`package_type`%s", r.URL.Path, pkg.Type))
+				// canary rollout, stable or canary package served
+				if pkg.Rollout != "" {
+					w.Header().Set("X-Package-Rollout", pkg.Rollout)
+					s.stats.Increment(fmt.Sprintf("%s`rollout`%s", r.URL.Path, pkg.Rollout))
+					s.stats.Increment(fmt.Sprintf("%s`rollout`%s`%s%s", r.URL.Path, pkg.Rollout, pkg.File, pkg.Name))
+				}
+
 				// handle redirect
 				if _, ok := r.URL.Query()["redirect"]; ok {
 					if pkg.URL != "" && pkg.File != "" {
@@ -104,13 +185,34 @@ func (s *Server) agentPackage() http.Handler {
 				w.Header().Set("Content-Type", "text/plain")
 				// NOTE: do **not** return a line ending with result string - the script is
 				//       parsing a compound result from request plus status code from curl.
-				if s.solarisrx.MatchString(args.osDistro) {
+				if textFormat == textFormatTyped {
+					fmt.Fprint(w, strings.Join([]string{
+						strconv.Itoa(textFormat),
+						pkg.Type,
+						pkg.URL,
+						pkg.File,
+						pkg.SHA256,
+						pkg.SignatureURL,
+						pkg.Name,
+						pkg.PubName,
+						pkg.PubURL,
+					}, sep))
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
+					return
+				}
+				dist := args.osDistro
+				if pkg.Match != nil && pkg.Match.Dist != "" {
+					dist = pkg.Match.Dist // alternate distro package
+				}
+				if s.solarisrx.MatchString(dist) {
 					// pkg based os - package name, publishser, publisher url
 					fmt.Fprintf(w, "%s%s%s%s%s", pkg.Name, sep, pkg.PubName, sep, pkg.PubURL)
 					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
 					return
 				}
-				// rpm or deb - package url and package file name
+				// rpm or deb - package url and package file name, only, installers
+				// reject any other number of fields (sha256 and signature url are
+				// in the json and typed text responses)
 				fmt.Fprintf(w, "%s%s%s", pkg.URL, sep, pkg.File)
 				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
 			}),
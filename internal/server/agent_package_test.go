@@ -8,9 +8,13 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/circonus-labs/cosi-server/internal/config"
@@ -57,6 +61,9 @@ func TestAgentPackage(t *testing.T) {
 		{"GET", map[string]string{}, "/package/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64&redirect", http.StatusTemporaryRedirect, `node-agent/packages/nad-omnibus`},
 		{"GET", map[string]string{"Accept": "application/json"}, "/package/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64", http.StatusOK, ""},
 		{"GET", map[string]string{"Accept": "*/*"}, "/package/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64", http.StatusOK, ""},
+		{"GET", map[string]string{"Accept": "application/json"}, "/package/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64", http.StatusOK, `"match":{"dist":"ubuntu","rule":"exact","vers":"16.04"}`},
+		{"GET", map[string]string{"Accept": "application/json"}, "/package/?type=Linux&dist=Pop&vers=16.04&arch=x86_64&like=ubuntu+debian", http.StatusOK, `"match":{"dist":"ubuntu","rule":"exact","vers":"16.04"}`},
+		{"GET", map[string]string{}, "/package/?type=Linux&dist=Pop&vers=16.04&arch=x86_64", http.StatusNotFound, "unsupported OS Distro (pop)"},
 	}
 
 	for _, tst := range tt {
@@ -75,6 +82,9 @@ func TestAgentPackage(t *testing.T) {
 		if resp.StatusCode != tst.status {
 			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
 		}
+		if resp.StatusCode == http.StatusOK && resp.Header.Get("X-Package-Match") != "exact (16.04)" {
+			t.Fatalf("expected match header, got (%s)", resp.Header.Get("X-Package-Match"))
+		}
 
 		if resp.Header.Get("Accept") == "application/json" {
 			var x map[string]interface{}
@@ -87,3 +97,360 @@ func TestAgentPackage(t *testing.T) {
 		}
 	}
 }
+
+func TestAgentPackageChannels(t *testing.T) {
+	t.Log("Testing agentPackage (channels)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/channels.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+
+	platform := "/package/?type=Linux&dist=Ubuntu&vers=18.04&arch=x86_64"
+	tt := []struct {
+		query  string
+		status int
+		msg    string
+	}{
+		{"", http.StatusOK, `"channel":"stable","agent_version":"1.1.0"`},
+		{"&channel=beta", http.StatusOK, `"channel":"beta","agent_version":"1.2.0-beta.1"`},
+		{"&agent_version=1.0.0", http.StatusOK, `"channel":"stable","agent_version":"1.0.0"`},
+		{"&channel=lts&agent_version=v0.9.5", http.StatusOK, `"channel":"lts","agent_version":"0.9.5"`},
+		{"&channel=nightly", http.StatusNotFound, "unsupported channel (nightly)"},
+		{"&agent_version=3.0.0", http.StatusNotFound, "unsupported agent version (3.0.0)"},
+		{"&channel=be!ta", http.StatusBadRequest, "invalid package 'channel' specified"},
+		{"&agent_version=latest", http.StatusBadRequest, "invalid 'agent_version' specified"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\tGET %s", tst.query)
+
+		req := httptest.NewRequest("GET", "http://cosi"+platform+tst.query, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
+}
+
+func TestAgentPackageCanary(t *testing.T) {
+	t.Log("Testing agentPackage (canary)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/canary.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+
+	tt := []struct {
+		path    string
+		status  int
+		rollout string
+		msg     string
+	}{
+		{"/package/?type=Linux&dist=CentOS&vers=8&arch=x86_64", http.StatusOK, "canary", `"rollout":"canary"`},
+		{"/package/?type=Linux&dist=CentOS&vers=8&arch=x86_64&host_id=abc123", http.StatusOK, "canary", `circonus-agent-1.1.0-1.el8.x86_64.rpm`},
+		{"/package/?type=Linux&dist=Ubuntu&vers=20.04&arch=x86_64&hostname=web01.example.com", http.StatusOK, "stable", `"rollout":"stable"`},
+		{"/package/?type=Linux&dist=Ubuntu&vers=18.04&arch=x86_64&agent_version=1.1.0", http.StatusOK, "canary", `"agent_version":"1.1.0"`},
+		{"/package/?type=Linux&dist=CentOS&vers=8&arch=x86_64&host_id=a/b", http.StatusBadRequest, "", "invalid 'host_id' specified"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\tGET %s", tst.path)
+
+		req := httptest.NewRequest("GET", "http://cosi"+tst.path, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		if resp.Header.Get("X-Package-Rollout") != tst.rollout {
+			t.Fatalf("expected rollout header (%s), got (%s)", tst.rollout, resp.Header.Get("X-Package-Rollout"))
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
+
+	t.Log("\tconsistent per host")
+	{
+		for i := 0; i < 20; i++ {
+			path := fmt.Sprintf("http://cosi/package/?type=Linux&dist=Ubuntu&vers=18.04&arch=x86_64&host_id=host-%d", i)
+			rollout := ""
+			for n := 0; n < 3; n++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+				got := w.Result().Header.Get("X-Package-Rollout")
+				if rollout != "" && got != rollout {
+					t.Fatalf("expected %s, got %s for host-%d", rollout, got, i)
+				}
+				rollout = got
+			}
+		}
+	}
+}
+
+func TestAgentPackageIntegrity(t *testing.T) {
+	t.Log("Testing agentPackage (integrity)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "cosi-packages")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb"), []byte("test"), 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/integrity.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	viper.Set(config.KeyLocalPackages, true)
+	viper.Set(config.KeyLocalPackagePath, dir)
+	viper.Set(config.KeyLocalPackagePrefix, defaults.LocalPackagePrefix)
+	viper.Set(config.KeyLocalPackageRegex, defaults.LocalPackageRegex)
+	defer func() {
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+		viper.Set(config.KeyLocalPackages, false)
+	}()
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+
+	sha := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	tt := []struct {
+		vers   string
+		query  string
+		accept string
+		msg    string
+	}{
+		{"18.04", "", "application/json", `"sha256":"` + sha + `","signature_url":"http://example.com/packages/circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb.asc"`},
+		{"18.04", "&text_format=2", "text/plain", "2%%deb%%http://cosi/packages/%%circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb%%" + sha + "%%http://example.com/packages/circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb.asc%%%%%%"},
+		// the legacy text format is url%%file only, deployed installers
+		// reject any other number of fields
+		{"18.04", "", "text/plain", "http://cosi/packages/%%circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb"},
+		// computed from the local package file
+		{"20.04", "&text_format=2", "text/plain", "2%%deb%%http://cosi/packages/%%circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb%%" + sha + "%%%%%%%%"},
+		{"20.04", "", "text/plain", "http://cosi/packages/%%circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s%s %s", tst.vers, tst.query, tst.accept)
+
+		req := httptest.NewRequest("GET", "http://cosi/package/?type=Linux&dist=Ubuntu&arch=x86_64&vers="+tst.vers+tst.query, nil)
+		req.Header.Set("Accept", tst.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d %s", http.StatusOK, resp.StatusCode, string(body))
+		}
+		if tst.accept == "text/plain" {
+			if string(body) != tst.msg {
+				t.Fatalf("expected '%s', got '%s'", tst.msg, string(body))
+			}
+			if tst.query == "" && len(strings.Split(string(body), "%%")) != 2 {
+				t.Fatalf("expected two fields, got '%s'", string(body))
+			}
+			continue
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
+}
+
+func TestAgentPackageLifecycle(t *testing.T) {
+	t.Log("Testing agentPackage (lifecycle)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/lifecycle.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer func() {
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	}()
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+
+	tt := []struct {
+		query   string
+		accept  string
+		status  int
+		pstatus string
+		warning string
+		msg     string
+	}{
+		{"dist=Ubuntu&vers=20.04", "text/plain", http.StatusOK, "", "", "http://cosi/packages/%%circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb"},
+		{"dist=Ubuntu&vers=16.04", "text/plain", http.StatusOK, "deprecated", `299 cosi-server "ubuntu 16.04 is deprecated, end of life 2099-04-30"`, "http://cosi/packages/%%circonus-agent-1.0.0-1.ubuntu.16.04_x86_64.deb"},
+		{"dist=Ubuntu&vers=16.04", "application/json", http.StatusOK, "deprecated", `299 cosi-server "ubuntu 16.04 is deprecated, end of life 2099-04-30"`, `"status":"deprecated","eol":"2099-04-30","warning":"ubuntu 16.04 is deprecated, end of life 2099-04-30"`},
+		{"dist=Ubuntu&vers=14.04", "application/json", http.StatusOK, "eol", `299 cosi-server "ubuntu 14.04 is end of life (2019-04-30), it is no longer supported"`, `"status":"eol"`},
+		{"dist=CentOS&vers=6", "text/plain", http.StatusGone, "blocked", `299 cosi-server "CentOS 6 is not supported, upgrade to CentOS 7 or later"`, "CentOS 6 is not supported, upgrade to CentOS 7 or later"},
+		{"dist=CentOS&vers=6&redirect", "text/plain", http.StatusGone, "blocked", `299 cosi-server "CentOS 6 is not supported, upgrade to CentOS 7 or later"`, "CentOS 6 is not supported"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.query, tst.accept)
+
+		req := httptest.NewRequest("GET", "http://cosi/package/?type=Linux&arch=x86_64&"+tst.query, nil)
+		req.Header.Set("Accept", tst.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+		}
+		if h := resp.Header.Get("X-Platform-Status"); h != tst.pstatus {
+			t.Fatalf("expected X-Platform-Status '%s', got '%s'", tst.pstatus, h)
+		}
+		if h := resp.Header.Get("Warning"); h != tst.warning {
+			t.Fatalf("expected Warning '%s', got '%s'", tst.warning, h)
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+		// the text format is unchanged
+		if tst.accept == "text/plain" && tst.status == http.StatusOK && bytes.Count(body, []byte("%%")) != 1 {
+			t.Fatalf("unexpected text response (%s)", string(body))
+		}
+	}
+}
+
+func TestAgentPackageType(t *testing.T) {
+	t.Log("Testing agentPackage (package type)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/package_types.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer func() {
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	}()
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+
+	sha := "4a5c1d7e0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5"
+	tt := []struct {
+		query  string
+		accept string
+		status int
+		msg    string
+	}{
+		{"type=Windows&dist=Windows&vers=10.0.17763&arch=AMD64&text_format=2", "text/plain", http.StatusOK, "2%%msi%%http://cosi/packages/%%circonus-agent-1.0.0-x64.msi%%" + sha + "%%%%%%%%"},
+		{"type=FreeBSD&dist=FreeBSD&vers=12.1-RELEASE-p3&arch=amd64&text_format=2", "text/plain", http.StatusOK, "2%%freebsd-pkg%%http://cosi/packages/%%circonus-agent-1.0.0.pkg%%%%%%%%%%"},
+		{"type=FreeBSD&dist=FreeBSD&vers=12.1-RELEASE&arch=amd64", "text/plain", http.StatusOK, "http://cosi/packages/%%circonus-agent-1.0.0.pkg"},
+		{"type=Linux&dist=Ubuntu&vers=18.04&arch=x86_64&text_format=2", "text/plain", http.StatusOK, "2%%tgz%%http://cosi/packages/%%circonus-agent_1.0.0_linux_x86_64.tar.gz%%%%%%%%%%"},
+		{"type=Solaris&dist=OmniOS&vers=r151014&arch=x86_64&text_format=2", "text/plain", http.StatusOK, "2%%ips%%%%%%%%%%field/nad%%circonus%%http://updates.circonus.net/omnios/r151014/"},
+		{"type=Solaris&dist=OmniOS&vers=r151014&arch=x86_64&text_format=1", "text/plain", http.StatusOK, "field/nad%%circonus%%http://updates.circonus.net/omnios/r151014/"},
+		{"type=Linux&dist=Alpine&vers=3.12&arch=x86_64", "application/json", http.StatusOK, `"package_type":"apk"`},
+		{"type=Linux&dist=Alpine&vers=3.12&arch=x86_64&text_format=3", "text/plain", http.StatusBadRequest, "invalid 'text_format' specified"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.query, tst.accept)
+
+		req := httptest.NewRequest("GET", "http://cosi/package/?"+tst.query, nil)
+		req.Header.Set("Accept", tst.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+		}
+		if tst.accept == "text/plain" && tst.status == http.StatusOK {
+			if string(body) != tst.msg {
+				t.Fatalf("expected '%s', got '%s'", tst.msg, string(body))
+			}
+			continue
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"net"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/circonus-labs/cosi-server/internal/region"
+	"github.com/circonus-labs/cosi-server/internal/release"
+	"github.com/circonus-labs/cosi-server/internal/repo"
+	"github.com/circonus-labs/cosi-server/internal/templates"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// content holds everything derived from the package configuration and the
+// content directory. a content snapshot is never modified once built, a
+// reload builds a new snapshot and swaps it in so that in-flight requests
+// finish with the snapshot they started with.
+type content struct {
+	packageList    *packages.Packages
+	templates      *templates.Templates
+	info           serverInfo
+	pkgIndex       *packageIndex                   // local package index, if serving local packages
+	repos          *repo.Repos                     // local package repositories, if generated
+	mirrorFiles    map[string]packages.PackageFile // package files which may be mirrored, by file name
+	regions        *region.Mirrors                 // region package mirrors, if configured
+	trustedProxies []*net.IPNet                    // X-Forwarded-For is trusted from these networks
+}
+
+// loadContent builds a new content snapshot from the current configuration
+func (s *Server) loadContent() (*content, error) {
+	c := content{}
+
+	// load package definitions
+	{
+		p, err := packages.New("")
+		if err != nil {
+			return nil, errors.Wrap(err, "initializing package list")
+		}
+
+		c.packageList = p
+
+		// server information is static, build it once for serving '/' (index)
+		// requests, platforms are added per request (lifecycle status changes
+		// when an eol date passes)
+		c.info = serverInfo{
+			Description: "Circonus One Step Install Server",
+			Supported:   p.ListSupported(),
+			Version:     release.VERSION,
+		}
+
+		if s.mirror != nil {
+			c.mirrorFiles = map[string]packages.PackageFile{}
+			for _, pf := range p.Files() {
+				c.mirrorFiles[pf.File] = pf
+			}
+		}
+
+		if viper.GetBool(config.KeyLocalPackages) {
+			idx, err := buildPackageIndex(viper.GetString(config.KeyLocalPackagePath))
+			if err != nil {
+				return nil, errors.Wrap(err, "building local package index")
+			}
+			c.pkgIndex = idx
+			p.SetChecksums(idx.checksums)
+
+			if viper.GetBool(config.KeyLocalPackageRepos) {
+				r, err := repo.Build(viper.GetString(config.KeyLocalPackagePath))
+				if err != nil {
+					return nil, errors.Wrap(err, "building local package repositories")
+				}
+				c.repos = r
+			}
+		}
+	}
+
+	// region mirrors, health state carried over from the current content
+	{
+		var prev *region.Mirrors
+		if cur := s.snapshot(); cur != nil {
+			prev = cur.regions
+		}
+		m, proxies, err := loadRegions(prev)
+		if err != nil {
+			return nil, errors.Wrap(err, "initializing region mirrors")
+		}
+		c.regions = m
+		c.trustedProxies = proxies
+	}
+
+	// load templates
+	{
+		t, err := templates.New(s.stats)
+		if err != nil {
+			return nil, errors.Wrap(err, "initializing templates")
+		}
+		c.templates = t
+	}
+
+	return &c, nil
+}
+
+// snapshot returns the content currently being served
+func (s *Server) snapshot() *content {
+	s.contentMu.RLock()
+	defer s.contentMu.RUnlock()
+	return s.content
+}
+
+// Reload reads the configuration file again and rebuilds the package list,
+// templates, server info, local package index, local package repositories
+// and region mirrors. If the configuration file or any part fails to load,
+// the current content is retained and the error is returned. Settings used
+// only at startup (listen addresses, ssl, statsd, parameter validators,
+// distro aliases, package mirror, template cache and watcher enablement,
+// region mirror health check interval) require a restart.
+func (s *Server) Reload() error {
+	s.logger.Info().Msg("reloading content")
+
+	if f := viper.ConfigFileUsed(); f != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			s.logger.Error().Err(err).Str("config_file", f).Msg("reload failed, keeping current content")
+			s.stats.Increment("reload`error")
+			return errors.Wrap(err, "reloading config file")
+		}
+	}
+
+	c, err := s.loadContent()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("reload failed, keeping current content")
+		s.stats.Increment("reload`error")
+		return errors.Wrap(err, "reloading content")
+	}
+
+	s.contentMu.Lock()
+	s.content = c
+	s.contentMu.Unlock()
+
+	// health check the new region mirrors, watch the new template directory
+	for _, reloaded := range []chan struct{}{s.regionsReloaded, s.templatesReloaded} {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	}
+
+	s.logger.Info().Msg("content reloaded")
+	s.stats.Increment("reload`ok")
+	return nil
+}
+
+// evictTemplate removes a template from the template cache of the current
+// content, called by the template watcher when a template file changes
+func (s *Server) evictTemplate(id string) {
+	n := s.snapshot().templates.Evict(id)
+	s.logger.Debug().Str("id", id).Int("entries", n).Msg("template evicted")
+	s.stats.Increment("template`evict")
+}
+
+// flushTemplates removes all templates from the template cache of the current
+// content, called by the template watcher when a template directory is removed
+func (s *Server) flushTemplates() {
+	n := s.snapshot().templates.Flush()
+	s.logger.Debug().Int("entries", n).Msg("templates flushed")
+	s.stats.Increment("template`flush")
+}
+
+// watchTemplates runs the template watcher for the template directory of the
+// current content until ctx is done, the watcher is restarted when a reload
+// changes the template directory (content_path)
+func (s *Server) watchTemplates(ctx context.Context) {
+	for {
+		dir := s.snapshot().templates.Dir()
+		wctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+
+		w, err := templates.NewWatcher(dir, s.evictTemplate, s.flushTemplates)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("dir", dir).Msg("template watcher disabled")
+			close(done)
+		} else {
+			go func() {
+				defer close(done)
+				w.Start(wctx)
+			}()
+		}
+		s.watcherMu.Lock()
+		s.watcher = w
+		s.watcherMu.Unlock()
+
+		changed := false
+		for !changed {
+			select {
+			case <-ctx.Done():
+				cancel()
+				<-done
+				return
+			case <-s.templatesReloaded:
+				changed = s.snapshot().templates.Dir() != dir
+			}
+		}
+
+		s.logger.Info().Str("dir", dir).Str("new_dir", s.snapshot().templates.Dir()).Msg("template directory changed, restarting watcher")
+		cancel()
+		<-done
+	}
+}
+
+// templateWatcher returns the running template watcher, nil if none
+func (s *Server) templateWatcher() *templates.Watcher {
+	s.watcherMu.RLock()
+	defer s.watcherMu.RUnlock()
+	return s.watcher
+}
@@ -0,0 +1,74 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/circonus-labs/cosi-server/internal/coverage"
+	"github.com/rs/zerolog/hlog"
+	"github.com/xi2/httpgzip"
+)
+
+func (s *Server) coverage() http.Handler {
+	return httpgzip.NewHandler(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/admin/coverage/" {
+					hlog.FromRequest(r).Error().Msg("not found")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+					http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+					return
+				}
+				if r.Method != http.MethodGet {
+					hlog.FromRequest(r).Error().Str("method", r.Method).Msg("invalid method")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusMethodNotAllowed))
+					http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+					return
+				}
+
+				format := r.URL.Query().Get("format")
+				contentType := "application/json"
+				switch format {
+				case "", "json":
+					format = "json"
+				case "csv":
+					contentType = "text/csv"
+				case "table":
+					contentType = "text/plain"
+				default:
+					hlog.FromRequest(r).Error().Str("format", format).Msg("invalid format")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusBadRequest))
+					http.Error(w, "invalid format", http.StatusBadRequest)
+					return
+				}
+
+				c := s.snapshot()
+				report, err := coverage.Build(c.packageList, c.templates)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("building coverage report")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusInternalServerError))
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				var buf bytes.Buffer
+				if err := report.Write(&buf, format); err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("encoding coverage report")
+					s.stats.Increment(fmt.Sprintf("%s`%d`encode_err", r.URL.Path, http.StatusInternalServerError))
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				w.Header().Set("Content-Type", contentType)
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(buf.Bytes())
+				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
+			}),
+		nil)
+}
@@ -0,0 +1,74 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestCoverage(t *testing.T) {
+	t.Log("Testing coverage")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.coverage()
+
+	tt := []struct {
+		method      string
+		path        string
+		status      int
+		contentType string
+		msg         string
+	}{
+		{"GET", "/admin/coverage", http.StatusNotFound, "", "Not Found"},
+		{"POST", "/admin/coverage/", http.StatusMethodNotAllowed, "", "Method Not Allowed"},
+		{"GET", "/admin/coverage/?format=xml", http.StatusBadRequest, "", "invalid format"},
+		{"GET", "/admin/coverage/", http.StatusOK, "application/json", `"levels": {`},
+		{"GET", "/admin/coverage/?format=csv", http.StatusOK, "text/csv", "linux/ubuntu/16.04/x86_64,"},
+		{"GET", "/admin/coverage/?format=table", http.StatusOK, "text/plain", "PLATFORM"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.method, tst.path)
+
+		req := httptest.NewRequest(tst.method, "http://cosi"+tst.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+
+		if tst.contentType != "" && resp.Header.Get("Content-Type") != tst.contentType {
+			t.Fatalf("expected %s, got %s", tst.contentType, resp.Header.Get("Content-Type"))
+		}
+
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
+}
@@ -6,6 +6,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -30,9 +31,25 @@ func (s *Server) index() http.Handler {
 					return
 				}
 
+				c := s.snapshot()
+				info := c.info
+				info.Platforms = c.packageList.SupportedPlatforms()
+				if w := s.templateWatcher(); w != nil {
+					ws := w.Status()
+					info.TemplateWatcher = &ws
+				}
+
+				data, err := json.Marshal(info)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("json encoding")
+					s.stats.Increment(fmt.Sprintf("%s`%d`encode_err", r.URL.Path, http.StatusInternalServerError))
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusOK)
-				fmt.Fprintln(w, s.info)
+				fmt.Fprintln(w, string(data))
 				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
 			}),
 		nil)
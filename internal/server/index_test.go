@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/alexcesaro/statsd"
+	"github.com/circonus-labs/cosi-server/internal/packages"
 	"github.com/rs/zerolog"
 )
 
@@ -20,8 +21,12 @@ func TestIndex(t *testing.T) {
 	t.Log("Testing / handler")
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 
+	p, err := packages.New("../packages/testdata/valid.yaml")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
 	c, _ := statsd.New()
-	s := &Server{info: "foobar", stats: c}
+	s := &Server{content: &content{info: serverInfo{Description: "foobar"}, packageList: p}, stats: c}
 	handler := s.index()
 
 	tt := []struct {
@@ -33,6 +38,7 @@ func TestIndex(t *testing.T) {
 		{"GET", "/foo", http.StatusNotFound, "Not Found"},
 		{"POST", "/", http.StatusMethodNotAllowed, "Method Not Allowed"},
 		{"GET", "/", http.StatusOK, "foobar"},
+		{"GET", "/", http.StatusOK, `"platforms":[{"type":"linux","dist":"ubuntu","vers":"16.04","arch":"x86_64"`},
 	}
 
 	for _, tst := range tt {
@@ -10,10 +10,16 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/alexcesaro/statsd"
 	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -59,3 +65,237 @@ func TestInstall(t *testing.T) {
 	}
 
 }
+
+// installerFunc returns the source of a cosi-install function
+func installerFunc(t *testing.T, name string) string {
+	t.Helper()
+
+	script, err := ioutil.ReadFile("../../content/files/cosi-install.sh")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	start := bytes.Index(script, []byte("\n"+name+"() {\n"))
+	if start == -1 {
+		t.Fatalf("%s not found in cosi-install.sh", name)
+	}
+	end := bytes.Index(script[start:], []byte("\n}\n"))
+	if end == -1 {
+		t.Fatalf("end of %s not found in cosi-install.sh", name)
+	}
+	return string(script[start : start+end+3])
+}
+
+// installerLookupOS runs the cosi-install __lookup_os function with curl
+// returning body and status, returns the script output
+func installerLookupOS(t *testing.T, body string, status int) (string, error) {
+	t.Helper()
+
+	harness := strings.Join([]string{
+		"set -o errexit",
+		`fail() { printf "FAIL: %b\n" "$*"; exit 1; }`,
+		`pass() { printf "PASS: %b\n" "$*"; }`,
+		"log() { :; }",
+		"log_only() { :; }",
+		`curl() { printf '%s|%s' "$COSI_TEST_BODY" "$COSI_TEST_STATUS"; }`,
+		"cosi_curl_timeout=1 cosi_url=http://cosi/",
+		"cosi_os_type=Linux cosi_os_dist=CentOS cosi_os_vers=6 cosi_os_arch=x86_64",
+		installerFunc(t, "__lookup_os"),
+		"__lookup_os",
+		`printf "INFO: %s\n" "${cosi_agent_package_info[@]}"`,
+	}, "\n")
+
+	cmd := exec.Command("bash", "-c", harness)
+	cmd.Env = append(os.Environ(), "COSI_TEST_BODY="+body, "COSI_TEST_STATUS="+strconv.Itoa(status))
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestInstallLookupOS(t *testing.T) {
+	t.Log("Testing cosi-install package response parsing")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/lifecycle.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer func() {
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	}()
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+
+	tt := []struct {
+		query     string
+		status    int
+		shouldErr bool
+		msg       string
+	}{
+		{"dist=Ubuntu&vers=20.04&text_format=2", http.StatusOK, false, "INFO: circonus-agent-1.0.0-1.ubuntu.20.04_x86_64.deb"},
+		{"dist=Ubuntu&vers=20.04", http.StatusOK, false, "INFO: http://cosi/packages/"},
+		{"dist=CentOS&vers=6&text_format=2", http.StatusGone, true, "is no longer supported\nmessage: CentOS 6 is not supported, upgrade to CentOS 7 or later\n"},
+		{"dist=Debian&vers=10&text_format=2", http.StatusNotFound, true, "API result - http result code: 404"},
+		{"dist=Ubuntu&vers=20.04&text_format=3", http.StatusBadRequest, true, "API result - http result code: 400\nmessage: invalid 'text_format' specified\n"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.query)
+
+		req := httptest.NewRequest("GET", "http://cosi/package/?type=Linux&arch=x86_64&"+tst.query, nil)
+		req.Header.Set("Accept", "text/plain")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+		}
+
+		out, err := installerLookupOS(t, string(body), resp.StatusCode)
+		if tst.shouldErr && err == nil {
+			t.Fatalf("expected error (%s)", out)
+		}
+		if !tst.shouldErr && err != nil {
+			t.Fatalf("expected NO error, got %v (%s)", err, out)
+		}
+		if strings.Contains(out, "Unexpected response") {
+			t.Fatalf("response not parsed (%s)", out)
+		}
+		if !strings.Contains(out, tst.msg) {
+			t.Fatalf("output missing '%s' (%s)", tst.msg, out)
+		}
+	}
+}
+
+func TestInstallVerifySignature(t *testing.T) {
+	t.Log("Testing cosi-install package signature verification")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	dir, err := ioutil.TempDir("", "cosi-install")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// signing key, package and signatures served by the curl stub from dir
+	gpgHome := filepath.Join(dir, "gnupg")
+	if err := os.Mkdir(gpgHome, 0700); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	defer func() { _ = exec.Command("gpgconf", "--homedir", gpgHome, "--kill", "all").Run() }()
+	pkgFile := "circonus-agent-1.0.0-1.el7.x86_64.rpm"
+	if err := ioutil.WriteFile(filepath.Join(dir, pkgFile), []byte("package"), 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other"), []byte("other package"), 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	for _, args := range [][]string{
+		{"--quick-gen-key", "cosi test <test@example.com>", "ed25519", "sign", "never"},
+		{"--armor", "--output", filepath.Join(dir, "key.asc"), "--export"},
+		{"--output", filepath.Join(dir, pkgFile+".sig"), "--detach-sign", filepath.Join(dir, pkgFile)},
+		{"--output", filepath.Join(dir, "bad.sig"), "--detach-sign", filepath.Join(dir, "other")},
+	} {
+		cmd := exec.Command("gpg", append([]string{"--homedir", gpgHome, "--batch", "--passphrase", ""}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("gpg %v: %v (%s)", args, err, string(out))
+		}
+	}
+
+	tt := []struct {
+		desc      string
+		key       string
+		sig       string
+		shouldErr bool
+		msg       string
+	}{
+		{"no signature", "key.asc", "", false, "PASS: \tFound existing"},
+		{"no package key", "", pkgFile + ".sig", false, "signature not verified"},
+		{"valid signature", "key.asc", pkgFile + ".sig", false, "Verified package signature"},
+		{"invalid signature", "key.asc", "bad.sig", true, "Package signature verification failed"},
+		{"missing signature", "key.asc", "missing.sig", true, "Unable to download signature"},
+		{"missing package key", "missing.asc", pkgFile + ".sig", true, "not found"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+
+		cache := filepath.Join(dir, "cache")
+		if err := os.RemoveAll(cache); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if err := os.Mkdir(cache, 0755); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(cache, pkgFile), []byte("package"), 0644); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+
+		key := ""
+		if tst.key != "" {
+			key = filepath.Join(dir, tst.key)
+		}
+		sigURL := ""
+		if tst.sig != "" {
+			sigURL = "http://cosi/packages/" + tst.sig
+		}
+
+		harness := strings.Join([]string{
+			"set -o errexit",
+			`fail() { printf "FAIL: %b\n" "$*"; exit 1; }`,
+			`pass() { printf "PASS: %b\n" "$*"; }`,
+			`log() { printf "LOG: %b\n" "$*"; }`,
+			"log_only() { :; }",
+			`curl() { local u="" o=""; while (( $# > 0 )); do case "$1" in (-o) o="$2"; shift ;; (-m) shift ;; (-*) ;; (*) u="$1" ;; esac; shift; done; cp "$COSI_TEST_DIR/${u##*/}" "$o" 2>/dev/null; }`,
+			`cosi_curl_timeout=1 cosi_install_log=/dev/null cosi_cache_dir="$COSI_TEST_DIR/cache" cosi_package_key="$COSI_TEST_KEY"`,
+			`cosi_agent_package_info=("http://cosi/packages/" "` + pkgFile + `" "" "$COSI_TEST_SIG")`,
+			installerFunc(t, "__download_package"),
+			installerFunc(t, "__verify_package_signature"),
+			"__download_package",
+		}, "\n")
+
+		cmd := exec.Command("bash", "-c", harness)
+		cmd.Env = append(os.Environ(), "COSI_TEST_DIR="+dir, "COSI_TEST_KEY="+key, "COSI_TEST_SIG="+sigURL)
+		b, err := cmd.CombinedOutput()
+		out := string(b)
+
+		if tst.shouldErr && err == nil {
+			t.Fatalf("expected error (%s)", out)
+		}
+		if !tst.shouldErr && err != nil {
+			t.Fatalf("expected NO error, got %v (%s)", err, out)
+		}
+		if !strings.Contains(out, tst.msg) {
+			t.Fatalf("output missing '%s' (%s)", tst.msg, out)
+		}
+		// the signature is only downloaded to be verified
+		if tst.key == "" {
+			if _, err := os.Stat(filepath.Join(cache, pkgFile+".sig")); err == nil {
+				t.Fatal("expected signature to not be downloaded")
+			}
+		}
+	}
+}
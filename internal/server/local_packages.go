@@ -0,0 +1,210 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/repo"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/hlog"
+	"github.com/xi2/httpgzip"
+)
+
+// packageDirDelay is how long the package directory must be quiet, after a
+// change, before content is reloaded (package files are large, copying one
+// generates many write events)
+var packageDirDelay = 2 * time.Second
+
+// localPackages serves the local package index (html, json, atom) and
+// repository metadata from memory and the package files from the local
+// package directory
+func (s *Server) localPackages(pkgDir string) http.Handler {
+	files := http.StripPrefix(`/packages/`, http.FileServer(http.Dir(pkgDir)))
+	index := httpgzip.NewHandler(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					hlog.FromRequest(r).Error().Str("method", r.Method).Msg("invalid method")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusMethodNotAllowed))
+					http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+					return
+				}
+
+				idx := s.snapshot().pkgIndex
+				if idx == nil {
+					hlog.FromRequest(r).Error().Msg("no local package index")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+					http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+					return
+				}
+
+				var data []byte
+				switch r.URL.Path {
+				case "/packages/index.json":
+					w.Header().Set("Content-Type", "application/json")
+					data = idx.json
+				case "/packages/index.atom":
+					w.Header().Set("Content-Type", "application/atom+xml")
+					data = idx.atom
+				default:
+					w.Header().Set("Content-Type", "text/html; charset=utf-8")
+					data = idx.html
+				}
+
+				w.Header().Set("Cache-Control", "public, max-age=300")
+				w.WriteHeader(http.StatusOK)
+				if r.Method == http.MethodGet {
+					_, _ = w.Write(data)
+				}
+				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
+			}),
+		nil)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/packages/", r.URL.Path == "/packages/index.html", r.URL.Path == "/packages/index.json", r.URL.Path == "/packages/index.atom":
+			index.ServeHTTP(w, r)
+		case strings.HasPrefix(r.URL.Path, "/packages/"+repo.TypeYum+"/"), strings.HasPrefix(r.URL.Path, "/packages/"+repo.TypeApt+"/"):
+			s.repoContent(pkgDir, w, r)
+		default:
+			// package files not in the local package directory are mirrored
+			if s.mirror != nil {
+				if _, err := os.Stat(filepath.Join(pkgDir, path.Base(r.URL.Path))); os.IsNotExist(err) {
+					s.mirrorPackage(w, r)
+					return
+				}
+			}
+			files.ServeHTTP(w, r)
+		}
+	})
+}
+
+// repoContent serves generated yum and apt repository metadata from memory
+// and repository package paths from the local package directory
+func (s *Server) repoContent(pkgDir string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		hlog.FromRequest(r).Error().Str("method", r.Method).Msg("invalid method")
+		s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusMethodNotAllowed))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	repos := s.snapshot().repos
+	if repos == nil {
+		hlog.FromRequest(r).Error().Msg("local package repositories not enabled")
+		s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	p := strings.TrimPrefix(r.URL.Path, "/packages/")
+
+	if name, ok := repos.File(p); ok {
+		http.ServeFile(w, r, filepath.Join(pkgDir, name))
+		return
+	}
+
+	data, ok := repos.Metadata(p)
+	if !ok {
+		hlog.FromRequest(r).Error().Msg("not found")
+		s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	switch path.Ext(p) {
+	case ".xml":
+		w.Header().Set("Content-Type", "application/xml")
+	case ".gz":
+		w.Header().Set("Content-Type", "application/gzip")
+	default: // apt Packages, Release
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	// metadata changes whenever the packages do, clients must revalidate
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+	s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
+}
+
+// watchPackageDir reloads content when files in the local package directory
+// are created, changed or removed, until the context is cancelled
+func (s *Server) watchPackageDir(ctx context.Context, pkgDir string) error {
+	if pkgDir == "" {
+		return errors.New("invalid package path (empty)")
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "creating fs watcher")
+	}
+	defer fsw.Close()
+
+	if err := fsw.Add(pkgDir); err != nil {
+		return errors.Wrapf(err, "watching %s", pkgDir)
+	}
+
+	s.logger.Info().Str("dir", pkgDir).Msg("watching local packages")
+
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+	)
+	defer func() {
+		mu.Lock()
+		if timer != nil {
+			timer.Stop()
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			s.logger.Debug().Str("file", filepath.Base(event.Name)).Str("op", event.Op.String()).Msg("local package change")
+			mu.Lock()
+			if timer == nil {
+				timer = time.AfterFunc(packageDirDelay, func() {
+					mu.Lock()
+					timer = nil
+					mu.Unlock()
+					// errors are logged, the current content continues to be served
+					_ = s.Reload()
+				})
+			} else {
+				timer.Reset(packageDirDelay)
+			}
+			mu.Unlock()
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			s.logger.Warn().Err(err).Msg("local package watcher")
+		}
+	}
+}
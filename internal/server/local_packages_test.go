@@ -0,0 +1,293 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// localPackageServer returns a server serving local packages from a
+// temporary directory, the caller removes the directory
+func localPackageServer(t *testing.T) (*Server, string) {
+	dir, err := ioutil.TempDir("", "cosi-packages")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb"), []byte("test"), 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	viper.Set(config.KeyLocalPackages, true)
+	viper.Set(config.KeyLocalPackagePath, dir)
+	viper.Set(config.KeyLocalPackagePrefix, defaults.LocalPackagePrefix)
+	viper.Set(config.KeyLocalPackageRegex, defaults.LocalPackageRegex)
+
+	s, err := New()
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	return s, dir
+}
+
+func TestLocalPackages(t *testing.T) {
+	t.Log("Testing localPackages")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	s, dir := localPackageServer(t)
+	defer os.RemoveAll(dir)
+	defer viper.Set(config.KeyLocalPackages, false)
+
+	handler := s.localPackages(dir)
+
+	tt := []struct {
+		method      string
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"GET", "/packages/", http.StatusOK, "text/html; charset=utf-8", `<a href="circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb">`},
+		{"GET", "/packages/index.html", http.StatusOK, "text/html; charset=utf-8", `<h4>v1.0.0</h4>`},
+		{"GET", "/packages/index.json", http.StatusOK, "application/json", `"sha256":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`},
+		{"GET", "/packages/index.atom", http.StatusOK, "application/atom+xml", `<title>v1.0.0</title>`},
+		{"GET", "/packages/circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb", http.StatusOK, "", "test"},
+		{"GET", "/packages/missing.deb", http.StatusNotFound, "", ""},
+		{"POST", "/packages/index.json", http.StatusMethodNotAllowed, "", ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.method, tst.path)
+
+		req := httptest.NewRequest(tst.method, "http://cosi"+tst.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+		}
+		if tst.contentType != "" && resp.Header.Get("Content-Type") != tst.contentType {
+			t.Fatalf("expected content type %s, got %s", tst.contentType, resp.Header.Get("Content-Type"))
+		}
+		if !bytes.Contains(body, []byte(tst.body)) {
+			t.Fatalf("body missing '%s' (%s)", tst.body, string(body))
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "index.html")); !os.IsNotExist(err) {
+		t.Fatal("expected no index.html written to package directory")
+	}
+}
+
+func TestWatchPackageDir(t *testing.T) {
+	t.Log("Testing watchPackageDir")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	s, dir := localPackageServer(t)
+	defer os.RemoveAll(dir)
+	defer viper.Set(config.KeyLocalPackages, false)
+
+	t.Log("\tinvalid dir")
+	{
+		if err := s.watchPackageDir(context.Background(), ""); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	delay := packageDirDelay
+	packageDirDelay = 10 * time.Millisecond
+	defer func() { packageDirDelay = delay }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.watchPackageDir(ctx, dir) }()
+
+	// let the watch be established
+	time.Sleep(50 * time.Millisecond)
+
+	t.Log("\tnew package")
+	{
+		file := "circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb"
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte("test"), 0644); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, ok := s.snapshot().pkgIndex.checksums[file]; ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expected package index to be rebuilt")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+}
+
+func TestLocalPackageRepos(t *testing.T) {
+	t.Log("Testing localPackages (repositories)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	s, dir := localPackageServer(t)
+	defer os.RemoveAll(dir)
+	defer viper.Set(config.KeyLocalPackages, false)
+
+	t.Log("\tnot enabled")
+	{
+		req := httptest.NewRequest("GET", "http://cosi/packages/apt/ubuntu/18.04/dists/stable/Release", nil)
+		w := httptest.NewRecorder()
+		s.localPackages(dir).ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+		}
+	}
+
+	deb := "circonus-agent-1.0.0-1.ubuntu.18.04_x86_64.deb"
+	data, err := ioutil.ReadFile(filepath.Join("..", "repo", "testdata", deb))
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, deb), data, 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	viper.Set(config.KeyLocalPackageRepos, true)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/integrity.yaml")
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	defer func() {
+		viper.Set(config.KeyLocalPackageRepos, false)
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	}()
+	if err := s.Reload(); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.localPackages(dir)
+
+	tt := []struct {
+		method      string
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"GET", "/packages/apt/ubuntu/18.04/dists/stable/Release", http.StatusOK, "text/plain; charset=utf-8", "main/binary-amd64/Packages.gz\n"},
+		{"GET", "/packages/apt/ubuntu/18.04/dists/stable/main/binary-amd64/Packages", http.StatusOK, "text/plain; charset=utf-8", "Filename: pool/" + deb + "\n"},
+		{"GET", "/packages/apt/ubuntu/18.04/dists/stable/main/binary-amd64/Packages.gz", http.StatusOK, "application/gzip", ""},
+		{"HEAD", "/packages/apt/ubuntu/18.04/dists/stable/Release", http.StatusOK, "", ""},
+		{"GET", "/packages/apt/ubuntu/18.04/pool/" + deb, http.StatusOK, "", "debian-binary"},
+		{"GET", "/packages/apt/ubuntu/20.04/dists/stable/Release", http.StatusNotFound, "", ""},
+		{"GET", "/packages/yum/centos/7/repodata/repomd.xml", http.StatusNotFound, "", ""},
+		{"POST", "/packages/apt/ubuntu/18.04/dists/stable/Release", http.StatusMethodNotAllowed, "", ""},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.method, tst.path)
+
+		req := httptest.NewRequest(tst.method, "http://cosi"+tst.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+		}
+		if tst.contentType != "" && resp.Header.Get("Content-Type") != tst.contentType {
+			t.Fatalf("expected content type %s, got %s", tst.contentType, resp.Header.Get("Content-Type"))
+		}
+		if !bytes.Contains(body, []byte(tst.body)) {
+			t.Fatalf("body missing '%s' (%s)", tst.body, string(body))
+		}
+	}
+
+	t.Log("\t/package/ repository")
+	{
+		req := httptest.NewRequest("GET", "http://cosi/package/?type=Linux&dist=Ubuntu&arch=x86_64&vers=18.04", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		s.agentPackage().ServeHTTP(w, req)
+
+		body, _ := ioutil.ReadAll(w.Result().Body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d %s", http.StatusOK, w.Code, string(body))
+		}
+		expect := `"repo":{"type":"apt","url":"http://cosi/packages/apt/ubuntu/18.04/"}`
+		if !bytes.Contains(body, []byte(expect)) {
+			t.Fatalf("body missing '%s' (%s)", expect, string(body))
+		}
+	}
+
+	t.Log("\t/package/ repository, upstream and region mirror package urls")
+	{
+		viper.Set(config.KeyPackageBaseURL, "http://upstream/packages/")
+		viper.Set(config.KeyRegionMirrors, []map[string]interface{}{
+			{"region": "us-east", "url": "http://us-east.mirror/packages/"},
+		})
+		defer viper.Set(config.KeyRegionMirrors, nil)
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+
+		for _, query := range []string{"", "&region=us-east"} {
+			t.Logf("\t\t%s", query)
+			req := httptest.NewRequest("GET", "http://cosi.example.com/package/?type=Linux&dist=Ubuntu&arch=x86_64&vers=18.04"+query, nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			s.agentPackage().ServeHTTP(w, req)
+
+			body, _ := ioutil.ReadAll(w.Result().Body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected %d, got %d %s", http.StatusOK, w.Code, string(body))
+			}
+			expect := `"repo":{"type":"apt","url":"http://cosi.example.com/packages/apt/ubuntu/18.04/"}`
+			if !bytes.Contains(body, []byte(expect)) {
+				t.Fatalf("body missing '%s' (%s)", expect, string(body))
+			}
+			pkgURL := "http://upstream/packages/"
+			if query != "" {
+				pkgURL = "http://us-east.mirror/packages/"
+			}
+			if !bytes.Contains(body, []byte(pkgURL)) {
+				t.Fatalf("body missing '%s' (%s)", pkgURL, string(body))
+			}
+		}
+	}
+}
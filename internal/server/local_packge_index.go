@@ -6,17 +6,27 @@
 package server
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
+	"github.com/circonus-labs/cosi-server/internal/config"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
 )
 
 type Release struct {
@@ -24,21 +34,81 @@ type Release struct {
 	Packages []string
 }
 
-// updateLocalPackageIndex manages the index.html served on the
-// packages/ endpoint when serving packages locally
-func updateLocalPackageIndex(pkgDir string) error {
-	releases, err := scanPackages(pkgDir)
+// packageFile describes a local agent package file
+type packageFile struct {
+	Name   string    `json:"name"`
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256"`
+	MTime  time.Time `json:"mtime"`
+}
+
+// indexRelease is a release in the json package index
+type indexRelease struct {
+	Version string        `json:"version"`
+	Files   []packageFile `json:"files"`
+}
+
+// packageIndex is the local package index, rendered once (on load) and
+// served from memory on the packages/ endpoint
+type packageIndex struct {
+	html      []byte
+	json      []byte
+	atom      []byte
+	checksums map[string]string // sha256 by file name
+}
+
+const agentReleaseURL = "https://github.com/circonus-labs/circonus-agent/releases"
+
+// buildPackageIndex scans the local package directory and renders the
+// html, json and atom package indexes
+func buildPackageIndex(pkgDir string) (*packageIndex, error) {
+	prefix := viper.GetString(config.KeyLocalPackagePrefix)
+	rx, err := regexp.Compile(viper.GetString(config.KeyLocalPackageRegex))
 	if err != nil {
-		return err
+		return nil, errors.Wrap(err, "compiling local package regex")
+	}
+	if rx.NumSubexp() < 1 {
+		return nil, errors.Errorf("invalid local package regex (%s), no version group", rx.String())
 	}
 
-	if err := writeIndex(pkgDir, releases); err != nil {
-		return err
+	files, err := scanPackages(pkgDir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	byName := map[string]packageFile{}
+	for _, f := range files {
+		names = append(names, f.Name)
+		byName[f.Name] = f
 	}
-	return nil
+
+	rels, err := releases(names, rx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := packageIndex{checksums: map[string]string{}}
+	for _, f := range files {
+		idx.checksums[f.Name] = f.SHA256
+	}
+
+	if idx.html, err = renderIndex(rels); err != nil {
+		return nil, errors.Wrap(err, "rendering html index")
+	}
+	if idx.json, err = renderJSONIndex(rels, byName); err != nil {
+		return nil, errors.Wrap(err, "rendering json index")
+	}
+	if idx.atom, err = renderAtomIndex(rels, byName); err != nil {
+		return nil, errors.Wrap(err, "rendering atom index")
+	}
+
+	return &idx, nil
 }
 
-func scanPackages(pkgDir string) ([]Release, error) {
+// scanPackages returns the agent package files (names starting with
+// prefix) in the local package directory, with sizes and checksums
+func scanPackages(pkgDir, prefix string) ([]packageFile, error) {
 	if pkgDir == "" {
 		return nil, errors.New("invalid package path (empty)")
 	}
@@ -48,27 +118,53 @@ func scanPackages(pkgDir string) ([]Release, error) {
 		return nil, err
 	}
 
-	pf := []string{}
+	files := []packageFile{}
 	for _, fi := range fl {
 		if fi.IsDir() {
 			continue
 		}
-		if !strings.HasPrefix(fi.Name(), "circonus-agent") {
+		if !strings.HasPrefix(fi.Name(), prefix) {
 			continue
 		}
 
-		pf = append(pf, fi.Name())
+		sum, err := fileChecksum(path.Join(pkgDir, fi.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "checksum %s", fi.Name())
+		}
+
+		files = append(files, packageFile{
+			Name:   fi.Name(),
+			Size:   fi.Size(),
+			SHA256: sum,
+			MTime:  fi.ModTime().UTC(),
+		})
 	}
 
-	return releases(pf)
+	return files, nil
 }
 
-func releases(packageFiles []string) ([]Release, error) {
+// fileChecksum returns the hex encoded sha256 of a file
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// releases groups package files by the agent version, the first group of
+// rx, newest first
+func releases(packageFiles []string, rx *regexp.Regexp) ([]Release, error) {
 	if len(packageFiles) == 0 {
 		return nil, errors.New("invalid package file list (empty)")
 	}
 
-	rx := regexp.MustCompile(`^circonus-agent-(.+)-1\..+$`)
 	pkgsByVer := map[string][]string{}
 	for _, pkgFileName := range packageFiles {
 		// compensate for semver pre-release versions (e.g. alpha/beta/rc/etc.)
@@ -77,21 +173,11 @@ func releases(packageFiles []string) ([]Release, error) {
 		pkgName := strings.Replace(pkgFileName, `~`, `-`, -1)
 
 		m := rx.FindStringSubmatch(pkgName)
-		if len(m) != 2 {
+		if len(m) < 2 {
 			log.Warn().Str("pkg", pkgName).Str("rx", rx.String()).Msg("package name doesn't match regex, skipping")
 			continue
 		}
 		ver := m[1]
-		// parts := strings.Split(pkgName, "-")
-		// if len(parts) < 3 {
-		// 	continue
-		// }
-		// ver := parts[2]
-		// if len(parts) > 3 {
-		// 	if !strings.HasPrefix(parts[3], `1.`) {
-		// 		ver += "-" + parts[3]
-		// 	}
-		// }
 		if _, ok := pkgsByVer[ver]; !ok {
 			pkgsByVer[ver] = []string{}
 		}
@@ -125,19 +211,23 @@ func releases(packageFiles []string) ([]Release, error) {
 	return releases, nil
 }
 
-func writeIndex(pkgDir string, releases []Release) error {
+// renderIndex returns the html index served on the packages/ endpoint
+func renderIndex(releases []Release) ([]byte, error) {
 	tmplDoc := `
     <!DOCTYPE html>
     <html>
-    <head><title>Circonus Agent Packages</title><meta charset="UTF-8"></head>
+    <head><title>Circonus Agent Packages</title><meta charset="UTF-8">
+    <link rel="alternate" type="application/atom+xml" title="Circonus Agent Releases" href="index.atom">
+    </head>
     <body>
 	<h1>Circonus Agent Packages</h1>
 	<p>
-	Note: These are packages used by cosi only. If target operating system or architecture is 
+	Note: These are packages used by cosi only. If target operating system or architecture is
 	not listed here (e.g. Windows, Illumos, Arm), please check the circonus-agent
-	<a href="https://github.com/circonus-labs/circonus-agent/releases">releases</a> 
+	<a href="https://github.com/circonus-labs/circonus-agent/releases">releases</a>
 	page as there may be an agent available.
 	</p>
+	<p>Machine readable: <a href="index.json">index.json</a>, <a href="index.atom">index.atom</a></p>
     {{range .}}
     <h4>v{{ .Version}}</h4>
     <ul>
@@ -152,18 +242,97 @@ func writeIndex(pkgDir string, releases []Release) error {
 
 	tmpl, err := template.New("index").Parse(tmplDoc)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	f, err := os.Create(path.Join(pkgDir, "index.html"))
-	if err != nil {
-		return err
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, releases); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderJSONIndex returns the json index, releases newest first with the
+// details of each package file
+func renderJSONIndex(releases []Release, files map[string]packageFile) ([]byte, error) {
+	idx := struct {
+		Releases []indexRelease `json:"releases"`
+	}{Releases: make([]indexRelease, 0, len(releases))}
+
+	for _, r := range releases {
+		ir := indexRelease{Version: r.Version, Files: make([]packageFile, 0, len(r.Packages))}
+		for _, name := range r.Packages {
+			ir.Files = append(ir.Files, files[name])
+		}
+		idx.Releases = append(idx.Releases, ir)
+	}
+
+	return json.Marshal(idx)
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Link    []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// renderAtomIndex returns an atom feed of the releases, newest first, a
+// release is updated when its newest package file was modified
+func renderAtomIndex(releases []Release, files map[string]packageFile) ([]byte, error) {
+	feed := atomFeed{
+		Title:  "Circonus Agent Packages",
+		ID:     agentReleaseURL,
+		Author: "Circonus",
+		Link: []atomLink{
+			{Href: "index.atom", Rel: "self"},
+			{Href: agentReleaseURL},
+		},
 	}
 
-	if err := tmpl.Execute(f, releases); err != nil {
-		f.Close()
-		return err
+	var feedUpdated time.Time
+	for _, r := range releases {
+		var updated time.Time
+		for _, name := range r.Packages {
+			if mt := files[name].MTime; mt.After(updated) {
+				updated = mt
+			}
+		}
+		if updated.After(feedUpdated) {
+			feedUpdated = updated
+		}
+		url := fmt.Sprintf("%s/tag/v%s", agentReleaseURL, r.Version)
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   "v" + r.Version,
+			ID:      url,
+			Updated: updated.Format(time.RFC3339),
+			Link:    atomLink{Href: url},
+			Summary: strings.Join(r.Packages, " "),
+		})
+	}
+	feed.Updated = feedUpdated.Format(time.RFC3339)
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
 	}
 
-	return f.Close()
+	return append([]byte(xml.Header), data...), nil
 }
@@ -6,8 +6,19 @@
 package server
 
 import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/spf13/viper"
 )
 
 func Test_releases(t *testing.T) {
@@ -103,7 +114,7 @@ func Test_releases(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := releases(tt.args.packageFiles)
+			got, err := releases(tt.args.packageFiles, regexp.MustCompile(defaults.LocalPackageRegex))
 			if (err != nil) != tt.wantErr {
 				t.Errorf("releases() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -114,3 +125,126 @@ func Test_releases(t *testing.T) {
 		})
 	}
 }
+
+func Test_scanPackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cosi-packages")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"circonus-agent-1.0.0-1.el7.x86_64.rpm": "test",
+		"README":                                "readme",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "circonus-agent-dir"), 0755); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if _, err := scanPackages("", defaults.LocalPackagePrefix); err == nil {
+		t.Fatal("expected error")
+	}
+
+	got, err := scanPackages(dir, defaults.LocalPackagePrefix)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("scanPackages() = %v, want 1 file", got)
+	}
+	want := packageFile{
+		Name:   "circonus-agent-1.0.0-1.el7.x86_64.rpm",
+		Size:   4,
+		SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		MTime:  got[0].MTime,
+	}
+	if got[0] != want || got[0].MTime.IsZero() {
+		t.Fatalf("scanPackages() = %v, want %v", got[0], want)
+	}
+}
+
+func Test_buildPackageIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cosi-packages")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"circonus-agent-1.0.0-1.el7.x86_64.rpm",
+		"circonus-agent-1.1.0-1.el7.x86_64.rpm",
+		"circonus-agent-1.1.0-1.ubuntu.18.04_x86_64.deb",
+		"other-agent-2.0.0-1.el7.x86_64.rpm",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("test"), 0644); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	viper.Set(config.KeyLocalPackagePrefix, defaults.LocalPackagePrefix)
+	viper.Set(config.KeyLocalPackageRegex, defaults.LocalPackageRegex)
+
+	t.Run("invalid regex", func(t *testing.T) {
+		viper.Set(config.KeyLocalPackageRegex, `^circonus-agent-.+$`)
+		defer viper.Set(config.KeyLocalPackageRegex, defaults.LocalPackageRegex)
+		if _, err := buildPackageIndex(dir); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("default prefix", func(t *testing.T) {
+		idx, err := buildPackageIndex(dir)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(idx.checksums) != 3 {
+			t.Fatalf("expected 3 checksums, got %v", idx.checksums)
+		}
+		if !strings.Contains(string(idx.html), `<a href="circonus-agent-1.1.0-1.el7.x86_64.rpm">`) {
+			t.Fatalf("html index missing package\n%s", string(idx.html))
+		}
+
+		var ji struct {
+			Releases []indexRelease `json:"releases"`
+		}
+		if err := json.Unmarshal(idx.json, &ji); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(ji.Releases) != 2 || ji.Releases[0].Version != "1.1.0" || len(ji.Releases[0].Files) != 2 {
+			t.Fatalf("unexpected json index %s", string(idx.json))
+		}
+		f := ji.Releases[1].Files[0]
+		if f.Name != "circonus-agent-1.0.0-1.el7.x86_64.rpm" || f.Size != 4 || f.SHA256 != idx.checksums[f.Name] || f.MTime.IsZero() {
+			t.Fatalf("unexpected json file %#v", f)
+		}
+
+		var feed atomFeed
+		if err := xml.Unmarshal(idx.atom, &feed); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(feed.Entries) != 2 || feed.Entries[0].Title != "v1.1.0" || feed.Entries[0].ID != agentReleaseURL+"/tag/v1.1.0" {
+			t.Fatalf("unexpected atom feed %s", string(idx.atom))
+		}
+	})
+
+	t.Run("configured prefix and regex", func(t *testing.T) {
+		viper.Set(config.KeyLocalPackagePrefix, "other-agent")
+		viper.Set(config.KeyLocalPackageRegex, `^other-agent-(.+)-1\..+$`)
+		defer func() {
+			viper.Set(config.KeyLocalPackagePrefix, defaults.LocalPackagePrefix)
+			viper.Set(config.KeyLocalPackageRegex, defaults.LocalPackageRegex)
+		}()
+		idx, err := buildPackageIndex(dir)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(idx.checksums) != 1 || !strings.Contains(string(idx.json), `"version":"2.0.0"`) {
+			t.Fatalf("unexpected json index %s", string(idx.json))
+		}
+	})
+}
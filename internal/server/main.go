@@ -7,7 +7,6 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"math/rand"
 	"net"
 	"net/http"
@@ -20,10 +19,11 @@ import (
 	"time"
 
 	"github.com/alexcesaro/statsd"
+	"github.com/circonus-labs/cosi-server/api"
 	"github.com/circonus-labs/cosi-server/internal/config"
 	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/circonus-labs/cosi-server/internal/mirror"
 	"github.com/circonus-labs/cosi-server/internal/packages"
-	"github.com/circonus-labs/cosi-server/internal/release"
 	"github.com/circonus-labs/cosi-server/internal/templates"
 	"github.com/justinas/alice"
 	"github.com/pkg/errors"
@@ -36,23 +36,28 @@ import (
 // Server defines the listening servers
 type Server struct {
 	// ctx                 context.Context
-	logger              zerolog.Logger
-	svrHTTP             []*httpServer
-	svrHTTPS            *sslServer
-	packageList         *packages.Packages
-	templates           *templates.Templates
-	info                string
-	typerx              *regexp.Regexp
-	distrx              *regexp.Regexp
-	versrx              *regexp.Regexp
-	vercleanrx          *regexp.Regexp
-	archrx              *regexp.Regexp
-	rhelrx              *regexp.Regexp
-	solarisrx           *regexp.Regexp
-	modepushrx          *regexp.Regexp
-	modepullrx          *regexp.Regexp
-	stats               *statsd.Client
-	templateContentType string
+	logger               zerolog.Logger
+	svrHTTP              []*httpServer
+	svrHTTPS             *sslServer
+	contentMu            sync.RWMutex
+	content              *content
+	watcherMu            sync.RWMutex
+	watcher              *templates.Watcher // template watcher, if running
+	templatesReloaded    chan struct{}      // templates replaced by a reload
+	mirror               *mirror.Mirror     // upstream package mirror, if enabled
+	regionsReloaded      chan struct{}      // region mirrors replaced by a reload
+	typerx               *regexp.Regexp
+	distrx               *regexp.Regexp
+	versrx               *regexp.Regexp
+	vercleanrx           *regexp.Regexp
+	archrx               *regexp.Regexp
+	rhelrx               *regexp.Regexp
+	solarisrx            *regexp.Regexp
+	distroAliases        map[string]string
+	modepushrx           *regexp.Regexp
+	modepullrx           *regexp.Regexp
+	stats                *statsd.Client
+	templateContentTypes map[string]string // content type by template format
 }
 
 type httpServer struct {
@@ -69,9 +74,11 @@ type sslServer struct {
 
 // serverInfo is returned for a / request
 type serverInfo struct {
-	Description string   `json:"description"`
-	Supported   []string `json:"supported"`
-	Version     string   `json:"version"`
+	Description     string                   `json:"description"`
+	Supported       []string                 `json:"supported"` // deprecated, use platforms
+	Platforms       []packages.PlatformInfo  `json:"platforms"`
+	Version         string                   `json:"version"`
+	TemplateWatcher *templates.WatcherStatus `json:"template_watcher,omitempty"`
 }
 
 // params holds validated query parameters
@@ -80,6 +87,7 @@ type params struct {
 	osDistro string
 	osVers   string
 	sysArch  string
+	alts     []templates.Distro // alternate distros, from aliases and like
 }
 
 // templateSpec holds validated template information from url path
@@ -96,8 +104,14 @@ func init() {
 // New creates a new instance of the listening server(s)
 func New() (*Server, error) {
 	s := Server{
-		logger:              log.With().Str("pkg", "server").Logger(),
-		templateContentType: "application/toml",
+		logger:            log.With().Str("pkg", "server").Logger(),
+		regionsReloaded:   make(chan struct{}, 1),
+		templatesReloaded: make(chan struct{}, 1),
+		templateContentTypes: map[string]string{
+			api.TemplateFormatTOML: "application/toml",
+			api.TemplateFormatJSON: "application/json",
+			api.TemplateFormatYAML: "application/x-yaml",
+		},
 	}
 
 	c, err := statsd.New(
@@ -114,43 +128,21 @@ func New() (*Server, error) {
 		return nil, err
 	}
 
-	// load package definitions
-	{
-		p, err := packages.New("")
-		if err != nil {
-			return nil, errors.Wrap(err, "initializing package list")
-		}
-
-		s.packageList = p
-
-		// server information is static, build it once for serving '/' (index) requests
-		i := serverInfo{
-			Description: "Circonus One Step Install Server",
-			Supported:   p.ListSupported(),
-			Version:     release.VERSION,
-		}
-
-		d, err := json.Marshal(i)
+	if viper.GetBool(config.KeyPackageMirror) {
+		m, err := mirror.New(viper.GetString(config.KeyPackageMirrorPath), viper.GetInt64(config.KeyPackageMirrorMaxSize))
 		if err != nil {
-			return nil, errors.Wrap(err, "encoding server info")
-		}
-
-		s.info = string(d)
-
-		if viper.GetBool(config.KeyLocalPackages) {
-			if err := updateLocalPackageIndex(viper.GetString(config.KeyLocalPackagePath)); err != nil {
-				return nil, errors.Wrap(err, "updating local package index")
-			}
+			return nil, errors.Wrap(err, "initializing package mirror")
 		}
+		s.mirror = m
 	}
 
-	// load templates
+	// load package definitions and templates
 	{
-		t, err := templates.New()
+		c, err := s.loadContent()
 		if err != nil {
-			return nil, errors.Wrap(err, "initializing templates")
+			return nil, err
 		}
-		s.templates = t
+		s.content = c
 	}
 
 	chain := alice.New()
@@ -173,10 +165,15 @@ func New() (*Server, error) {
 	router.Handle(`/`, chain.Then(s.index()))
 	router.Handle(`/robots.txt`, chain.Then(s.robots()))
 	router.Handle(`/package/`, chain.Then(s.agentPackage()))
+	router.Handle(`/package/versions/`, chain.Then(s.agentPackageVersions()))
+	router.Handle(`/platforms/`, chain.Then(s.platforms()))
 	if viper.GetBool(config.KeyLocalPackages) {
-		router.Handle(`/packages/`, chain.Then(http.StripPrefix(`/packages/`, http.FileServer(http.Dir(viper.GetString(config.KeyLocalPackagePath))))))
+		router.Handle(`/packages/`, chain.Then(s.localPackages(viper.GetString(config.KeyLocalPackagePath))))
+	} else if s.mirror != nil {
+		router.Handle(`/packages/`, chain.Then(s.mirrorPackages()))
 	}
 	router.Handle(`/template/`, chain.Then(s.template()))
+	router.Handle(`/templates/`, chain.Then(s.templateList()))
 	router.Handle(`/broker/`, chain.Then(s.broker()))
 	router.Handle(`/install/conf/`, chain.Then(s.config())) // TODO: deprecate, in favor of /install/config/
 	router.Handle(`/install/config/`, chain.Then(s.config()))
@@ -186,6 +183,9 @@ func New() (*Server, error) {
 	router.Handle(`/install/`, chain.Then(s.install()))
 	router.Handle(`/utils/`, chain.Then(s.tool())) // TODO: deprecate, in favor of /tool/
 	router.Handle(`/tool/`, chain.Then(s.tool()))
+	if viper.GetBool(config.KeyAdminEndpoints) {
+		router.Handle(`/admin/coverage/`, chain.Then(s.coverage()))
+	}
 
 	// HTTP listener (1-n)
 	{
@@ -260,6 +260,36 @@ func (s *Server) Start() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// template watcher only applies when templates are cached
+	if viper.GetBool(config.KeyWatchTemplates) && viper.GetBool(config.KeyEnableTemplateCache) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchTemplates(ctx)
+		}()
+	}
+
+	// local package index and generated package configuration are rebuilt
+	// when the local package directory changes
+	if viper.GetBool(config.KeyLocalPackages) || viper.GetBool(config.KeyPackageGenerate) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.watchPackageDir(ctx, viper.GetString(config.KeyLocalPackagePath)); err != nil {
+				s.logger.Warn().Err(err).Msg("local package watcher disabled")
+			}
+		}()
+	}
+
+	// unhealthy region mirrors are skipped, a reload may add region mirrors
+	if interval := viper.GetDuration(config.KeyRegionMirrorHealthInterval); interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.checkRegions(ctx, interval)
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		s.startHTTPS(ctx, &wg)
@@ -273,8 +303,16 @@ func (s *Server) Start() error {
 	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range c {
+		if sig == syscall.SIGHUP {
+			// errors are logged, the current content continues to be served
+			_ = s.Reload()
+			continue
+		}
+		break
+	}
+	signal.Stop(c)
 	s.logger.Info().Msg("interrupt, shutting down")
 
 	s.logger.Info().Msg("telling children to stop")
@@ -6,9 +6,16 @@
 package server
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/circonus-labs/cosi-server/internal/config"
 	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
 )
 
 func Test(t *testing.T) {
@@ -16,3 +23,179 @@ func Test(t *testing.T) {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 
 }
+
+func TestReload(t *testing.T) {
+	t.Log("Testing Reload")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\tvalid")
+	{
+		orig := s.snapshot()
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if s.snapshot() == orig {
+			t.Fatal("expected new content snapshot")
+		}
+	}
+
+	t.Log("\tinvalid package config")
+	{
+		orig := s.snapshot()
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/invalid_syntax.yaml")
+		if err := s.Reload(); err == nil {
+			t.Fatal("expected error")
+		}
+		if s.snapshot() != orig {
+			t.Fatal("expected content to be retained")
+		}
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	}
+
+	t.Log("\tinvalid content path")
+	{
+		orig := s.snapshot()
+		viper.Set(config.KeyContentPath, "../templates/testdata/missing")
+		if err := s.Reload(); err == nil {
+			t.Fatal("expected error")
+		}
+		if s.snapshot() != orig {
+			t.Fatal("expected content to be retained")
+		}
+		viper.Set(config.KeyContentPath, "../templates/testdata")
+	}
+
+	t.Log("\tconfig file read again")
+	{
+		dir, err := ioutil.TempDir("", "cosi-config")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		defer os.RemoveAll(dir)
+		cfgFile := filepath.Join(dir, "cosi-server.yaml")
+		if err := ioutil.WriteFile(cfgFile, []byte("---\ntrusted_proxies: []\n"), 0644); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		viper.SetConfigFile(cfgFile)
+		if err := viper.ReadInConfig(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		// viper can not unset a config file, leave an empty one for later tests
+		defer func() {
+			viper.SetConfigFile("testdata/empty.yaml")
+			_ = viper.ReadInConfig()
+		}()
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if s.snapshot().regions != nil {
+			t.Fatal("expected no region mirrors")
+		}
+
+		cfg := "---\nregion_mirrors:\n  - region: us-east\n    url: http://us-east.mirror/packages/\n    networks: [192.0.2.0/24]\n"
+		if err := ioutil.WriteFile(cfgFile, []byte(cfg), 0644); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if m := s.snapshot().regions; m == nil || !m.Has("us-east") {
+			t.Fatal("expected region mirror from config file")
+		}
+
+		orig := s.snapshot()
+		if err := ioutil.WriteFile(cfgFile, []byte("---\nregion_mirrors: [\n"), 0644); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if err := s.Reload(); err == nil {
+			t.Fatal("expected error")
+		}
+		if s.snapshot() != orig {
+			t.Fatal("expected content to be retained")
+		}
+	}
+}
+
+func TestWatchTemplates(t *testing.T) {
+	t.Log("Testing watchTemplates")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir, err := ioutil.TempDir("", "cosi-content")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0755); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer viper.Set(config.KeyContentPath, "../templates/testdata")
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	// waitFor waits for the watcher of a template directory to be running
+	waitFor := func(dir string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if w := s.templateWatcher(); w != nil {
+				if ws := w.Status(); ws.Directory == dir && ws.Running {
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("expected watcher of %s", dir)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.watchTemplates(ctx)
+		close(done)
+	}()
+
+	t.Log("	started")
+	waitFor(filepath.Join("..", "templates", "testdata", "templates"))
+	first := s.templateWatcher()
+
+	t.Log("	reload, same content path")
+	{
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if s.templateWatcher() != first {
+			t.Fatal("expected watcher to not be restarted")
+		}
+	}
+
+	t.Log("	reload, content path changed")
+	{
+		viper.Set(config.KeyContentPath, dir)
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		waitFor(filepath.Join(dir, "templates"))
+		if first.Status().Running {
+			t.Fatal("expected previous watcher to be stopped")
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected watcher to stop")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/rs/zerolog/hlog"
+	"github.com/spf13/viper"
+)
+
+// mirrorPackages serves package files from the package mirror, when local
+// packages are not enabled
+func (s *Server) mirrorPackages() http.Handler {
+	return http.HandlerFunc(s.mirrorPackage)
+}
+
+// mirrorPackage serves a package file of the package configuration from
+// the mirror cache directory, fetching it from upstream if it is not cached
+func (s *Server) mirrorPackage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		hlog.FromRequest(r).Error().Str("method", r.Method).Msg("invalid method")
+		s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusMethodNotAllowed))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// only package files in the package configuration are mirrored, the
+	// mirror is not an open proxy to the upstream servers
+	file := strings.TrimPrefix(r.URL.Path, "/packages/")
+	pf, ok := s.snapshot().mirrorFiles[file]
+	if !ok {
+		hlog.FromRequest(r).Error().Str("file", file).Msg("not a configured package file")
+		s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	f, hit, err := s.mirror.Fetch(r.Context(), pf.File, pf.URL, pf.SHA256)
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Str("file", file).Msg("mirroring package")
+		s.stats.Increment("mirror`error")
+		s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusBadGateway))
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	defer f.Close()
+	if hit {
+		s.stats.Increment("mirror`hit")
+	} else {
+		s.stats.Increment("mirror`miss")
+	}
+
+	// served from the open file, the mirror may evict it meanwhile
+	fi, err := f.Stat()
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Str("file", file).Msg("mirrored package")
+		s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusInternalServerError))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, pf.File, fi.ModTime(), f)
+}
+
+// packagesURL returns the base url of the package files (mirrored, local
+// packages and repositories) served by this server advertised to hosts,
+// package_mirror_url or the /packages/ url of the server the request was
+// made to
+func (s *Server) packagesURL(r *http.Request) string {
+	if u := viper.GetString(config.KeyPackageMirrorURL); u != "" {
+		if !strings.HasSuffix(u, "/") {
+			u += "/"
+		}
+		return u
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/packages/"
+}
@@ -0,0 +1,159 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestMirrorPackages(t *testing.T) {
+	t.Log("Testing mirrorPackages")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	// upstream package server stand-in
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("test"))
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "cosi-mirror")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	viper.Set(config.KeyPackageBaseURL, upstream.URL)
+	viper.Set(config.KeyPackageMirror, true)
+	viper.Set(config.KeyPackageMirrorPath, dir)
+	defer func() {
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+		viper.Set(config.KeyPackageMirror, false)
+	}()
+
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\t/packages/")
+	{
+		handler := s.mirrorPackages()
+
+		tt := []struct {
+			method string
+			path   string
+			status int
+			body   string
+		}{
+			{"GET", "/packages/nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb", http.StatusOK, "test"},
+			{"GET", "/packages/nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb", http.StatusOK, "test"},
+			{"HEAD", "/packages/nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb", http.StatusOK, ""},
+			{"GET", "/packages/unknown.deb", http.StatusNotFound, ""},
+			{"GET", "/packages/../etc/passwd", http.StatusNotFound, ""},
+			{"POST", "/packages/nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb", http.StatusMethodNotAllowed, ""},
+		}
+
+		for _, tst := range tt {
+			t.Logf("\t\t%s %s", tst.method, tst.path)
+
+			req := httptest.NewRequest(tst.method, "http://cosi"+tst.path, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != tst.status {
+				t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+			}
+			if !bytes.Contains(body, []byte(tst.body)) {
+				t.Fatalf("body missing '%s' (%s)", tst.body, string(body))
+			}
+		}
+
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Fatalf("expected 1 upstream request, got %d", n)
+		}
+	}
+
+	t.Log("\t/package/")
+	{
+		handler := s.agentPackage()
+
+		tt := []struct {
+			query    string
+			status   int
+			location string
+			body     string
+		}{
+			{"", http.StatusOK, "", "http://cosi/packages/%%nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb"},
+			{"&redirect", http.StatusTemporaryRedirect, "http://cosi/packages/nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb", ""},
+		}
+
+		for _, tst := range tt {
+			t.Logf("\t\t%q", tst.query)
+
+			req := httptest.NewRequest("GET", "http://cosi/package/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64"+tst.query, nil)
+			req.Header.Set("Accept", "text/plain")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != tst.status {
+				t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+			}
+			if loc := resp.Header.Get("Location"); loc != tst.location {
+				t.Fatalf("expected location '%s', got '%s'", tst.location, loc)
+			}
+			if !bytes.Contains(body, []byte(tst.body)) {
+				t.Fatalf("body missing '%s' (%s)", tst.body, string(body))
+			}
+		}
+	}
+
+	t.Log("\tupstream unavailable")
+	{
+		upstream.Close()
+		if err := os.Remove(filepath.Join(dir, "nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb")); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		req := httptest.NewRequest("GET", "http://cosi/packages/nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb", nil)
+		w := httptest.NewRecorder()
+		s.mirrorPackages().ServeHTTP(w, req)
+		if w.Code != http.StatusBadGateway {
+			t.Fatalf("expected %d, got %d", http.StatusBadGateway, w.Code)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/rs/zerolog/hlog"
+	"github.com/xi2/httpgzip"
+)
+
+// packageVersions lists the agent packages available for a platform
+type packageVersions struct {
+	DefaultChannel string                 `json:"default_channel"`
+	Packages       []packages.PackageInfo `json:"packages"`
+}
+
+func (s *Server) agentPackageVersions() http.Handler {
+	return httpgzip.NewHandler(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/package/versions/" {
+					hlog.FromRequest(r).Error().Msg("not found")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+					http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+					return
+				}
+				if r.Method != http.MethodGet {
+					hlog.FromRequest(r).Error().Str("method", r.Method).Msg("invalid method")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusMethodNotAllowed))
+					http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+					return
+				}
+
+				args, err := s.validateRequiredParams(r)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("invalid parameter")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusBadRequest))
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				pkgs := s.snapshot().packageList
+				dist, vers := s.packageDistro(pkgs, args)
+				list, err := pkgs.Versions(args.osType, dist, vers, args.sysArch)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Interface("args", args).Msg("unsupported os")
+					s.stats.Increment(fmt.Sprintf("%s`%d`unsupported", r.URL.Path, http.StatusNotFound))
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+
+				data, err := json.Marshal(packageVersions{DefaultChannel: pkgs.DefaultChannel(), Packages: list})
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("json encoding")
+					s.stats.Increment(fmt.Sprintf("%s`%d`encode_err", r.URL.Path, http.StatusInternalServerError))
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "private, max-age=300")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintln(w, string(data))
+				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
+			}),
+		nil)
+}
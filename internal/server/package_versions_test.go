@@ -0,0 +1,91 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestAgentPackageVersions(t *testing.T) {
+	t.Log("Testing agentPackageVersions")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/channels.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackageVersions()
+
+	tt := []struct {
+		method string
+		path   string
+		status int
+		msg    string
+	}{
+		{"GET", "/package/versions", http.StatusNotFound, "Not Found"},
+		{"POST", "/package/versions/", http.StatusMethodNotAllowed, "Method Not Allowed"},
+		{"GET", "/package/versions/?type=Linux&dist=Ubuntu", http.StatusBadRequest, "invalid system 'vers' specified"},
+		{"GET", "/package/versions/?type=Linux&dist=Ubuntu&vers=14.04&arch=x86_64", http.StatusNotFound, "unsupported ubuntu version (v14.04)"},
+		{"GET", "/package/versions/?type=Linux&dist=Ubuntu&vers=18.04&arch=amd64", http.StatusOK, `"default_channel":"stable"`},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.method, tst.path)
+
+		req := httptest.NewRequest(tst.method, "http://cosi"+tst.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var v packageVersions
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(v.Packages) != 4 {
+			t.Fatalf("expected 4 packages, got %#v", v.Packages)
+		}
+		channels := map[string]int{}
+		for _, pi := range v.Packages {
+			channels[pi.Channel]++
+		}
+		if channels["stable"] != 2 || channels["beta"] != 1 || channels["lts"] != 1 {
+			t.Fatalf("unexpected channels %v", channels)
+		}
+	}
+}
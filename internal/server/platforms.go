@@ -0,0 +1,52 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/xi2/httpgzip"
+)
+
+// platforms lists the supported platforms, a record for each package with
+// the package kind, agent version, release channel and lifecycle status
+func (s *Server) platforms() http.Handler {
+	return httpgzip.NewHandler(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/platforms/" {
+					hlog.FromRequest(r).Error().Msg("not found")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+					http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+					return
+				}
+				if r.Method != http.MethodGet {
+					hlog.FromRequest(r).Error().Str("method", r.Method).Msg("invalid method")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusMethodNotAllowed))
+					http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+					return
+				}
+
+				// lifecycle status as of this request, consistent with /package/
+				data, err := json.Marshal(s.snapshot().packageList.SupportedPlatforms())
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("json encoding")
+					s.stats.Increment(fmt.Sprintf("%s`%d`encode_err", r.URL.Path, http.StatusInternalServerError))
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "public, max-age=300")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintln(w, string(data))
+				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
+			}),
+		nil)
+}
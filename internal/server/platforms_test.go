@@ -0,0 +1,75 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestPlatforms(t *testing.T) {
+	t.Log("Testing /platforms/ handler")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/channels.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	viper.Set(config.KeyPackageChannel, "stable")
+	defer func() {
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+		viper.Set(config.KeyPackageChannel, nil)
+	}()
+
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		method  string
+		path    string
+		handler http.Handler
+		status  int
+		msg     string
+	}{
+		{"GET", "/platforms/foo", s.platforms(), http.StatusNotFound, "Not Found"},
+		{"POST", "/platforms/", s.platforms(), http.StatusMethodNotAllowed, "Method Not Allowed"},
+		{"GET", "/platforms/", s.platforms(), http.StatusOK, `{"type":"linux","dist":"ubuntu","vers":"18.04","arch":"x86_64","package_kind":"deb","agent_version":"1.2.0-beta.1","channel":"beta","status":"supported"}`},
+		{"GET", "/", s.index(), http.StatusOK, `"platforms":[{"type":"linux","dist":"ubuntu","vers":"18.04","arch":"x86_64","package_kind":"deb","agent_version":"1.0.0","channel":"stable","status":"supported"}`},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.method, tst.path)
+
+		req := httptest.NewRequest(tst.method, "http://cosi"+tst.path, nil)
+		w := httptest.NewRecorder()
+		tst.handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
+}
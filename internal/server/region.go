@@ -0,0 +1,126 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/region"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// regionDefault is the region reported for hosts without a region mirror
+const regionDefault = "default"
+
+// loadRegions creates the region mirror table (nil if no region mirrors are
+// configured), keeping the health state of the mirrors in prev, and parses
+// the trusted proxies
+func loadRegions(prev *region.Mirrors) (*region.Mirrors, []*net.IPNet, error) {
+	var cfg []config.RegionMirror
+	if err := viper.UnmarshalKey(config.KeyRegionMirrors, &cfg); err != nil {
+		return nil, nil, errors.Wrap(err, "parsing region mirrors")
+	}
+	var regions *region.Mirrors
+	if len(cfg) > 0 {
+		m, err := region.New(cfg)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "region mirrors")
+		}
+		m.Inherit(prev)
+		regions = m
+	}
+
+	proxies, err := region.ParseNetworks(viper.GetStringSlice(config.KeyTrustedProxies))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "trusted proxies")
+	}
+
+	return regions, proxies, nil
+}
+
+// checkRegions health checks the region mirrors of the current content every
+// interval until ctx is done, a reload replaces the mirrors being checked
+func (s *Server) checkRegions(ctx context.Context, interval time.Duration) {
+	for {
+		mctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func(m *region.Mirrors) {
+			defer close(done)
+			if m != nil {
+				m.Start(mctx, interval)
+			}
+		}(s.snapshot().regions)
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		case <-s.regionsReloaded:
+			cancel()
+			<-done
+		}
+	}
+}
+
+// regionMirror returns the region and package base url of the region
+// mirror for a request, selected by the region parameter or the client
+// address. The region is regionDefault, and the url blank, if there is no
+// (healthy) region mirror for the request.
+func (c *content) regionMirror(r *http.Request) (string, string) {
+	if c.regions == nil {
+		return regionDefault, ""
+	}
+	name, u, ok := c.regions.Select(r.URL.Query().Get("region"), c.clientIP(r))
+	if !ok {
+		return regionDefault, ""
+	}
+	return name, u
+}
+
+// clientIP returns the address of the host making a request, from the
+// X-Forwarded-For header if the request is from a trusted proxy
+func (c *content) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !c.trustedProxy(ip) {
+		return ip
+	}
+
+	// proxies append the address they received the request from, the
+	// client is the last address which is not a trusted proxy
+	hops := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !c.trustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trustedProxy returns true if ip is in the trusted proxy networks
+func (c *content) trustedProxy(ip net.IP) bool {
+	for _, n := range c.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestAgentPackageRegion(t *testing.T) {
+	t.Log("Testing agentPackage (region mirrors)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	viper.Set(config.KeyRegionMirrors, []map[string]interface{}{
+		{"region": "us-east", "url": "http://us-east.mirror/packages", "networks": []string{"192.0.2.0/24"}},
+		{"region": "eu-west", "url": "http://eu-west.mirror/packages/", "networks": []string{"198.51.100.0/24", "2001:db8::/32"}},
+	})
+	viper.Set(config.KeyTrustedProxies, []string{"10.0.0.0/8"})
+	defer func() {
+		viper.Set(config.KeyRegionMirrors, nil)
+		viper.Set(config.KeyTrustedProxies, defaults.TrustedProxies)
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	}()
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+
+	file := "nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb"
+	tt := []struct {
+		desc       string
+		query      string
+		remoteAddr string
+		forwarded  string
+		status     int
+		region     string
+		msg        string
+	}{
+		{"client network", "", "192.0.2.10:1234", "", http.StatusOK, "us-east", "http://us-east.mirror/packages/%%" + file},
+		{"client network, ipv6", "", "[2001:db8::1]:1234", "", http.StatusOK, "eu-west", "http://eu-west.mirror/packages/%%" + file},
+		{"no mirror for client network", "", "203.0.113.1:1234", "", http.StatusOK, "default", "http://cosi/packages/%%" + file},
+		{"region param", "&region=EU-West", "192.0.2.10:1234", "", http.StatusOK, "eu-west", "http://eu-west.mirror/packages/%%" + file},
+		{"unknown region param", "&region=ap-south", "192.0.2.10:1234", "", http.StatusOK, "default", "http://cosi/packages/%%" + file},
+		{"invalid region param", "&region=eu/west", "192.0.2.10:1234", "", http.StatusBadRequest, "", "invalid 'region' specified"},
+		{"trusted proxy", "", "10.1.1.1:1234", "198.51.100.7, 10.2.2.2", http.StatusOK, "eu-west", "http://eu-west.mirror/packages/%%" + file},
+		{"untrusted proxy", "", "203.0.113.1:1234", "198.51.100.7", http.StatusOK, "default", "http://cosi/packages/%%" + file},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.desc)
+
+		req := httptest.NewRequest("GET", "http://cosi/package/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64"+tst.query, nil)
+		req.Header.Set("Accept", "text/plain")
+		req.RemoteAddr = tst.remoteAddr
+		if tst.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tst.forwarded)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, string(body))
+		}
+		if tst.status != http.StatusOK {
+			if string(body) != tst.msg+"\n" {
+				t.Fatalf("expected '%s', got '%s'", tst.msg, string(body))
+			}
+			continue
+		}
+		if string(body) != tst.msg {
+			t.Fatalf("expected '%s', got '%s'", tst.msg, string(body))
+		}
+		if r := resp.Header.Get("X-Package-Region"); r != tst.region {
+			t.Fatalf("expected region '%s', got '%s'", tst.region, r)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	t.Log("Testing clientIP")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyTrustedProxies, []string{"10.0.0.0/8", "192.0.2.1"})
+	defer viper.Set(config.KeyTrustedProxies, defaults.TrustedProxies)
+
+	regions, proxies, err := loadRegions(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if regions != nil {
+		t.Fatal("expected no region mirrors")
+	}
+	c := &content{trustedProxies: proxies}
+
+	tt := []struct {
+		remoteAddr string
+		forwarded  []string
+		expect     string
+	}{
+		{"198.51.100.7:1234", nil, "198.51.100.7"},
+		{"198.51.100.7:1234", []string{"203.0.113.1"}, "198.51.100.7"},
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"203.0.113.1"}, "203.0.113.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.9, 203.0.113.1, 10.1.1.1"}, "203.0.113.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.9", "203.0.113.1"}, "203.0.113.1"},
+		{"192.0.2.1:1234", []string{"10.1.1.1, 10.2.2.2"}, "10.1.1.1"},
+		{"192.0.2.1:1234", []string{"garbage, 10.1.1.1"}, "10.1.1.1"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %v", tst.remoteAddr, tst.forwarded)
+
+		req := httptest.NewRequest("GET", "http://cosi/package/", nil)
+		req.RemoteAddr = tst.remoteAddr
+		for _, f := range tst.forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		ip := c.clientIP(req)
+		if ip.String() != tst.expect {
+			t.Fatalf("expected %s, got %s", tst.expect, ip)
+		}
+
+		// canary host key without host_id/hostname is the client address
+		sel, err := (&Server{}).validatePackageSelection(c, req)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if sel.HostKey != tst.expect {
+			t.Fatalf("expected host key %s, got %s", tst.expect, sel.HostKey)
+		}
+	}
+
+	t.Log("\tinvalid trusted proxy")
+	{
+		viper.Set(config.KeyTrustedProxies, []string{"10.0.0.0/33"})
+		if _, _, err := loadRegions(nil); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func TestReloadRegions(t *testing.T) {
+	t.Log("Testing Reload (region mirrors)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyPackageBaseURL, "http://cosi/packages/")
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyIsSolarisDistroRx, defaults.IsSolarisDistroRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	viper.Set(config.KeyRegionMirrors, nil)
+	defer func() {
+		viper.Set(config.KeyRegionMirrors, nil)
+		viper.Set(config.KeyTrustedProxies, defaults.TrustedProxies)
+		viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	}()
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.agentPackage()
+	get := func() (string, string) {
+		req := httptest.NewRequest("GET", "http://cosi/package/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64", nil)
+		req.Header.Set("Accept", "text/plain")
+		req.RemoteAddr = "10.1.1.1:1234"
+		req.Header.Set("X-Forwarded-For", "192.0.2.10")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.Header.Get("X-Package-Region"), string(body)
+	}
+
+	file := "nad-omnibus-2.6.0-1.ubuntu.16.04_amd64.deb"
+
+	t.Log("	no region mirrors")
+	{
+		if r, body := get(); r != "" || body != "http://cosi/packages/%%"+file {
+			t.Fatalf("unexpected region '%s' (%s)", r, body)
+		}
+	}
+
+	t.Log("	region mirrors and trusted proxies added")
+	{
+		viper.Set(config.KeyRegionMirrors, []map[string]interface{}{
+			{"region": "us-east", "url": "http://us-east.mirror/packages/", "networks": []string{"192.0.2.0/24"}},
+		})
+		viper.Set(config.KeyTrustedProxies, []string{"10.0.0.0/8"})
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if r, body := get(); r != "us-east" || body != "http://us-east.mirror/packages/%%"+file {
+			t.Fatalf("unexpected region '%s' (%s)", r, body)
+		}
+		select {
+		case <-s.regionsReloaded:
+		default:
+			t.Fatal("expected region health checks to be restarted")
+		}
+	}
+
+	t.Log("	invalid region mirror, current mirrors kept")
+	{
+		viper.Set(config.KeyRegionMirrors, []map[string]interface{}{
+			{"region": "us-east", "url": "us-east.mirror/packages/"},
+		})
+		if err := s.Reload(); err == nil {
+			t.Fatal("expected error")
+		}
+		if r, _ := get(); r != "us-east" {
+			t.Fatalf("unexpected region '%s'", r)
+		}
+	}
+
+	t.Log("\tunhealthy mirror stays unhealthy")
+	{
+		down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		down.Close()
+		viper.Set(config.KeyRegionMirrors, []map[string]interface{}{
+			{"region": "us-east", "url": "http://us-east.mirror/packages/", "health_url": down.URL, "networks": []string{"192.0.2.0/24"}},
+		})
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		s.snapshot().regions.Check(context.Background())
+		if r, _ := get(); r != regionDefault {
+			t.Fatalf("unexpected region '%s'", r)
+		}
+		if err := s.Reload(); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if r, body := get(); r != regionDefault || body != "http://cosi/packages/%%"+file {
+			t.Fatalf("unexpected region '%s' (%s)", r, body)
+		}
+	}
+
+	t.Log("\thealth checks stop with context")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			s.checkRegions(ctx, time.Hour)
+			close(done)
+		}()
+		s.regionsReloaded <- struct{}{}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("expected health checks to stop")
+		}
+	}
+}
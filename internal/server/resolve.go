@@ -0,0 +1,202 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/circonus-labs/cosi-server/internal/templates"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Platform identifies a host os type, distro, version and architecture
+type Platform struct {
+	Type string `json:"type"`
+	Dist string `json:"dist"`
+	Vers string `json:"vers"`
+	Arch string `json:"arch"`
+	Like string `json:"like,omitempty"` // os-release ID_LIKE
+}
+
+// TemplateResolution lists the files checked for a template
+type TemplateResolution struct {
+	ID         string                `json:"id"`
+	Error      string                `json:"error,omitempty"`
+	Candidates []templates.Candidate `json:"candidates,omitempty"`
+}
+
+// Resolution describes how a request from a platform would be handled
+type Resolution struct {
+	Request      Platform              `json:"request"`
+	Normalized   *Platform             `json:"normalized,omitempty"`
+	Alternates   []templates.Distro    `json:"alternates,omitempty"`
+	ParamError   string                `json:"param_error,omitempty"`
+	Package      *packages.PackageInfo `json:"package,omitempty"`
+	PackageError string                `json:"package_error,omitempty"`
+	// provenance, the package configuration file of the package entry and
+	// the package configuration directory files it overrides
+	PackageSource    string               `json:"package_source,omitempty"`
+	PackageOverrides []string             `json:"package_overrides,omitempty"`
+	Templates        []TemplateResolution `json:"templates"`
+}
+
+// Resolve performs the parameter normalization, package lookup and template
+// search a request from a platform would get, using the current configuration,
+// without starting any listeners. When no template ids (type-name) are
+// passed, every template available for the platform is resolved.
+func Resolve(req Platform, templateIDs []string) (*Resolution, error) {
+	s := Server{logger: log.With().Str("pkg", "server").Logger()}
+
+	if err := s.compileValidators(); err != nil {
+		return nil, errors.Wrap(err, "compiling validators")
+	}
+
+	pkgs, err := packages.New("")
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing package list")
+	}
+
+	tmpls, err := templates.New(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing templates")
+	}
+
+	res := &Resolution{Request: req, Templates: []TemplateResolution{}}
+
+	q := url.Values{}
+	q.Set("type", req.Type)
+	q.Set("dist", req.Dist)
+	q.Set("vers", req.Vers)
+	q.Set("arch", req.Arch)
+	q.Set("like", req.Like)
+	p, err := s.normalizeParams(q, &s.logger)
+	if err != nil {
+		res.ParamError = err.Error()
+		return res, nil
+	}
+	res.Normalized = &Platform{Type: p.osType, Dist: p.osDistro, Vers: p.osVers, Arch: p.sysArch}
+	res.Alternates = p.alts
+
+	pi, err := s.packageInfo(pkgs, p, packages.Selection{})
+	if err != nil {
+		res.PackageError = err.Error()
+	} else {
+		res.Package = pi
+		res.PackageSource = pi.Source
+		res.PackageOverrides = pi.Overrides
+	}
+
+	if len(templateIDs) == 0 {
+		list, err := tmpls.List(p.osType, p.osDistro, p.osVers, p.sysArch, p.alts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "listing templates")
+		}
+		for _, item := range list {
+			templateIDs = append(templateIDs, item.ID)
+		}
+	}
+
+	for _, id := range templateIDs {
+		tr := TemplateResolution{ID: id}
+		parts := strings.SplitN(id, "-", 2)
+		if len(parts) != 2 {
+			tr.Error = "invalid template id, expected type-name"
+			res.Templates = append(res.Templates, tr)
+			continue
+		}
+		c, err := tmpls.Candidates(p.osType, p.osDistro, p.osVers, p.sysArch, parts[0], parts[1], p.alts...)
+		if err != nil {
+			tr.Error = err.Error()
+		}
+		tr.Candidates = c
+		res.Templates = append(res.Templates, tr)
+	}
+
+	return res, nil
+}
+
+// OK returns true if the parameters were valid and a package was found
+func (res *Resolution) OK() bool {
+	return res.ParamError == "" && res.PackageError == ""
+}
+
+// Write outputs the resolution in the requested format (json or text)
+func (res *Resolution) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "formatting resolution (json)")
+		}
+		fmt.Fprintln(w, string(data))
+	case "text", "":
+		r := res.Request
+		fmt.Fprintf(w, "request:    type=%s dist=%s vers=%s arch=%s\n", r.Type, r.Dist, r.Vers, r.Arch)
+		if res.ParamError != "" {
+			fmt.Fprintf(w, "error:      %s\n", res.ParamError)
+			return nil
+		}
+		n := res.Normalized
+		fmt.Fprintf(w, "normalized: type=%s dist=%s vers=%s arch=%s\n", n.Type, n.Dist, n.Vers, n.Arch)
+		if len(res.Alternates) > 0 {
+			alts := make([]string, 0, len(res.Alternates))
+			for _, d := range res.Alternates {
+				alts = append(alts, d.Name+"/"+d.Vers)
+			}
+			fmt.Fprintf(w, "alternates: %s\n", strings.Join(alts, " "))
+		}
+		if res.PackageError != "" {
+			fmt.Fprintf(w, "package:    error: %s\n", res.PackageError)
+		} else {
+			pi := res.Package
+			if pi.File != "" {
+				fmt.Fprintf(w, "package:    file=%s url=%s\n", pi.File, pi.URL)
+			} else {
+				fmt.Fprintf(w, "package:    name=%s publisher=%s %s\n", pi.Name, pi.PubName, pi.PubURL)
+			}
+			if pi.Match != nil {
+				fmt.Fprintf(w, "matched:    %s\n", pi.Match)
+			}
+			if res.PackageSource != "" {
+				fmt.Fprintf(w, "source:     %s\n", res.PackageSource)
+			}
+			if len(res.PackageOverrides) > 0 {
+				fmt.Fprintf(w, "overrides:  %s\n", strings.Join(res.PackageOverrides, " "))
+			}
+		}
+		fmt.Fprintln(w, "templates:")
+		if len(res.Templates) == 0 {
+			fmt.Fprintln(w, "  none")
+		}
+		for _, tr := range res.Templates {
+			fmt.Fprintf(w, "  %s\n", tr.ID)
+			if tr.Error != "" {
+				fmt.Fprintf(w, "    error: %s\n", tr.Error)
+			}
+			for _, c := range tr.Candidates {
+				mark := " "
+				if c.Selected {
+					mark = "*"
+				}
+				fmt.Fprintf(w, "    %s %-7s %-8s %s", mark, c.Level, c.Status, c.File)
+				if c.Error != "" {
+					fmt.Fprintf(w, " (%s)", c.Error)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	default:
+		return errors.Errorf("unknown resolution format '%s'", format)
+	}
+
+	return nil
+}
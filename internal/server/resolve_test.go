@@ -0,0 +1,156 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/circonus-labs/cosi-server/internal/templates"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestResolve(t *testing.T) {
+	t.Log("Testing Resolve")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+
+	t.Log("\tinvalid params")
+	{
+		res, err := Resolve(Platform{Type: "linux", Dist: "ubuntu", Vers: "foo", Arch: "x86_64"}, nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if res.OK() {
+			t.Fatal("expected not OK")
+		}
+		if res.ParamError != "invalid system 'vers' specified" {
+			t.Fatalf("unexpected param error (%s)", res.ParamError)
+		}
+	}
+
+	t.Log("\tunsupported")
+	{
+		res, err := Resolve(Platform{Type: "linux", Dist: "centos", Vers: "7.4.1708", Arch: "x86_64"}, []string{"graph-default"})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if res.OK() {
+			t.Fatal("expected not OK")
+		}
+		// rhel major version
+		if res.Normalized == nil || res.Normalized.Vers != "7" {
+			t.Fatalf("expected normalized version 7, got %#v", res.Normalized)
+		}
+		if res.PackageError == "" {
+			t.Fatal("expected package error")
+		}
+	}
+
+	t.Log("\tsupported, selected templates")
+	{
+		res, err := Resolve(Platform{Type: "Linux", Dist: "Ubuntu", Vers: "16.04", Arch: "x86_64"}, []string{"graph-osvers", "graph-missing", "bogus"})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !res.OK() {
+			t.Fatalf("expected OK, got %#v", res)
+		}
+		if res.Package == nil || res.Package.File == "" {
+			t.Fatalf("expected package, got %#v", res.Package)
+		}
+		if len(res.Templates) != 3 {
+			t.Fatalf("expected 3 templates, got %d", len(res.Templates))
+		}
+		c := res.Templates[0].Candidates
+		if len(c) != 6 || !c[2].Selected || c[2].Status != templates.CandidateFound {
+			t.Fatalf("expected vers level selected, got %#v", c)
+		}
+		for _, cand := range res.Templates[1].Candidates {
+			if cand.Status != templates.CandidateMissing || cand.Selected {
+				t.Fatalf("expected missing, got %#v", cand)
+			}
+		}
+		if res.Templates[2].Error == "" {
+			t.Fatal("expected error for invalid template id")
+		}
+
+		var buf bytes.Buffer
+		if err := res.Write(&buf, "text"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.Contains(buf.String(), "* vers    found") {
+			t.Fatalf("unexpected output %s", buf.String())
+		}
+		if !strings.Contains(buf.String(), "source:     ../packages/testdata/valid.yaml") {
+			t.Fatalf("unexpected output %s", buf.String())
+		}
+
+		buf.Reset()
+		if err := res.Write(&buf, "json"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		var got Resolution
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+
+		if err := res.Write(&buf, "xml"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tsupported, all templates")
+	{
+		res, err := Resolve(Platform{Type: "linux", Dist: "ubuntu", Vers: "16.04", Arch: "x86_64"}, nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(res.Templates) == 0 {
+			t.Fatal("expected templates")
+		}
+	}
+
+	t.Log("\tpackage configuration directory")
+	{
+		viper.Set(config.KeyPackageConfigFile, "../packages/testdata/confd")
+		defer viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+
+		res, err := Resolve(Platform{Type: "linux", Dist: "centos", Vers: "7", Arch: "x86_64"}, []string{"graph-default"})
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !res.OK() {
+			t.Fatalf("expected OK, got %#v", res)
+		}
+		if res.PackageSource != "../packages/testdata/confd/30-centos.yaml" {
+			t.Fatalf("unexpected package source (%s)", res.PackageSource)
+		}
+
+		var buf bytes.Buffer
+		if err := res.Write(&buf, "text"); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.Contains(buf.String(), "overrides:  ../packages/testdata/confd/10-base.yaml") {
+			t.Fatalf("unexpected output %s", buf.String())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/xi2/httpgzip"
+)
+
+func (s *Server) templateList() http.Handler {
+	return httpgzip.NewHandler(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/templates/" {
+					hlog.FromRequest(r).Error().Msg("not found")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusNotFound))
+					http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+					return
+				}
+				if r.Method != http.MethodGet {
+					hlog.FromRequest(r).Error().Str("method", r.Method).Msg("invalid method")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusMethodNotAllowed))
+					http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+					return
+				}
+
+				c := s.snapshot()
+
+				args, err := s.validateRequiredParams(r)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("invalid parameter")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusBadRequest))
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				list, err := c.templates.List(args.osType, args.osDistro, args.osVers, args.sysArch, args.alts...)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("listing templates")
+					s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusInternalServerError))
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				data, err := json.Marshal(list)
+				if err != nil {
+					hlog.FromRequest(r).Error().Err(err).Msg("json encoding")
+					s.stats.Increment(fmt.Sprintf("%s`%d`encode_err", r.URL.Path, http.StatusInternalServerError))
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "private, max-age=300")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintln(w, string(data))
+				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
+			}),
+		nil)
+}
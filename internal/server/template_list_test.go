@@ -0,0 +1,67 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestTemplateList(t *testing.T) {
+	t.Log("Testing templateList")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyPackageBaseURL, defaults.BasePackageURL)
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	handler := s.templateList()
+
+	tt := []struct {
+		method string
+		path   string
+		status int
+		msg    string
+	}{
+		{"GET", "/templates", http.StatusNotFound, "Not Found"},
+		{"POST", "/templates/", http.StatusMethodNotAllowed, "Method Not Allowed"},
+		{"GET", "/templates/", http.StatusBadRequest, "invalid system 'type' specified"},
+		{"GET", "/templates/?type=Linux&dist=Ubuntu&vers=16.04", http.StatusBadRequest, "invalid system 'arch' specified"},
+		{"GET", "/templates/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64", http.StatusOK, `"id":"graph-sysarch","type":"graph","name":"sysarch"`},
+		{"GET", "/templates/?type=Linux&dist=CentOS&vers=7&arch=x86_64", http.StatusOK, `"id":"graph-ostype","type":"graph","name":"ostype","version":"","description":"","level":"type"`},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s %s", tst.method, tst.path)
+
+		req := httptest.NewRequest(tst.method, "http://cosi"+tst.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
+}
@@ -7,9 +7,12 @@ package server
 
 import (
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/circonus-labs/cosi-server/api"
 	"github.com/rs/zerolog/hlog"
 	"github.com/xi2/httpgzip"
 )
@@ -31,7 +34,11 @@ func (s *Server) template() http.Handler {
 					return
 				}
 
-				tinfo, err := s.validateTemplateSpec(r)
+				// one snapshot for the request, a reload does not change the
+				// templates between validating and serving the template
+				c := s.snapshot()
+
+				tinfo, err := s.validateTemplateSpec(c, r)
 				if err != nil {
 					hlog.FromRequest(r).Error().Err(err).Msg("invalid template specification")
 					s.stats.Increment(fmt.Sprintf("%s`%d`spec", r.URL.Path, http.StatusBadRequest))
@@ -49,7 +56,21 @@ func (s *Server) template() http.Handler {
 					return
 				}
 
-				t, err := s.templates.Get(args.osType, args.osDistro, args.osVers, args.sysArch, tinfo.Type, tinfo.Name)
+				// the format query parameter takes precedence over the Accept header
+				format := strings.ToLower(r.URL.Query().Get("format"))
+				if format != "" {
+					if _, ok := s.templateContentTypes[format]; !ok {
+						hlog.FromRequest(r).Error().Str("format", format).Msg("invalid template format")
+						s.stats.Increment(fmt.Sprintf("%s`%d`format", r.URL.Path, http.StatusBadRequest))
+						s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusBadRequest))
+						http.Error(w, fmt.Sprintf("invalid format (%s)", format), http.StatusBadRequest)
+						return
+					}
+				} else {
+					format = negotiateTemplateFormat(r.Header.Get("Accept"))
+				}
+
+				t, err := c.templates.GetFormat(args.osType, args.osDistro, args.osVers, args.sysArch, tinfo.Type, tinfo.Name, format, args.alts...)
 				if err != nil {
 					if strings.Contains(err.Error(), "no template found") {
 						hlog.FromRequest(r).Warn().Err(err).Msg("fetching template")
@@ -64,10 +85,58 @@ func (s *Server) template() http.Handler {
 					return
 				}
 
-				w.Header().Set("Content-Type", s.templateContentType)
+				w.Header().Set("Content-Type", s.templateContentTypes[format])
+				w.Header().Set("Vary", "Accept")
 				w.WriteHeader(http.StatusOK)
 				_, _ = w.Write(*t) // binary write, so % used in strings is not interpolated
 				s.stats.Increment(fmt.Sprintf("%s`%d", r.URL.Path, http.StatusOK))
 			}),
 		nil)
 }
+
+// acceptFormats maps Accept header media types to template formats
+var acceptFormats = map[string]string{
+	"*/*":                api.TemplateFormatTOML,
+	"application/*":      api.TemplateFormatTOML,
+	"application/toml":   api.TemplateFormatTOML,
+	"application/json":   api.TemplateFormatJSON,
+	"application/x-yaml": api.TemplateFormatYAML,
+	"application/yaml":   api.TemplateFormatYAML,
+	"text/yaml":          api.TemplateFormatYAML,
+	"text/x-yaml":        api.TemplateFormatYAML,
+}
+
+// negotiateTemplateFormat returns the template format for an Accept header,
+// the supported media type with the highest quality (first listed wins a
+// tie). TOML, the format served before content negotiation, when no header
+// is sent or nothing supported is listed (e.g. text/plain).
+func negotiateTemplateFormat(accept string) string {
+	format := api.TemplateFormatTOML
+	if strings.TrimSpace(accept) == "" {
+		return format
+	}
+
+	best := 0.0
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		f, ok := acceptFormats[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > best {
+			format = f
+			best = q
+		}
+	}
+
+	return format
+}
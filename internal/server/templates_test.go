@@ -75,4 +75,49 @@ func TestTemplates(t *testing.T) {
 			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
 		}
 	}
+
+	t.Log("\tcontent negotiation")
+
+	path := "/template/graph/default/?type=Linux&dist=Ubuntu&vers=16.04&arch=x86_64"
+	ct := []struct {
+		query       string
+		accept      string
+		status      int
+		contentType string
+		msg         string
+	}{
+		{"", "", http.StatusOK, "application/toml", `name = "default"`},
+		{"", "application/json", http.StatusOK, "application/json", `"name": "default"`},
+		{"", "application/x-yaml", http.StatusOK, "application/x-yaml", "name: default"},
+		{"", "text/html, application/json;q=0.5, */*;q=0.1", http.StatusOK, "application/json", `"name": "default"`},
+		{"", "text/html", http.StatusOK, "application/toml", `name = "default"`},
+		{"", "text/plain", http.StatusOK, "application/toml", `name = "default"`},
+		{"&format=yaml", "application/json", http.StatusOK, "application/x-yaml", "name: default"},
+		{"&format=JSON", "", http.StatusOK, "application/json", `"name": "default"`},
+		{"&format=xml", "", http.StatusBadRequest, "", "invalid format (xml)"},
+	}
+
+	for _, tst := range ct {
+		t.Logf("\t\tformat=%q accept=%q", tst.query, tst.accept)
+
+		req := httptest.NewRequest("GET", "http://cosi"+path+tst.query, nil)
+		if tst.accept != "" {
+			req.Header.Set("Accept", tst.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode != tst.status {
+			t.Fatalf("expected %d, got %d %s", tst.status, resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		if tst.contentType != "" && resp.Header.Get("Content-Type") != tst.contentType {
+			t.Fatalf("expected %s, got %s", tst.contentType, resp.Header.Get("Content-Type"))
+		}
+		if !bytes.Contains(body, []byte(tst.msg)) {
+			t.Fatalf("body missing '%s' (%s)", tst.msg, string(body))
+		}
+	}
 }
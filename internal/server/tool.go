@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/circonus-labs/cosi-server/internal/arch"
 	"github.com/circonus-labs/cosi-server/internal/config"
 	"github.com/rs/zerolog/hlog"
 	"github.com/spf13/viper"
@@ -60,13 +61,15 @@ func (s *Server) tool() http.Handler {
 
 				// example of expected redirect url:
 				// https://github.com/circonus-labs/cosi-tool/releases/download/v0.2.0/cosi-tool_0.2.0_linux_x86_64.tar.gz
+				// https://github.com/circonus-labs/cosi-tool/releases/download/v0.2.0/cosi-tool_0.2.0_linux_arm64.tar.gz
 				//
 				cosiVer := viper.GetString(config.KeyCosiToolVersion)
-				redirURL := fmt.Sprintf("%s/%s/cosi-tool_%s_%s_x86_64.tar.gz",
+				redirURL := fmt.Sprintf("%s/%s/cosi-tool_%s_%s_%s.tar.gz",
 					viper.GetString(config.KeyCosiToolBaseURL),
 					cosiVer,
 					strings.Replace(cosiVer, "v", "", 1),
-					args.osType)
+					args.osType,
+					arch.ToolName(args.sysArch))
 
 				http.Redirect(w, r, redirURL, http.StatusTemporaryRedirect)
 			}),
@@ -7,11 +7,16 @@ package server
 
 import (
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 
+	"github.com/circonus-labs/cosi-server/internal/arch"
 	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/packages"
+	"github.com/circonus-labs/cosi-server/internal/templates"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 	"github.com/spf13/viper"
 )
@@ -91,13 +96,26 @@ func (s *Server) compileValidators() error {
 		}
 		s.modepushrx = rx
 	}
+	// Distro aliases (e.g. rocky -> centos)
+	{
+		s.distroAliases = map[string]string{}
+		for dist, alias := range viper.GetStringMapString(config.KeyDistroAliases) {
+			s.distroAliases[strings.ToLower(dist)] = strings.ToLower(alias)
+		}
+	}
 
 	return nil
 }
 
 func (s *Server) validateRequiredParams(r *http.Request) (*params, error) {
-	p := r.URL.Query()
+	return s.normalizeParams(r.URL.Query(), hlog.FromRequest(r))
+}
+
+// normalizeParams validates the platform parameters (type, dist, vers, arch)
+// and normalizes them into the form used for package and template lookups
+func (s *Server) normalizeParams(p url.Values, logger *zerolog.Logger) (*params, error) {
 	pinfo := params{}
+	osVersClean := ""
 
 	// OS type
 	{
@@ -107,7 +125,7 @@ func (s *Server) validateRequiredParams(r *http.Request) (*params, error) {
 			return nil, paramErr
 		}
 		if !s.typerx.MatchString(osType) {
-			hlog.FromRequest(r).Error().Str("type_param", osType).Str("type_regex", s.typerx.String()).Msg("OS Type not matched")
+			logger.Error().Str("type_param", osType).Str("type_regex", s.typerx.String()).Msg("OS Type not matched")
 			return nil, paramErr
 		}
 		pinfo.osType = osType
@@ -121,7 +139,7 @@ func (s *Server) validateRequiredParams(r *http.Request) (*params, error) {
 			return nil, paramErr
 		}
 		if !s.distrx.MatchString(osDistro) {
-			hlog.FromRequest(r).Error().Str("dist_param", osDistro).Str("dist_regex", s.distrx.String()).Msg("OS Distro not matched")
+			logger.Error().Str("dist_param", osDistro).Str("dist_regex", s.distrx.String()).Msg("OS Distro not matched")
 			return nil, paramErr
 		}
 		pinfo.osDistro = osDistro
@@ -135,22 +153,15 @@ func (s *Server) validateRequiredParams(r *http.Request) (*params, error) {
 			return nil, paramErr
 		}
 		if !s.versrx.MatchString(osVers) {
-			hlog.FromRequest(r).Error().Str("vers_param", osVers).Str("vers_regex", s.versrx.String()).Msg("OS Version not matched")
+			logger.Error().Str("vers_param", osVers).Str("vers_regex", s.versrx.String()).Msg("OS Version not matched")
 			return nil, paramErr
 		}
 		clean := s.vercleanrx.ReplaceAllString(osVers, "")
 		if clean == "" {
 			return nil, paramErr
 		}
-		pinfo.osVers = clean
-		if s.rhelrx.MatchString(pinfo.osDistro) {
-			v := strings.Split(clean, ".")
-			if len(v) == 0 {
-				return nil, paramErr
-			}
-			// only use the major version for RHEL distros
-			pinfo.osVers = v[0]
-		}
+		pinfo.osVers = s.distroVersion(pinfo.osDistro, clean)
+		osVersClean = clean
 	}
 
 	// System architecture
@@ -161,16 +172,161 @@ func (s *Server) validateRequiredParams(r *http.Request) (*params, error) {
 			return nil, paramErr
 		}
 		if !s.archrx.MatchString(sysArch) {
-			hlog.FromRequest(r).Error().Str("arch_param", sysArch).Str("arch_regex", s.archrx.String()).Msg("System Architecture not matched")
+			logger.Error().Str("arch_param", sysArch).Str("arch_regex", s.archrx.String()).Msg("System Architecture not matched")
 			return nil, paramErr
 		}
-		pinfo.sysArch = sysArch
+		pinfo.sysArch = arch.Canonical(sysArch) // e.g. amd64 is x86_64
+	}
+
+	// Alternate distros, searched in order when the distro has no package
+	// or template: the distro alias then each os-release ID_LIKE distro
+	// (like=, e.g. "rhel centos fedora") and its alias
+	{
+		seen := map[string]bool{pinfo.osDistro: true}
+		addAlt := func(dist string) {
+			if dist == "" || seen[dist] {
+				return
+			}
+			seen[dist] = true
+			pinfo.alts = append(pinfo.alts, templates.Distro{Name: dist, Vers: s.distroVersion(dist, osVersClean)})
+		}
+
+		addAlt(s.distroAliases[pinfo.osDistro])
+		like := strings.FieldsFunc(strings.ToLower(p.Get("like")), func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+		for _, dist := range like {
+			if !s.distrx.MatchString(dist) {
+				logger.Warn().Str("like_param", dist).Str("dist_regex", s.distrx.String()).Msg("ID_LIKE distro not matched, ignoring")
+				continue
+			}
+			addAlt(dist)
+			addAlt(s.distroAliases[dist])
+		}
 	}
 
 	return &pinfo, nil
 }
 
-func (s *Server) validateTemplateSpec(r *http.Request) (*templateSpec, error) {
+// distroVersion returns the version used for package and template lookups
+// for a distro, only the major version is used for RHEL distros
+func (s *Server) distroVersion(dist, vers string) string {
+	if s.rhelrx.MatchString(dist) {
+		return strings.Split(vers, ".")[0]
+	}
+	return vers
+}
+
+// packageDistro returns the distro and version used for package lookups, the
+// first alternate distro in the package configuration if the distro is not
+func (s *Server) packageDistro(pkgs *packages.Packages, args *params) (string, string) {
+	if !pkgs.HasDistro(args.osType, args.osDistro) {
+		for _, alt := range args.alts {
+			if pkgs.HasDistro(args.osType, alt.Name) {
+				return alt.Name, alt.Vers
+			}
+		}
+	}
+	return args.osDistro, args.osVers
+}
+
+// packageInfo returns the package for the platform and selection (channel,
+// agent version)
+func (s *Server) packageInfo(pkgs *packages.Packages, args *params, sel packages.Selection) (*packages.PackageInfo, error) {
+	dist, vers := s.packageDistro(pkgs, args)
+	return pkgs.SelectPackage(args.osType, dist, vers, args.sysArch, sel)
+}
+
+// package selection parameters are not configurable, channels are named in
+// the package configuration and agent versions are semver-like
+var (
+	channelrx      = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	agentVersionrx = regexp.MustCompile(`^v?\d+(\.\d+)*([-+][0-9A-Za-z.+-]+)?$`)
+	hostKeyrx      = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,255}$`)
+	regionrx       = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+)
+
+// validatePackageSelection validates the optional channel and agent_version
+// parameters selecting one of the packages for a platform, and the region
+// parameter selecting the region mirror. The host key for canary rollout is
+// the host_id or hostname parameter, or the client address.
+func (s *Server) validatePackageSelection(c *content, r *http.Request) (packages.Selection, error) {
+	sel := packages.Selection{}
+	logger := hlog.FromRequest(r)
+	p := r.URL.Query()
+
+	if channel := p.Get("channel"); channel != "" {
+		if !channelrx.MatchString(channel) {
+			logger.Error().Str("channel_param", channel).Str("channel_regex", channelrx.String()).Msg("Package channel not matched")
+			return sel, errors.New("invalid package 'channel' specified")
+		}
+		sel.Channel = strings.ToLower(channel)
+	}
+
+	if agentVersion := p.Get("agent_version"); agentVersion != "" {
+		if !agentVersionrx.MatchString(agentVersion) {
+			logger.Error().Str("agent_version_param", agentVersion).Str("agent_version_regex", agentVersionrx.String()).Msg("Agent version not matched")
+			return sel, errors.New("invalid 'agent_version' specified")
+		}
+		sel.AgentVersion = agentVersion
+	}
+
+	for _, param := range []string{"host_id", "hostname"} {
+		hostKey := p.Get(param)
+		if hostKey == "" {
+			continue
+		}
+		if !hostKeyrx.MatchString(hostKey) {
+			logger.Error().Str(param+"_param", hostKey).Str("host_regex", hostKeyrx.String()).Msg("Host not matched")
+			return sel, errors.Errorf("invalid '%s' specified", param)
+		}
+		sel.HostKey = strings.ToLower(hostKey)
+		break
+	}
+	if sel.HostKey == "" {
+		// the same client address as region mirror selection
+		if ip := c.clientIP(r); ip != nil {
+			sel.HostKey = ip.String()
+		}
+	}
+
+	if region := p.Get("region"); region != "" && !regionrx.MatchString(region) {
+		logger.Error().Str("region_param", region).Str("region_regex", regionrx.String()).Msg("Region not matched")
+		return sel, errors.New("invalid 'region' specified")
+	}
+
+	return sel, nil
+}
+
+// package text response formats, the text is parsed by cosi-install
+const (
+	// textFormatLegacy is name%%publisher%%publisher_url for solaris
+	// distros, otherwise url%%file (exactly two fields, deployed installers
+	// reject any other number)
+	textFormatLegacy = 1
+	// textFormatTyped is the format version followed by every package
+	// field, blank if not set:
+	// 2%%package_type%%url%%file%%sha256%%signature_url%%name%%publisher%%publisher_url
+	textFormatTyped = 2
+)
+
+// validateTextFormat validates the optional text_format parameter selecting
+// the package text response format, textFormatLegacy if not set
+func (s *Server) validateTextFormat(r *http.Request) (int, error) {
+	switch f := r.URL.Query().Get("text_format"); f {
+	case "", "1":
+		return textFormatLegacy, nil
+	case "2":
+		return textFormatTyped, nil
+	default:
+		hlog.FromRequest(r).Error().Str("text_format_param", f).Msg("Text format not matched")
+		return 0, errors.New("invalid 'text_format' specified")
+	}
+}
+
+// validateTemplateSpec validates the template type and name in the url path
+// against the templates of the content snapshot serving the request
+func (s *Server) validateTemplateSpec(c *content, r *http.Request) (*templateSpec, error) {
 	spec := r.URL.Path
 	tinfo := templateSpec{}
 
@@ -185,13 +341,15 @@ func (s *Server) validateTemplateSpec(r *http.Request) (*templateSpec, error) {
 	tinfo.Type = specItems[2]
 	tinfo.Name = specItems[3]
 
-	if !s.templates.Typerx.MatchString(tinfo.Type) {
-		hlog.FromRequest(r).Error().Str("type_param", tinfo.Type).Str("type_regex", s.templates.Typerx.String()).Msg("Template type not matched")
+	t := c.templates
+
+	if !t.Typerx.MatchString(tinfo.Type) {
+		hlog.FromRequest(r).Error().Str("type_param", tinfo.Type).Str("type_regex", t.Typerx.String()).Msg("Template type not matched")
 		return nil, errors.New("invalid template type")
 	}
 
-	if !s.templates.Namerx.MatchString(tinfo.Name) {
-		hlog.FromRequest(r).Error().Str("name_param", tinfo.Name).Str("name_regex", s.templates.Namerx.String()).Msg("Template name not matched")
+	if !t.Namerx.MatchString(tinfo.Name) {
+		hlog.FromRequest(r).Error().Str("name_param", tinfo.Name).Str("name_regex", t.Namerx.String()).Msg("Template name not matched")
 		return nil, errors.New("invalid template name")
 	}
 
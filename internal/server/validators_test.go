@@ -8,6 +8,7 @@ package server
 import (
 	"fmt"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/circonus-labs/cosi-server/internal/config"
@@ -54,6 +55,8 @@ func TestValidateRequiredParams(t *testing.T) {
 		{"Linux", "amzn", "2016.03", "x86_64", false},
 		{"Solaris", "OmniOS", "r151014", "x86_64", false},
 		{"BSD", "FreeBSD", "11.0", "amd64", false},
+		{"FreeBSD", "FreeBSD", "12.1-RELEASE-p3", "amd64", false},
+		{"Windows", "Windows", "10.0.17763", "AMD64", false},
 		// Add more distros as they are supported
 		{"", "Ubuntu", "16.04", "x86_64", true},
 		{"foo!", "Ubuntu", "16.04", "x86_64", true},
@@ -63,6 +66,7 @@ func TestValidateRequiredParams(t *testing.T) {
 		{"Linux", "Ubuntu", "foo", "x86_64", true},
 		{"Linux", "Ubuntu", "16.04", "", true},
 		{"Linux", "Ubuntu", "16.04", "foo", true},
+		{"FreeBSD", "FreeBSD", "12.1-BOGUS", "amd64", true},
 		// add more bad sequences as needed
 	}
 
@@ -114,7 +118,7 @@ func TestValidateTemplateSpec(t *testing.T) {
 		t.Logf("\t%v", tst)
 
 		r := httptest.NewRequest("", tst.spec, nil)
-		_, err := s.validateTemplateSpec(r)
+		_, err := s.validateTemplateSpec(s.snapshot(), r)
 		if tst.shouldErr {
 			if err == nil {
 				t.Fatal("expected error")
@@ -126,3 +130,58 @@ func TestValidateTemplateSpec(t *testing.T) {
 		}
 	}
 }
+
+func TestNormalizeParamsAlts(t *testing.T) {
+	t.Log("Testing normalizeParams (distro alternates)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyParamTypeRx, defaults.ParamTypeRx)
+	viper.Set(config.KeyParamDistroRx, defaults.ParamDistroRx)
+	viper.Set(config.KeyParamVersionRx, defaults.ParamVersionRx)
+	viper.Set(config.KeyParamVersionCleanerRx, defaults.ParamVersionCleanerRx)
+	viper.Set(config.KeyParamArchRx, defaults.ParamArchRx)
+	viper.Set(config.KeyIsRHELDistroRx, defaults.IsRHELDistroRx)
+	viper.Set(config.KeyDistroAliases, map[string]string{"Rocky": "CentOS", "pop": "ubuntu"})
+	viper.Set(config.KeyPackageConfigFile, "../packages/testdata/valid.yaml")
+	viper.Set(config.KeyContentPath, "../templates/testdata")
+	defer viper.Set(config.KeyDistroAliases, nil)
+	s, err := New()
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		query  string
+		vers   string
+		expect string
+	}{
+		{"dist=Ubuntu&vers=16.04", "16.04", ""},
+		{"dist=Rocky&vers=8.4", "8", "centos/8"},
+		{"dist=Rocky&vers=8.4&like=rhel+centos+fedora", "8", "centos/8 rhel/8 fedora/8"},
+		{"dist=Clear&vers=8.4&like=rhel", "8.4", "rhel/8"},
+		{"dist=Pop&vers=20.04&like=ubuntu%20debian", "20.04", "ubuntu/20.04 debian/20.04"},
+		{"dist=Linuxmint&vers=20&like=ubuntu,debian", "20", "ubuntu/20 debian/20"},
+		{"dist=Neon&vers=20.04&like=pop", "20.04", "pop/20.04 ubuntu/20.04"},
+		{"dist=CentOS&vers=7.4.1708&like=rhel+fedora", "7", "rhel/7 fedora/7"},
+		{"dist=Ubuntu&vers=16.04&like=ubuntu+foo!+debian", "16.04", "debian/16.04"},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.query)
+		r := httptest.NewRequest("", "/?type=Linux&arch=x86_64&"+tst.query, nil)
+		p, err := s.validateRequiredParams(r)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if p.osVers != tst.vers {
+			t.Fatalf("expected vers %s, got %s", tst.vers, p.osVers)
+		}
+		alts := []string{}
+		for _, d := range p.alts {
+			alts = append(alts, d.Name+"/"+d.Vers)
+		}
+		if got := strings.Join(alts, " "); got != tst.expect {
+			t.Fatalf("expected (%s) got (%s)", tst.expect, got)
+		}
+	}
+}
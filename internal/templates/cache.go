@@ -0,0 +1,167 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsClient is the subset of the statsd client used to report cache metrics
+type StatsClient interface {
+	Increment(bucket string)
+}
+
+// templateCache is a concurrency-safe cache of template lookups. Each
+// lookup key (e.g. linux-ubuntu-16.04-x86_64-graph-vm) maps to the content
+// of the template it resolved to, or to a negative entry when no template
+// was found. Entries for the same template share the underlying content.
+// The cache is optionally bounded by number of entries (least recently used
+// are evicted first) and by age.
+type templateCache struct {
+	sync.Mutex
+	maxEntries int           // 0 = unbounded
+	ttl        time.Duration // 0 = entries do not expire
+	entries    map[string]*list.Element
+	lru        *list.List
+	stats      StatsClient
+}
+
+type cacheEntry struct {
+	key     string
+	id      string // template id (type-name) the key belongs to
+	data    []byte // nil for a negative (no template found) entry
+	expires time.Time
+}
+
+const (
+	statCacheHit    = "template`cache`hit"
+	statCacheMiss   = "template`cache`miss"
+	statCacheEvict  = "template`cache`evict"
+	statCacheExpire = "template`cache`expire"
+)
+
+func newTemplateCache(maxEntries int, ttl time.Duration, stats StatsClient) *templateCache {
+	if maxEntries < 0 {
+		maxEntries = 0
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return &templateCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		stats:      stats,
+	}
+}
+
+// get returns the cached content for key. found is false when the key is
+// not cached. found is true and data is nil for a negative entry.
+func (c *templateCache) get(key string) (data []byte, found bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(e.expires) {
+		c.remove(elem)
+		c.increment(statCacheExpire)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return e.data, true
+}
+
+// set adds or replaces the entry for key, data nil adds a negative entry
+func (c *templateCache) set(key, id string, data []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		e := elem.Value.(*cacheEntry)
+		e.id = id
+		e.data = data
+		e.expires = expires
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, id: id, data: data, expires: expires})
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.increment(statCacheEvict)
+	}
+}
+
+// evict removes all entries (positive and negative) for a template id,
+// returns the number of entries removed
+func (c *templateCache) evict(id string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	id = strings.ToLower(id)
+	n := 0
+	for _, elem := range c.entries {
+		if elem.Value.(*cacheEntry).id == id {
+			c.remove(elem)
+			n++
+		}
+	}
+	if n > 0 {
+		c.increment(statCacheEvict)
+	}
+
+	return n
+}
+
+// flush removes all entries, returns the number of entries removed
+func (c *templateCache) flush() int {
+	c.Lock()
+	defer c.Unlock()
+
+	n := c.lru.Len()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	if n > 0 {
+		c.increment(statCacheEvict)
+	}
+
+	return n
+}
+
+// len returns the number of cached entries
+func (c *templateCache) len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.lru.Len()
+}
+
+// remove deletes an entry, caller must hold the lock
+func (c *templateCache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, e.key)
+}
+
+func (c *templateCache) increment(stat string) {
+	if c.stats != nil {
+		c.stats.Increment(stat)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testStats struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+func (s *testStats) Increment(bucket string) {
+	s.Lock()
+	defer s.Unlock()
+	s.counts[bucket]++
+}
+
+func (s *testStats) count(bucket string) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.counts[bucket]
+}
+
+func TestTemplateCache(t *testing.T) {
+	t.Log("Testing templateCache")
+
+	t.Log("\tpositive and negative entries")
+	{
+		c := newTemplateCache(0, 0, nil)
+		c.set("linux-graph-vm", "graph-vm", []byte("vm"))
+		c.set("linux-graph-foo", "graph-foo", nil)
+
+		if data, found := c.get("linux-graph-vm"); !found || string(data) != "vm" {
+			t.Fatalf("expected cached entry, got (%v) %s", found, string(data))
+		}
+		if data, found := c.get("linux-graph-foo"); !found || data != nil {
+			t.Fatalf("expected negative entry, got (%v) %s", found, string(data))
+		}
+		if _, found := c.get("linux-graph-bar"); found {
+			t.Fatal("expected no entry")
+		}
+	}
+
+	t.Log("\tmax entries (lru)")
+	{
+		stats := &testStats{counts: map[string]int{}}
+		c := newTemplateCache(2, 0, stats)
+		c.set("a", "graph-a", []byte("a"))
+		c.set("b", "graph-b", []byte("b"))
+		_, _ = c.get("a") // a is now most recently used
+		c.set("c", "graph-c", []byte("c"))
+
+		if c.len() != 2 {
+			t.Fatalf("expected 2 entries, got %d", c.len())
+		}
+		if _, found := c.get("b"); found {
+			t.Fatal("expected b to be evicted")
+		}
+		if _, found := c.get("a"); !found {
+			t.Fatal("expected a to be cached")
+		}
+		if n := stats.count(statCacheEvict); n != 1 {
+			t.Fatalf("expected 1 eviction, got %d", n)
+		}
+	}
+
+	t.Log("\tttl")
+	{
+		stats := &testStats{counts: map[string]int{}}
+		c := newTemplateCache(0, 10*time.Millisecond, stats)
+		c.set("a", "graph-a", []byte("a"))
+		if _, found := c.get("a"); !found {
+			t.Fatal("expected a to be cached")
+		}
+		time.Sleep(20 * time.Millisecond)
+		if _, found := c.get("a"); found {
+			t.Fatal("expected a to be expired")
+		}
+		if n := stats.count(statCacheExpire); n != 1 {
+			t.Fatalf("expected 1 expiration, got %d", n)
+		}
+	}
+
+	t.Log("\tevict")
+	{
+		c := newTemplateCache(0, 0, nil)
+		c.set("linux-ubuntu-graph-vm", "graph-vm", []byte("vm"))
+		c.set("linux-graph-vm", "graph-vm", []byte("vm"))
+		c.set("linux-graph-cpu", "graph-cpu", []byte("cpu"))
+		if n := c.evict("graph-vm"); n != 2 {
+			t.Fatalf("expected 2 evicted, got %d", n)
+		}
+		if c.len() != 1 {
+			t.Fatalf("expected 1 entry, got %d", c.len())
+		}
+	}
+}
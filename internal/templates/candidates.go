@@ -0,0 +1,72 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import "os"
+
+// Candidate statuses
+const (
+	CandidateFound   = "found"
+	CandidateMissing = "missing"
+	CandidateInvalid = "invalid"
+)
+
+// Candidate is one of the files checked, in order, when resolving a template
+type Candidate struct {
+	Level    string `json:"level"`
+	File     string `json:"file"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Selected bool   `json:"selected"` // the file Get would return
+}
+
+// Candidates returns every file Get would check for a template, most specific
+// first, with whether each exists and is valid. The cache is not consulted,
+// the filesystem is always checked.
+func (t *Templates) Candidates(osType, osDist, osVers, osArch, tType, tName string, alts ...Distro) ([]Candidate, error) {
+	spec, err := t.newSpec(osType, osDist, osVers, osArch, tType, tName, alts)
+	if err != nil {
+		return nil, err
+	}
+
+	tlist := t.makeTemplateList(spec)
+	candidates := make([]Candidate, 0, len(tlist))
+	resolved := false // a file was selected, or Get would fail at this point
+
+	for _, ti := range tlist {
+		data, file, err := t.readTemplate(ti.filename)
+		c := Candidate{Level: ti.level, File: file, Status: CandidateFound}
+
+		switch {
+		case os.IsNotExist(err):
+			c.Status = CandidateMissing
+		case err != nil:
+			c.Status = CandidateInvalid
+			c.Error = err.Error()
+			if _, ok := err.(legacyError); !ok || t.validation == ValidationOff {
+				resolved = true
+			}
+		case t.validation != ValidationOff:
+			if verr := ValidateTemplate(file, data); verr != nil {
+				c.Status = CandidateInvalid
+				c.Error = verr.Error()
+			}
+		case len(data) == 0:
+			c.Status = CandidateInvalid
+			c.Error = "invalid template (empty)"
+			resolved = true
+		}
+
+		if c.Status == CandidateFound && !resolved {
+			c.Selected = true
+			resolved = true
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestCandidates(t *testing.T) {
+	t.Log("Testing Candidates")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyContentPath, "testdata/")
+	defer viper.Reset()
+
+	tmpl, err := New(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\tinvalid type")
+	{
+		if _, err := tmpl.Candidates("linux", "", "", "", "#graph", "vm"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tinvalid name")
+	{
+		if _, err := tmpl.Candidates("linux", "", "", "", "graph", "#vm"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	tests := []struct {
+		name     string
+		status   []string
+		selected int // index of selected candidate, -1 none
+	}{
+		// arch (x86_64), arch (amd64), vers, dist, type, default
+		{"osvers", []string{CandidateMissing, CandidateMissing, CandidateFound, CandidateMissing, CandidateMissing, CandidateMissing}, 2},
+		{"default", []string{CandidateMissing, CandidateMissing, CandidateMissing, CandidateMissing, CandidateMissing, CandidateFound}, 5},
+		{"missing", []string{CandidateMissing, CandidateMissing, CandidateMissing, CandidateMissing, CandidateMissing, CandidateMissing}, -1},
+		{"empty", []string{CandidateMissing, CandidateMissing, CandidateMissing, CandidateMissing, CandidateMissing, CandidateInvalid}, -1},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+		c, err := tmpl.Candidates("linux", "ubuntu", "16.04", "x86_64", "graph", test.name)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(c) != len(test.status) {
+			t.Fatalf("expected %d candidates, got %d", len(test.status), len(c))
+		}
+		if c[0].Level != LevelArch || c[len(c)-1].Level != LevelDefault {
+			t.Fatalf("unexpected order %#v", c)
+		}
+		for i, s := range test.status {
+			if c[i].Status != s {
+				t.Fatalf("candidate %d expected (%s) got (%s)", i, s, c[i].Status)
+			}
+			if c[i].Selected != (i == test.selected) {
+				t.Fatalf("candidate %d expected selected %v", i, i == test.selected)
+			}
+		}
+	}
+
+	t.Log("\tquarantined template skipped")
+	{
+		viper.Set(config.KeyContentPath, "testdata/validate")
+		viper.Set(config.KeyTemplateValidation, ValidationQuarantine)
+		tmpl, err := New(nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		c, err := tmpl.Candidates("linux", "", "", "", "graph", "good")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(c) != 2 {
+			t.Fatalf("expected 2 candidates, got %d", len(c))
+		}
+		if c[0].Status != CandidateInvalid || c[0].Error == "" || c[0].Selected {
+			t.Fatalf("expected invalid, not selected %#v", c[0])
+		}
+		if c[1].Status != CandidateFound || !c[1].Selected {
+			t.Fatalf("expected found, selected %#v", c[1])
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/circonus-labs/cosi-server/api"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// GetFormat returns a specific template in the requested format (toml, json
+// or yaml). TOML is the template file content, other formats are produced
+// from the parsed api.Template and cached separately.
+func (t *Templates) GetFormat(osType, osDist, osVers, osArch, tType, tName, format string, alts ...Distro) (*[]byte, error) {
+	format = strings.ToLower(format)
+	switch format {
+	case "", api.TemplateFormatTOML:
+		return t.Get(osType, osDist, osVers, osArch, tType, tName, alts...)
+	case api.TemplateFormatJSON, api.TemplateFormatYAML:
+	default:
+		return nil, errors.Errorf("invalid template format (%s)", format)
+	}
+
+	spec, err := t.newSpec(osType, osDist, osVers, osArch, tType, tName, alts)
+	if err != nil {
+		return nil, err
+	}
+
+	tlist := t.makeTemplateList(spec)
+	id := tlist[len(tlist)-1].key
+	key := tlist[0].key + ":" + format // e.g. linux-ubuntu-16.04-x86_64-graph-vm:json
+
+	if t.cache != nil {
+		if data, cached := t.cache.get(key); cached && data != nil {
+			t.cache.increment(statCacheHit)
+			return &data, nil
+		}
+	}
+
+	src, err := t.Get(osType, osDist, osVers, osArch, tType, tName, alts...)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := encodeTemplate(*src, format)
+	if err != nil {
+		return nil, errors.Wrap(err, "get template")
+	}
+
+	if t.cache != nil {
+		t.cache.set(key, id, data)
+		t.cache.increment(statCacheMiss)
+	}
+
+	return &data, nil
+}
+
+// encodeTemplate converts TOML template content to json or yaml
+func encodeTemplate(data []byte, format string) ([]byte, error) {
+	var tmpl api.Template
+	if err := toml.Unmarshal(data, &tmpl); err != nil {
+		return nil, errors.Wrap(err, "parsing template")
+	}
+
+	switch format {
+	case api.TemplateFormatJSON:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(tmpl); err != nil {
+			return nil, errors.Wrap(err, "encoding json")
+		}
+		return buf.Bytes(), nil
+	case api.TemplateFormatYAML:
+		out, err := yaml.Marshal(tmpl)
+		if err != nil {
+			return nil, errors.Wrap(err, "encoding yaml")
+		}
+		return out, nil
+	}
+
+	return nil, errors.Errorf("invalid template format (%s)", format)
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/api"
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGetFormat(t *testing.T) {
+	t.Log("Testing GetFormat")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyEnableTemplateCache, true)
+	viper.Set(config.KeyContentPath, "testdata/validate")
+	defer viper.Reset()
+
+	stats := &testStats{counts: map[string]int{}}
+	tmpl, err := New(stats)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\tinvalid format")
+	{
+		if _, err := tmpl.GetFormat("", "", "", "", "graph", "good", "xml"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tmissing template")
+	{
+		if _, err := tmpl.GetFormat("", "", "", "", "graph", "missing", api.TemplateFormatJSON); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\ttoml")
+	{
+		data, err := tmpl.GetFormat("", "", "", "", "graph", "good", "")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.HasPrefix(string(*data), `type = "graph"`) {
+			t.Fatalf("expected toml template, got %s", string(*data))
+		}
+	}
+
+	t.Log("\tjson")
+	{
+		data, err := tmpl.GetFormat("", "", "", "", "graph", "good", "JSON")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		var v api.Template
+		if err := json.Unmarshal(*data, &v); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if v.Name != "good" || !strings.Contains(v.Configs["cpu"].Template, `"check_id": {{.CheckID}}`) {
+			t.Fatalf("unexpected template %#v", v)
+		}
+	}
+
+	t.Log("\tyaml")
+	{
+		data, err := tmpl.GetFormat("", "", "", "", "graph", "good", api.TemplateFormatYAML)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		var v api.Template
+		if err := yaml.Unmarshal(*data, &v); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if v.Name != "good" || v.Configs["cpu"].Template == "" {
+			t.Fatalf("unexpected template %#v", v)
+		}
+	}
+
+	t.Log("\tcached per format")
+	{
+		hits := stats.count(statCacheHit)
+		if _, err := tmpl.GetFormat("", "", "", "", "graph", "good", api.TemplateFormatJSON); err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if stats.count(statCacheHit) != hits+1 {
+			t.Fatal("expected json template from cache")
+		}
+		// toml, json and yaml entries
+		if n := tmpl.Evict("graph-good"); n != 3 {
+			t.Fatalf("expected 3 entries evicted, got %d", n)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// LegacyFileExtension is the file extension of templates in the original
+// COSI JSON schema (e.g. content/templates/omnios/graph-vm.json)
+const LegacyFileExtension = ".json"
+
+// ErrLegacyUnsupported is returned when converting a legacy template of a
+// type other than graph. Legacy dashboards matched graph widgets by tag at
+// creation time, there is no equivalent in the current template format.
+var ErrLegacyUnsupported = errors.New("unsupported legacy template type")
+
+// legacyTemplate is the original COSI JSON template schema
+type legacyTemplate struct {
+	Type            string            `json:"type"`
+	ID              string            `json:"id"`
+	Description     string            `json:"description"`
+	Version         string            `json:"version"`
+	Notes           []string          `json:"notes"`
+	VariableMetrics bool              `json:"variable_metrics"`
+	Filter          legacyFilter      `json:"filter"`
+	Config          []json.RawMessage `json:"config"`
+}
+
+// legacyFilter lists are equality tests against the graph item
+type legacyFilter struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// convertedTemplate mirrors api.Template for encoding, the embedded JSON
+// templates are written as multi-line strings
+type convertedTemplate struct {
+	Type        string                     `toml:"type"`
+	Name        string                     `toml:"name"`
+	Version     string                     `toml:"version"`
+	Description string                     `toml:"description" multiline:"true"`
+	Variable    bool                       `toml:"variable"`
+	Filter      convertedFilter            `toml:"filters"`
+	Configs     map[string]convertedConfig `toml:"configs"`
+}
+
+type convertedFilter struct {
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
+}
+
+type convertedConfig struct {
+	Variable   bool                 `toml:"variable"`
+	Template   string               `toml:"template" multiline:"true"`
+	Datapoints []convertedDatapoint `toml:"datapoints,omitempty"`
+}
+
+type convertedDatapoint struct {
+	Variable bool   `toml:"variable"`
+	MetricRx string `toml:"metric_regex"`
+	Template string `toml:"template" multiline:"true"`
+}
+
+// legacyVars maps the legacy {{=cosi.x}} interpolation fields to the fields
+// supplied when cosi-tool renders templates
+var legacyVars = map[string]string{
+	"check_id":     "CheckID",
+	"check_uuid":   "CheckUUID",
+	"cluster_name": "ClusterName",
+	"graph_item":   "Item",
+	"host_name":    "HostName",
+}
+
+var (
+	legacyVarRx   = regexp.MustCompile(`{{=cosi\.([^}]+)}}`)
+	legacyCheckRx = regexp.MustCompile(`"check_id":\s*null`)
+	configNameRx  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ConvertLegacy converts a graph template in the original COSI JSON schema to
+// the TOML template format. id becomes name, variable_metrics becomes
+// variable, filter becomes filters (the equality tests become anchored
+// regular expressions), each entry in config becomes a named config and the
+// {{=cosi.x}} interpolation becomes the equivalent {{.X}} template field.
+func ConvertLegacy(data []byte) ([]byte, error) {
+	// the schema of config differs by type, check the type first
+	var hdr struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return nil, errors.Wrap(err, "parsing legacy template")
+	}
+	if hdr.Type != "graph" {
+		return nil, errors.Wrapf(ErrLegacyUnsupported, "(%s)", hdr.Type)
+	}
+
+	var lt legacyTemplate
+	if err := json.Unmarshal(data, &lt); err != nil {
+		return nil, errors.Wrap(err, "parsing legacy template")
+	}
+	if lt.ID == "" {
+		return nil, errors.New("legacy template missing 'id'")
+	}
+	if len(lt.Config) == 0 {
+		return nil, errors.New("legacy template missing 'config'")
+	}
+
+	ct := convertedTemplate{
+		Type:        lt.Type,
+		Name:        lt.ID,
+		Version:     lt.Version,
+		Description: strings.TrimSpace(lt.Description),
+		Variable:    lt.VariableMetrics,
+		Filter: convertedFilter{
+			Include: anchorFilters(lt.Filter.Include),
+			Exclude: anchorFilters(lt.Filter.Exclude),
+		},
+		Configs: map[string]convertedConfig{},
+	}
+
+	for i, raw := range lt.Config {
+		cfg := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, errors.Wrapf(err, "parsing legacy config %d", i)
+		}
+
+		cc := convertedConfig{Variable: lt.VariableMetrics}
+
+		if lt.VariableMetrics {
+			// datapoints are matched by regular expression against the
+			// available metrics, one graph per matched item
+			dps, _ := cfg["datapoints"].([]interface{})
+			for j, d := range dps {
+				dp, ok := d.(map[string]interface{})
+				if !ok {
+					return nil, errors.Errorf("invalid legacy datapoint %d in config %d", j, i)
+				}
+				rx, _ := dp["metric_name"].(string)
+				if rx == "" {
+					return nil, errors.Errorf("legacy datapoint %d in config %d missing 'metric_name'", j, i)
+				}
+				dp["metric_name"] = "{{.MetricName}}"
+				tmpl, err := legacyJSON(dp)
+				if err != nil {
+					return nil, errors.Wrapf(err, "config %d datapoint %d", i, j)
+				}
+				cc.Datapoints = append(cc.Datapoints, convertedDatapoint{MetricRx: rx, Template: tmpl})
+			}
+			cfg["datapoints"] = []interface{}{}
+		}
+
+		tmpl, err := legacyJSON(cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "config %d", i)
+		}
+		cc.Template = tmpl
+
+		title, _ := cfg["title"].(string)
+		ct.Configs[configName(title, i, ct.Configs)] = cc
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Order(toml.OrderPreserve).Encode(ct); err != nil {
+		return nil, errors.Wrap(err, "encoding converted template")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// legacyJSON encodes a legacy config or datapoint as a JSON template, check
+// ids and interpolated fields are replaced with template fields
+func legacyJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(v); err != nil {
+		return "", errors.Wrap(err, "encoding JSON")
+	}
+
+	s := legacyCheckRx.ReplaceAllString(buf.String(), `"check_id": {{.CheckID}}`)
+
+	var convErr error
+	s = legacyVarRx.ReplaceAllStringFunc(s, func(m string) string {
+		name := legacyVarRx.FindStringSubmatch(m)[1]
+		field, ok := legacyVars[name]
+		if !ok {
+			if convErr == nil {
+				convErr = errors.Errorf("unsupported legacy field (cosi.%s)", name)
+			}
+			return m
+		}
+		return "{{." + field + "}}"
+	})
+	if convErr != nil {
+		return "", convErr
+	}
+
+	return s, nil
+}
+
+// anchorFilters converts legacy equality filters to regular expressions
+func anchorFilters(list []string) []string {
+	rx := make([]string, 0, len(list))
+	for _, s := range list {
+		rx = append(rx, "^"+regexp.QuoteMeta(s)+"$")
+	}
+	return rx
+}
+
+// configName derives a config name from a legacy config title, e.g.
+// "{{=cosi.host_name}} {{=cosi.graph_item}} bps" is "bps". Falls back
+// to the config index if the title does not provide a unique name.
+func configName(title string, idx int, configs map[string]convertedConfig) string {
+	name := legacyVarRx.ReplaceAllString(title, "")
+	name = strings.Trim(configNameRx.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if _, exists := configs[name]; name == "" || exists {
+		name = fmt.Sprintf("config%d", idx)
+	}
+	return name
+}
+
+// legacyError is a legacy template which could not be converted, it is
+// handled as an invalid template (quarantined when validating)
+type legacyError struct {
+	error
+}
+
+// readTemplate reads the template file for a search path entry. If the
+// template file does not exist, a legacy JSON template with the same base
+// name is converted. A legacy template of an unsupported type is treated
+// as not existing. Returns the file read.
+func (t *Templates) readTemplate(filename string) ([]byte, string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err == nil || !os.IsNotExist(err) {
+		return data, filename, err
+	}
+
+	legacyFile := strings.TrimSuffix(filename, t.fileExt) + LegacyFileExtension
+	legacy, lerr := ioutil.ReadFile(legacyFile)
+	if lerr != nil {
+		return nil, filename, err // the original not exist error
+	}
+
+	converted, cerr := ConvertLegacy(legacy)
+	if cerr != nil {
+		if errors.Cause(cerr) == ErrLegacyUnsupported {
+			return nil, filename, err
+		}
+		return nil, legacyFile, legacyError{errors.Wrap(cerr, "converting legacy template")}
+	}
+
+	return converted, legacyFile, nil
+}
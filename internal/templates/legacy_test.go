@@ -0,0 +1,169 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestConvertLegacy(t *testing.T) {
+	t.Log("Testing ConvertLegacy")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	tests := []struct {
+		name   string
+		data   string
+		errMsg string
+	}{
+		{"invalid json", `{`, "parsing legacy template"},
+		{"unsupported type", `{"type": "dashboard", "id": "foo", "config": {}}`, ErrLegacyUnsupported.Error()},
+		{"missing id", `{"type": "graph"}`, "missing 'id'"},
+		{"missing config", `{"type": "graph", "id": "foo"}`, "missing 'config'"},
+		{"invalid config", `{"type": "graph", "id": "foo", "config": [1]}`, "parsing legacy config 0"},
+		{"missing metric_name", `{"type": "graph", "id": "foo", "variable_metrics": true, "config": [{"datapoints": [{}]}]}`, "missing 'metric_name'"},
+		{"unsupported field", `{"type": "graph", "id": "foo", "config": [{"title": "{{=cosi.bogus}}"}]}`, "unsupported legacy field (cosi.bogus)"},
+		{"valid", `{"type": "graph", "id": "foo", "version": "0.1.0", "config": [{"title": "{{=cosi.host_name}} foo", "datapoints": [{"check_id": null}]}]}`, ""},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+		data, err := ConvertLegacy([]byte(test.data))
+		if test.errMsg == "" {
+			if err != nil {
+				t.Fatalf("expected NO error, got %v", err)
+			}
+			if verr := ValidateTemplate("graph-foo.toml", data); verr != nil {
+				t.Fatalf("expected valid template, got %v\n%s", verr, string(data))
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), test.errMsg) {
+			t.Fatalf("expected (%s) got (%s)", test.errMsg, err)
+		}
+	}
+
+	t.Log("\tunsupported type cause")
+	{
+		_, err := ConvertLegacy([]byte(`{"type": "worksheet"}`))
+		if errors.Cause(err) != ErrLegacyUnsupported {
+			t.Fatalf("expected ErrLegacyUnsupported, got %v", err)
+		}
+	}
+
+	t.Log("\tvariable graph")
+	{
+		file := filepath.Join("testdata", "legacy", "templates", "solaris", "omnios", "graph-if.json")
+		legacy, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		data, err := ConvertLegacy(legacy)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if verr := ValidateTemplate("graph-if.toml", data); verr != nil {
+			t.Fatalf("expected valid template, got %v", verr)
+		}
+		for _, s := range []string{
+			`name = "if"`,
+			`variable = true`,
+			`"^lo0$"`,
+			`[configs.bps]`,
+			"metric_regex = \"if`([^`]+):rbytes\"",
+			`"metric_name": "{{.MetricName}}"`,
+			`"check_id": {{.CheckID}}`,
+			`"title": "{{.HostName}} {{.Item}} bps"`,
+		} {
+			if !strings.Contains(string(data), s) {
+				t.Fatalf("expected (%s) in\n%s", s, string(data))
+			}
+		}
+	}
+}
+
+func TestLegacyGet(t *testing.T) {
+	t.Log("Testing Get (legacy)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyContentPath, "testdata/legacy")
+	defer viper.Reset()
+
+	t.Log("\tquarantine mode")
+	{
+		viper.Set(config.KeyTemplateValidation, ValidationQuarantine)
+		tmpl, err := New(nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+
+		problems := tmpl.Validate()
+		expect := filepath.Join("testdata", "legacy", "templates", "solaris", "omnios", "graph-vm.json")
+		if len(problems) != 1 || problems[0].File != expect {
+			t.Fatalf("expected (%s) invalid, got %v", expect, problems)
+		}
+
+		data, err := tmpl.Get("solaris", "omnios", "r151014", "amd64", "graph", "if")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.Contains(string(*data), `name = "if"`) {
+			t.Fatalf("expected converted template, got %s", string(*data))
+		}
+
+		// invalid legacy template is skipped, default is served
+		data, err = tmpl.Get("solaris", "omnios", "r151014", "amd64", "graph", "vm")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.Contains(string(*data), "Default vm") {
+			t.Fatalf("expected default template, got %s", string(*data))
+		}
+
+		// legacy dashboards are not converted
+		if _, err := tmpl.Get("solaris", "omnios", "r151014", "amd64", "dashboard", "system"); err == nil {
+			t.Fatal("expected error")
+		}
+
+		list, err := tmpl.List("solaris", "omnios", "r151014", "amd64")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		levels := map[string]string{}
+		for _, item := range list {
+			levels[item.ID] = item.Level
+		}
+		if len(levels) != 2 || levels["graph-if"] != LevelDistro || levels["graph-vm"] != LevelDefault {
+			t.Fatalf("unexpected list %#v", list)
+		}
+	}
+
+	t.Log("\toff")
+	{
+		viper.Set(config.KeyTemplateValidation, ValidationOff)
+		tmpl, err := New(nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if _, err := tmpl.Get("solaris", "omnios", "r151014", "amd64", "graph", "vm"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
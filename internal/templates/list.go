@@ -0,0 +1,127 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/circonus-labs/cosi-server/api"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// List returns the templates which resolve for an os type, distro, version,
+// architecture combination. For each template id, the entry is the template
+// Get would return along with the search path level it resolved from. alts
+// are alternate distros searched after osDist.
+func (t *Templates) List(osType, osDist, osVers, osArch string, alts ...Distro) ([]api.TemplateListItem, error) {
+	spec := &tspec{
+		ostype:  strings.ToLower(osType),
+		osdist:  strings.ToLower(osDist),
+		osvers:  strings.ToLower(osVers),
+		sysarch: strings.ToLower(osArch),
+	}
+	spec.setAlts(alts)
+
+	type found struct {
+		file  string
+		level string
+	}
+	ids := map[string][]found{}
+
+	// walk from most to least specific, the first usable template for an
+	// id is the one Get would return
+	for _, d := range t.searchPath(spec) {
+		dir := path.Join(append([]string{t.templateDir}, d.parts...)...)
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrap(err, "reading template directory")
+		}
+		for _, fi := range files {
+			ext := filepath.Ext(fi.Name())
+			if fi.IsDir() || (ext != t.fileExt && ext != LegacyFileExtension) {
+				continue
+			}
+			id := strings.ToLower(strings.TrimSuffix(fi.Name(), ext))
+			tType, tName, ok := t.parseID(id)
+			if !ok || !t.Typerx.MatchString(tType) || !t.Namerx.MatchString(tName) {
+				continue
+			}
+			// a template and a legacy template at the same level are one
+			// candidate, readTemplate prefers the template
+			f := found{file: path.Join(dir, strings.TrimSuffix(fi.Name(), ext)+t.fileExt), level: d.level}
+			if n := len(ids[id]); n > 0 && ids[id][n-1] == f {
+				continue
+			}
+			ids[id] = append(ids[id], f)
+		}
+	}
+
+	list := make([]api.TemplateListItem, 0, len(ids))
+	for id, candidates := range ids {
+		for _, f := range candidates {
+			data, file, err := t.readTemplate(f.file)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue // unsupported legacy template
+				}
+				if _, ok := err.(legacyError); ok {
+					t.logger.Warn().Err(err).Str("file", file).Msg("invalid template, skipping")
+					if t.validation != ValidationOff {
+						continue // quarantined, try next less specific template
+					}
+					break
+				}
+				return nil, errors.Wrapf(err, "reading template (%s)", file)
+			}
+			if t.validation != ValidationOff {
+				if err := ValidateTemplate(file, data); err != nil {
+					t.logger.Warn().Err(err).Str("file", file).Msg("invalid template, skipping")
+					continue // quarantined, try next less specific template
+				}
+			} else if len(data) == 0 {
+				t.logger.Warn().Str("file", file).Msg("invalid template (empty), skipping")
+				break
+			}
+			var tmpl api.Template
+			if err := toml.Unmarshal(data, &tmpl); err != nil {
+				t.logger.Warn().Err(err).Str("file", file).Msg("invalid template, skipping")
+				break
+			}
+			tType, tName, _ := t.parseID(id)
+			list = append(list, api.TemplateListItem{
+				ID:          id,
+				Type:        tType,
+				Name:        tName,
+				Version:     tmpl.Version,
+				Description: strings.TrimSpace(tmpl.Description),
+				Level:       f.level,
+			})
+			break
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+// parseID splits a template id (type-name) into type and name
+func (t *Templates) parseID(id string) (string, string, bool) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,75 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestList(t *testing.T) {
+	t.Log("Testing List")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyContentPath, "testdata/")
+	tmpl, err := New(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		name   string
+		ostype string
+		osdist string
+		osvers string
+		osarch string
+		expect map[string]string // id -> level
+	}{
+		{"default only", "", "", "", "", map[string]string{
+			"graph-cached":  LevelDefault,
+			"graph-default": LevelDefault,
+		}},
+		{"other distro", "linux", "centos", "7", "x86_64", map[string]string{
+			"graph-cached":  LevelDefault,
+			"graph-default": LevelDefault,
+			"graph-ostype":  LevelType,
+		}},
+		{"all levels", "linux", "ubuntu", "16.04", "x86_64", map[string]string{
+			"graph-cached":   LevelDefault,
+			"graph-default":  LevelDefault,
+			"graph-ostype":   LevelType,
+			"graph-osdistro": LevelDistro,
+			"graph-osvers":   LevelVersion,
+			"graph-sysarch":  LevelArch,
+		}},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.name)
+		list, err := tmpl.List(tst.ostype, tst.osdist, tst.osvers, tst.osarch)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(list) != len(tst.expect) {
+			t.Fatalf("expected %d templates, got %d (%v)", len(tst.expect), len(list), list)
+		}
+		for _, item := range list {
+			level, ok := tst.expect[item.ID]
+			if !ok {
+				t.Fatalf("unexpected template %s", item.ID)
+			}
+			if item.Level != level {
+				t.Fatalf("%s expected level %s, got %s", item.ID, level, item.Level)
+			}
+		}
+	}
+}
@@ -7,27 +7,32 @@ package templates
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
 	"regexp"
 	"strings"
 
 	"github.com/circonus-labs/cosi-server/api"
+	"github.com/circonus-labs/cosi-server/internal/arch"
 	"github.com/circonus-labs/cosi-server/internal/config"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
-// New creates new instance of Templates
-func New() (*Templates, error) {
+// New creates new instance of Templates, stats is optional (nil) and
+// receives the template cache metrics
+func New(stats StatsClient) (*Templates, error) {
 	t := Templates{
-		logger:   log.With().Str("pkg", "templates").Logger(),
-		useCache: viper.GetBool(config.KeyEnableTemplateCache),
-		fileExt:  api.TemplateFileExtension,
-		cache:    map[string][]byte{},
-		index:    map[string]string{},
+		logger:  log.With().Str("pkg", "templates").Logger(),
+		fileExt: api.TemplateFileExtension,
+	}
+
+	if viper.GetBool(config.KeyEnableTemplateCache) {
+		t.cache = newTemplateCache(
+			viper.GetInt(config.KeyTemplateCacheMaxEntries),
+			viper.GetDuration(config.KeyTemplateCacheTTL),
+			stats)
 	}
 
 	trx, err := regexp.Compile(viper.GetString(config.KeyTemplateTypeRx))
@@ -56,13 +61,52 @@ func New() (*Templates, error) {
 		return nil, errors.New("invalid template path (not a directory)")
 	}
 
+	// validate all templates, in quarantine mode invalid templates are
+	// logged and will not be served, in fail mode they prevent loading
+	switch mode := strings.ToLower(viper.GetString(config.KeyTemplateValidation)); mode {
+	case "", ValidationOff:
+		t.validation = ValidationOff
+	case ValidationQuarantine, ValidationFail:
+		t.validation = mode
+		problems := t.Validate()
+		for _, p := range problems {
+			t.logger.Warn().Str("file", p.File).Str("reason", p.Err).Msg("invalid template")
+		}
+		if len(problems) > 0 {
+			if mode == ValidationFail {
+				return nil, errors.Errorf("%d invalid template(s), see log for details", len(problems))
+			}
+			t.logger.Warn().Int("invalid", len(problems)).Msg("invalid templates quarantined")
+		}
+	default:
+		return nil, errors.Errorf("invalid template validation mode (%s)", mode)
+	}
+
 	return &t, nil
 }
 
-// Get a specific template
-func (t *Templates) Get(osType, osDist, osVers, osArch, tType, tName string) (*[]byte, error) {
+// Get a specific template, alts are alternate distros searched after osDist
+func (t *Templates) Get(osType, osDist, osVers, osArch, tType, tName string, alts ...Distro) (*[]byte, error) {
 	// Note: os* vars would already been validated in the request handler
 	//       passing blanks will simply result in the default being returned.
+	spec, err := t.newSpec(osType, osDist, osVers, osArch, tType, tName, alts)
+	if err != nil {
+		return nil, err
+	}
+
+	tlist := t.makeTemplateList(spec)
+
+	template, err := t.getTemplate(&tlist)
+	if err != nil {
+		return nil, errors.Wrap(err, "get template")
+	}
+
+	return template, nil
+}
+
+// newSpec validates the template type and name and returns the lower
+// cased template specification
+func (t *Templates) newSpec(osType, osDist, osVers, osArch, tType, tName string, alts []Distro) (*tspec, error) {
 	if tType == "" || !t.Typerx.MatchString(tType) {
 		return nil, errors.New("invalid template type")
 	}
@@ -76,106 +120,169 @@ func (t *Templates) Get(osType, osDist, osVers, osArch, tType, tName string) (*[
 		ostype:  strings.ToLower(osType),
 		osdist:  strings.ToLower(osDist),
 		osvers:  strings.ToLower(osVers),
-		sysarch: strings.ToLower(osArch),
+		sysarch: arch.Canonical(osArch),
 	}
+	spec.setAlts(alts)
 
-	tlist := t.makeTemplateList(spec)
+	return spec, nil
+}
 
-	template, err := t.getTemplate(&tlist)
-	if err != nil {
-		return nil, errors.Wrap(err, "get template")
+// setAlts sets the (lower cased) alternate distros
+func (s *tspec) setAlts(alts []Distro) {
+	s.alts = make([]Distro, 0, len(alts))
+	for _, d := range alts {
+		if d.Name == "" {
+			continue
+		}
+		s.alts = append(s.alts, Distro{Name: strings.ToLower(d.Name), Vers: strings.ToLower(d.Vers)})
 	}
-
-	return template, nil
 }
 
 func (t *Templates) getTemplate(tlist *[]tinfo) (*[]byte, error) {
-	foundIdx := 0
-	foundKey := ""
-	template := []byte{}
+	// the last (least specific) key is the template id (type-name)
+	id := (*tlist)[len(*tlist)-1].key
 
 	for idx, ti := range *tlist {
-		if t.useCache {
-			if tkey, inIndex := t.index[ti.key]; inIndex {
-				if data, cached := t.cache[tkey]; cached {
-					return &data, nil
+		if t.cache != nil {
+			if data, cached := t.cache.get(ti.key); cached {
+				if data == nil {
+					// negative entry, nothing at this level or any less specific level
+					t.cache.increment(statCacheHit)
+					return nil, errors.New("no template found")
 				}
+				t.cacheKeys(tlist, idx, id, data)
+				t.cache.increment(statCacheHit)
+				return &data, nil
 			}
 		}
 
-		data, err := ioutil.ReadFile(ti.filename)
+		data, file, err := t.readTemplate(ti.filename)
 		if err != nil {
 			if os.IsNotExist(err) {
 				continue // ignore, try next template spec
 			}
+			if _, ok := err.(legacyError); ok && t.validation != ValidationOff {
+				t.logger.Warn().Err(err).Str("file", file).Msg("invalid template, skipping")
+				continue
+			}
 			return nil, err
 		}
-		if len(data) == 0 {
+		if t.validation != ValidationOff {
+			// quarantined, fall through to less specific templates. the file
+			// is re-checked on every cache miss so corrections are picked up
+			if err := ValidateTemplate(file, data); err != nil {
+				t.logger.Warn().Err(err).Str("file", file).Msg("invalid template, skipping")
+				continue
+			}
+		} else if len(data) == 0 {
 			return nil, errors.New("invalid template found (empty)")
 		}
 
-		foundIdx = idx
-		foundKey = ti.key
-		if t.useCache {
-			t.cache[foundKey] = data
+		if t.cache != nil {
+			t.cacheKeys(tlist, idx, id, data)
+			t.cache.increment(statCacheMiss)
 		}
-		template = data
-		break
+		return &data, nil
 	}
 
-	if foundKey == "" {
-		key := (*tlist)[0].key // will be the *most* specific spec
-		t.logger.Warn().Str("spec", key).Msg("no template found for spec")
-		return nil, errors.New("no template found")
+	key := (*tlist)[0].key // will be the *most* specific spec
+	t.logger.Warn().Str("spec", key).Msg("no template found for spec")
+
+	if t.cache != nil {
+		// cache the negative result for every level so the filesystem
+		// is not checked again for a template that does not exist
+		t.cacheKeys(tlist, len(*tlist)-1, id, nil)
+		t.cache.increment(statCacheMiss)
 	}
 
-	if t.useCache {
-		// add found key to index for all of the more specific keys preceding it
-		// to short-circuit hitting the filesystem constantly checking for files
-		// that will not be found going forward
-		for i := foundIdx; i >= 0; i-- {
-			key := (*tlist)[i].key
-			t.index[key] = foundKey
-		}
+	return nil, errors.New("no template found")
+}
+
+// cacheKeys adds the result for all of the more specific keys preceding (and
+// including) foundIdx to short-circuit hitting the filesystem constantly
+// checking for files that will not be found going forward
+func (t *Templates) cacheKeys(tlist *[]tinfo, foundIdx int, id string, data []byte) {
+	for i := foundIdx; i >= 0; i-- {
+		t.cache.set((*tlist)[i].key, id, data)
 	}
+}
 
-	return &template, nil
+// Dir returns the template directory
+func (t *Templates) Dir() string {
+	return t.templateDir
 }
 
-func (t *Templates) makeTemplateList(s *tspec) []tinfo {
-	templateFileName := fmt.Sprintf("%s-%s%s", s.ttype, s.tname, t.fileExt)
-	sep := "-"
-	tlist := []tinfo{}
+// Evict removes all cached entries, including negative (not found) entries,
+// for a template id (type-name, e.g. graph-vm) regardless of the os type,
+// distro, version or architecture they were resolved for. The next request
+// for the template will re-check the filesystem. Returns the number of
+// entries removed.
+func (t *Templates) Evict(id string) int {
+	if t.cache == nil {
+		return 0
+	}
+	return t.cache.evict(id)
+}
+
+// Flush removes all cached entries, the next request for any template will
+// re-check the filesystem. Returns the number of entries removed.
+func (t *Templates) Flush() int {
+	if t.cache == nil {
+		return 0
+	}
+	return t.cache.flush()
+}
+
+// searchPath returns the template directories to check for a platform, most
+// specific first, ending with the default (top level template directory).
+// The distro levels of any alternate distros follow those of the distro.
+func (t *Templates) searchPath(s *tspec) []tdir {
+	dirs := []tdir{}
 
 	if s.ostype != "" {
 		if s.osdist != "" {
-			if s.osvers != "" {
-				if s.sysarch != "" {
-					tlist = append(tlist, tinfo{
-						key:      strings.Join([]string{s.ostype, s.osdist, s.osvers, s.sysarch, s.ttype, s.tname}, sep),
-						filename: path.Join(t.templateDir, s.ostype, s.osdist, s.osvers, s.sysarch, templateFileName),
-					})
+			dists := append([]Distro{{Name: s.osdist, Vers: s.osvers}}, s.alts...)
+			for i, d := range dists {
+				// what resolves below this distro depends on the
+				// alternates which follow, they are part of the cache key
+				suffix := ""
+				for _, alt := range dists[i+1:] {
+					suffix += "+" + alt.Name + "/" + alt.Vers
 				}
-				tlist = append(tlist, tinfo{
-					key:      strings.Join([]string{s.ostype, s.osdist, s.osvers, s.ttype, s.tname}, sep),
-					filename: path.Join(t.templateDir, s.ostype, s.osdist, s.osvers, templateFileName),
-				})
+				if d.Vers != "" {
+					if s.sysarch != "" {
+						// canonical arch directory first, then any aliases (e.g. x86_64, amd64)
+						for _, a := range arch.Names(s.sysarch) {
+							dirs = append(dirs, tdir{level: LevelArch, parts: []string{s.ostype, d.Name, d.Vers, a}, suffix: suffix})
+						}
+					}
+					dirs = append(dirs, tdir{level: LevelVersion, parts: []string{s.ostype, d.Name, d.Vers}, suffix: suffix})
+				}
+				dirs = append(dirs, tdir{level: LevelDistro, parts: []string{s.ostype, d.Name}, suffix: suffix})
 			}
-			tlist = append(tlist, tinfo{
-				key:      strings.Join([]string{s.ostype, s.osdist, s.ttype, s.tname}, sep),
-				filename: path.Join(t.templateDir, s.ostype, s.osdist, templateFileName),
-			})
 		}
+		dirs = append(dirs, tdir{level: LevelType, parts: []string{s.ostype}})
+	}
+
+	dirs = append(dirs, tdir{level: LevelDefault, parts: []string{}})
+
+	return dirs
+}
+
+func (t *Templates) makeTemplateList(s *tspec) []tinfo {
+	templateFileName := fmt.Sprintf("%s-%s%s", s.ttype, s.tname, t.fileExt)
+	sep := "-"
+	tlist := []tinfo{}
+
+	for _, d := range t.searchPath(s) {
+		keyParts := append(append([]string{}, d.parts...), s.ttype, s.tname)
+		pathParts := append(append([]string{t.templateDir}, d.parts...), templateFileName)
 		tlist = append(tlist, tinfo{
-			key:      strings.Join([]string{s.ostype, s.ttype, s.tname}, sep),
-			filename: path.Join(t.templateDir, s.ostype, templateFileName),
+			key:      strings.Join(keyParts, sep) + d.suffix,
+			filename: path.Join(pathParts...),
+			level:    d.level,
 		})
 	}
 
-	tlist = append(tlist, tinfo{
-		key:      strings.Join([]string{s.ttype, s.tname}, sep),
-		filename: path.Join(t.templateDir, templateFileName),
-	})
-
 	return tlist
 }
@@ -6,6 +6,8 @@
 package templates
 
 import (
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/circonus-labs/cosi-server/api"
@@ -23,7 +25,7 @@ func TestNew(t *testing.T) {
 	// no settings or parameter
 	{
 		viper.Reset()
-		_, err := New()
+		_, err := New(nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -32,7 +34,7 @@ func TestNew(t *testing.T) {
 	// missing
 	{
 		viper.Set(config.KeyContentPath, "testdata/missing")
-		_, err := New()
+		_, err := New(nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -41,7 +43,7 @@ func TestNew(t *testing.T) {
 	// not dir, passed
 	{
 		viper.Set(config.KeyContentPath, "testdata/not_dir")
-		_, err := New()
+		_, err := New(nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -50,7 +52,7 @@ func TestNew(t *testing.T) {
 	// valid
 	{
 		viper.Set(config.KeyContentPath, "testdata/")
-		_, err := New()
+		_, err := New(nil)
 		if err != nil {
 			t.Fatalf("expected NO error, got %v", err)
 		}
@@ -66,7 +68,7 @@ func TestGet(t *testing.T) {
 	viper.Set(config.KeyEnableTemplateCache, defaults.EnableTemplateCache)
 
 	viper.Set(config.KeyContentPath, "testdata/")
-	tmpl, err := New()
+	tmpl, err := New(nil)
 	if err != nil {
 		t.Fatalf("expected NO error, got %v", err)
 	}
@@ -141,3 +143,205 @@ func TestGet(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAlts(t *testing.T) {
+	t.Log("Testing Get (alternate distros)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyEnableTemplateCache, true)
+
+	viper.Set(config.KeyContentPath, "testdata/")
+	tmpl, err := New(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	ubuntu := Distro{Name: "Ubuntu", Vers: "16.04"}
+
+	tt := []struct {
+		name        string
+		key         string
+		alts        []Distro
+		expectError bool
+	}{
+		{"alt distro", "osdistro", []Distro{ubuntu}, false},
+		{"alt version", "osvers", []Distro{{Name: "debian"}, ubuntu}, false},
+		{"alt arch", "sysarch", []Distro{ubuntu}, false},
+		{"no alts (not cached from alt)", "osdistro", nil, true},
+		{"alt distro, cached", "osdistro", []Distro{ubuntu}, false},
+		{"alt, other version", "osvers", []Distro{{Name: "ubuntu", Vers: "18.04"}}, true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.name)
+		td, err := tmpl.Get("linux", "mint", "19", "x86_64", "graph", tst.key, tst.alts...)
+		if tst.expectError {
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected NO error, got (%v)", err)
+		}
+		if !strings.Contains(string(*td), tst.key) {
+			t.Fatalf("expected %s template, got %s", tst.key, string(*td))
+		}
+	}
+
+	t.Log("\tlist")
+	{
+		list, err := tmpl.List("linux", "mint", "19", "x86_64", ubuntu)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		levels := map[string]string{}
+		for _, item := range list {
+			levels[item.ID] = item.Level
+		}
+		if levels["graph-sysarch"] != LevelArch || levels["graph-osdistro"] != LevelDistro || levels["graph-ostype"] != LevelType {
+			t.Fatalf("unexpected list %#v", list)
+		}
+	}
+}
+
+func TestEvict(t *testing.T) {
+	t.Log("Testing Evict")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyEnableTemplateCache, true)
+
+	viper.Set(config.KeyContentPath, "testdata/")
+	tmpl, err := New(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	if _, err := tmpl.Get("linux", "ubuntu", "16.04", "x86_64", "graph", "cached"); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if _, err := tmpl.Get("linux", "ubuntu", "16.04", "x86_64", "graph", "osdistro"); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	if _, err := tmpl.Get("linux", "ubuntu", "16.04", "x86_64", "graph", "missing"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// one entry for the found key and each of the more specific keys
+	if n := tmpl.Evict("graph-cached"); n != 6 {
+		t.Fatalf("expected 6 entries evicted, got %d", n)
+	}
+	if n := tmpl.Evict("graph-cached"); n != 0 {
+		t.Fatalf("expected 0 entries evicted, got %d", n)
+	}
+	if n := tmpl.Evict("graph-osdistro"); n != 4 {
+		t.Fatalf("expected 4 entries evicted, got %d", n)
+	}
+	// negative entries for every level
+	if n := tmpl.Evict("graph-missing"); n != 6 {
+		t.Fatalf("expected 6 entries evicted, got %d", n)
+	}
+
+	t.Log("\tflush")
+	if _, err := tmpl.Get("linux", "ubuntu", "16.04", "x86_64", "graph", "cached"); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	if n := tmpl.Flush(); n != 6 {
+		t.Fatalf("expected 6 entries flushed, got %d", n)
+	}
+	if n := tmpl.Flush(); n != 0 {
+		t.Fatalf("expected 0 entries flushed, got %d", n)
+	}
+}
+
+func TestGetConcurrent(t *testing.T) {
+	t.Log("Testing Get (concurrent)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyEnableTemplateCache, true)
+	viper.Set(config.KeyTemplateCacheMaxEntries, 8)
+	defer viper.Set(config.KeyTemplateCacheMaxEntries, defaults.TemplateCacheMaxEntries)
+
+	viper.Set(config.KeyContentPath, "testdata/")
+	tmpl, err := New(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	names := []string{"default", "ostype", "osdistro", "osvers", "sysarch", "cached", "missing"}
+	dists := []string{"ubuntu", "centos", "debian"}
+	// templates which only exist in the linux/ubuntu tree
+	ubuntuOnly := map[string]bool{"osdistro": true, "osvers": true, "sysarch": true}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				name := names[(i+j)%len(names)]
+				dist := dists[(i*j)%len(dists)]
+				_, err := tmpl.Get("linux", dist, "16.04", "x86_64", "graph", name)
+				expectErr := name == "missing" || (dist != "ubuntu" && ubuntuOnly[name])
+				if expectErr != (err != nil) {
+					t.Errorf("%s/%s expected error %v, got %v", dist, name, expectErr, err)
+					return
+				}
+				if j%50 == 0 {
+					tmpl.Evict("graph-" + name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := tmpl.cache.len(); n > 8 {
+		t.Fatalf("expected at most 8 cache entries, got %d", n)
+	}
+}
+
+func TestGetArch(t *testing.T) {
+	t.Log("Testing Get (architecture aliases)")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyEnableTemplateCache, true)
+	viper.Set(config.KeyContentPath, "testdata/")
+	tmpl, err := New(nil)
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	tt := []struct {
+		arch  string
+		arm64 bool // arm64 directory template
+	}{
+		{"x86_64", false},
+		{"amd64", false},
+		{"aarch64", true},
+		{"arm64", true},
+	}
+
+	for _, tst := range tt {
+		t.Logf("\t%s", tst.arch)
+		data, err := tmpl.Get("linux", "ubuntu", "16.04", tst.arch, "graph", "sysarch")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if strings.Contains(string(*data), "# arm64") != tst.arm64 {
+			t.Fatalf("unexpected template for %s (%s)", tst.arch, string(*data))
+		}
+	}
+
+	if _, err := tmpl.Get("linux", "ubuntu", "16.04", "s390x", "graph", "sysarch"); err == nil {
+		t.Fatal("expected error")
+	}
+}
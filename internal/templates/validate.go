@@ -0,0 +1,191 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/circonus-labs/cosi-server/api"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// Template validation modes
+const (
+	ValidationOff        = "off"        // do not validate templates
+	ValidationQuarantine = "quarantine" // log and do not serve invalid templates
+	ValidationFail       = "fail"       // refuse to load if any template is invalid
+)
+
+// ValidationError describes an invalid template file
+type ValidationError struct {
+	File string `json:"file"`
+	Err  string `json:"error"`
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, e.Err)
+}
+
+// sampleValues are substituted into the embedded JSON templates when
+// validating, they mirror the values cosi-tool supplies when rendering.
+// numeric values are used unquoted in the templates.
+var sampleValues = map[string]interface{}{
+	"CheckID":     1234,
+	"CheckUUID":   "00000000-0000-0000-0000-000000000000",
+	"ClusterName": "cluster",
+	"ClusterTag":  "cluster:sample",
+	"GraphUUID":   "00000000-0000-0000-0000-000000000000",
+	"GroupID":     "group",
+	"HostName":    "host.example.com",
+	"HostTarget":  "host.example.com",
+	"Item":        "item",
+	"ItemIndex":   0,
+	"MetricName":  "metric`name",
+	"NumCPU":      2,
+}
+
+// Validate checks every template file in the template directory tree and
+// returns the problems found, sorted by file name
+func (t *Templates) Validate() []ValidationError {
+	return ValidateDir(t.templateDir)
+}
+
+// ValidateDir checks every template file in a template directory tree and
+// returns the problems found, sorted by file name
+func ValidateDir(dir string) []ValidationError {
+	problems := []ValidationError{}
+
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			problems = append(problems, ValidationError{File: file, Err: err.Error()})
+			return nil
+		}
+		ext := filepath.Ext(fi.Name())
+		if fi.IsDir() || (ext != api.TemplateFileExtension && ext != LegacyFileExtension) {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			problems = append(problems, ValidationError{File: file, Err: err.Error()})
+			return nil
+		}
+		if ext == LegacyFileExtension {
+			converted, err := ConvertLegacy(data)
+			if err != nil {
+				if errors.Cause(err) != ErrLegacyUnsupported {
+					problems = append(problems, ValidationError{File: file, Err: err.Error()})
+				}
+				return nil // unsupported legacy templates are never served
+			}
+			data = converted
+		}
+		if err := ValidateTemplate(file, data); err != nil {
+			problems = append(problems, ValidationError{File: file, Err: err.Error()})
+		}
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, ValidationError{File: dir, Err: err.Error()})
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].File < problems[j].File })
+
+	return problems
+}
+
+// ValidateTemplate checks the content of a template file. The template must
+// parse (strictly, no unknown keys) into an api.Template, have the required
+// type, name, version and configs, the file name must be type-name, and each
+// embedded template must be valid JSON once sample values are substituted.
+func ValidateTemplate(file string, data []byte) error {
+	if len(data) == 0 {
+		return errors.New("invalid template (empty)")
+	}
+
+	var tmpl api.Template
+	if err := toml.NewDecoder(bytes.NewReader(data)).Strict(true).Decode(&tmpl); err != nil {
+		return errors.Wrap(err, "parsing template")
+	}
+
+	if tmpl.Type == "" {
+		return errors.New("missing required 'type'")
+	}
+	if tmpl.Name == "" {
+		return errors.New("missing required 'name'")
+	}
+	if tmpl.Version == "" {
+		return errors.New("missing required 'version'")
+	}
+	if len(tmpl.Configs) == 0 {
+		return errors.New("missing required 'configs'")
+	}
+
+	if file != "" {
+		expect := strings.ToLower(tmpl.Type + "-" + tmpl.Name)
+		id := strings.ToLower(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+		if id != expect {
+			return errors.Errorf("file name (%s) does not match type-name (%s)", id, expect)
+		}
+	}
+
+	cfgNames := make([]string, 0, len(tmpl.Configs))
+	for name := range tmpl.Configs {
+		cfgNames = append(cfgNames, name)
+	}
+	sort.Strings(cfgNames)
+
+	for _, name := range cfgNames {
+		cfg := tmpl.Configs[name]
+		if strings.TrimSpace(cfg.Template) == "" {
+			return errors.Errorf("configs.%s: missing required 'template'", name)
+		}
+		if err := validateJSON(cfg.Template); err != nil {
+			return errors.Wrapf(err, "configs.%s.template", name)
+		}
+		for i, dp := range cfg.Datapoints {
+			if err := validateJSON(dp.Template); err != nil {
+				return errors.Wrapf(err, "configs.%s.datapoints[%d].template", name, i)
+			}
+		}
+		for i, w := range cfg.Widgets {
+			if err := validateJSON(w.Template); err != nil {
+				return errors.Wrapf(err, "configs.%s.widgets[%d].template", name, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateJSON renders an embedded template with sample values and
+// verifies the result is valid JSON
+func validateJSON(src string) error {
+	tmpl, err := template.New("config").Option("missingkey=error").Parse(src)
+	if err != nil {
+		return errors.Wrap(err, "parsing")
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, sampleValues); err != nil {
+		return errors.Wrap(err, "rendering")
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		return errors.Wrap(err, "invalid JSON")
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/cosi-server/internal/config"
+	"github.com/circonus-labs/cosi-server/internal/config/defaults"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	t.Log("Testing ValidateTemplate")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	tests := []struct {
+		name   string
+		file   string
+		data   string
+		errMsg string
+	}{
+		{"empty", "graph-foo.toml", "", "invalid template (empty)"},
+		{"invalid toml", "graph-foo.toml", "type = ", "parsing template"},
+		{"unknown key", "graph-foo.toml", "type = \"graph\"\nbogus = 1\n", "parsing template"},
+		{"missing type", "graph-foo.toml", "name = \"foo\"\n", "missing required 'type'"},
+		{"missing name", "graph-foo.toml", "type = \"graph\"\n", "missing required 'name'"},
+		{"missing version", "graph-foo.toml", "type = \"graph\"\nname = \"foo\"\n", "missing required 'version'"},
+		{"missing configs", "graph-foo.toml", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n", "missing required 'configs'"},
+		{"file name mismatch", "graph-bar.toml", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n[configs.a]\ntemplate = '{}'\n", "does not match"},
+		{"missing template", "graph-foo.toml", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n[configs.a]\ntemplate = ''\n", "configs.a: missing required 'template'"},
+		{"invalid json", "graph-foo.toml", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n[configs.a]\ntemplate = '{\"a\": 1,}'\n", "configs.a.template: invalid JSON"},
+		{"unknown variable", "graph-foo.toml", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n[configs.a]\ntemplate = '{\"a\": \"{{.Bogus}}\"}'\n", "configs.a.template: rendering"},
+		{"invalid datapoint", "graph-foo.toml", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n[configs.a]\ntemplate = '{}'\n[[configs.a.datapoints]]\ntemplate = '{'\n", "configs.a.datapoints[0].template"},
+		{"valid", "graph-foo.toml", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n[configs.a]\ntemplate = '{\"check_id\": {{.CheckID}}, \"host\": \"{{.HostName}}\"}'\n", ""},
+		{"valid, no file name check", "", "type = \"graph\"\nname = \"foo\"\nversion = \"1.0.0\"\n[configs.a]\ntemplate = '{}'\n", ""},
+	}
+
+	for _, test := range tests {
+		t.Logf("\t%s", test.name)
+		err := ValidateTemplate(test.file, []byte(test.data))
+		if test.errMsg == "" {
+			if err != nil {
+				t.Fatalf("expected NO error, got %v", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !strings.Contains(err.Error(), test.errMsg) {
+			t.Fatalf("expected (%s) got (%s)", test.errMsg, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Log("Testing Validate")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Reset()
+	viper.Set(config.KeyTemplateTypeRx, defaults.TemplateTypeRx)
+	viper.Set(config.KeyTemplateNameRx, defaults.TemplateNameRx)
+	viper.Set(config.KeyContentPath, "testdata/validate")
+	defer viper.Reset()
+
+	t.Log("\tinvalid mode")
+	{
+		viper.Set(config.KeyTemplateValidation, "bogus")
+		if _, err := New(nil); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tfail mode")
+	{
+		viper.Set(config.KeyTemplateValidation, ValidationFail)
+		if _, err := New(nil); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	t.Log("\tquarantine mode")
+	{
+		viper.Set(config.KeyTemplateValidation, ValidationQuarantine)
+		tmpl, err := New(nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+
+		problems := tmpl.Validate()
+		expect := []string{
+			filepath.Join("testdata", "validate", "templates", "graph-mismatch.toml"),
+			filepath.Join("testdata", "validate", "templates", "linux", "graph-good.toml"),
+		}
+		if len(problems) != len(expect) {
+			t.Fatalf("expected %d problems, got %d (%v)", len(expect), len(problems), problems)
+		}
+		for i, p := range problems {
+			if p.File != expect[i] {
+				t.Fatalf("expected (%s) got (%s)", expect[i], p.File)
+			}
+		}
+
+		// invalid linux template is skipped, default is served
+		data, err := tmpl.Get("linux", "", "", "", "graph", "good")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if !strings.Contains(string(*data), "Valid template") {
+			t.Fatalf("expected default template, got %s", string(*data))
+		}
+
+		if _, err := tmpl.Get("", "", "", "", "graph", "mismatch"); err == nil {
+			t.Fatal("expected error")
+		}
+
+		list, err := tmpl.List("linux", "", "", "")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if len(list) != 1 || list[0].ID != "graph-good" || list[0].Level != LevelDefault {
+			t.Fatalf("expected default graph-good only, got %#v", list)
+		}
+	}
+
+	t.Log("\toff")
+	{
+		viper.Set(config.KeyTemplateValidation, ValidationOff)
+		tmpl, err := New(nil)
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		data, err := tmpl.Get("linux", "", "", "", "graph", "good")
+		if err != nil {
+			t.Fatalf("expected NO error, got %v", err)
+		}
+		if strings.Contains(string(*data), "Valid template") {
+			t.Fatal("expected linux template")
+		}
+	}
+}
@@ -16,22 +16,45 @@ type Templates struct {
 	// there aren't thousands of templates for the default agent(s).
 	// additionally, the templates themselves are not overly large.
 	// the content of the templates will be cached in ready-to-serve
-	// TOML format.
-	useCache    bool
-	cache       map[string][]byte
-	index       map[string]string // mapping of keys to cache entries
+	// TOML format. cache is nil when caching is disabled.
+	cache       *templateCache
 	logger      zerolog.Logger
 	templateDir string
 	Typerx      *regexp.Regexp
 	Namerx      *regexp.Regexp
 	fileExt     string // template file extension
+	validation  string // invalid template handling mode (off, quarantine, fail)
 }
 
 type tinfo struct {
 	key      string
 	filename string
+	level    string
 }
 
+// tdir is one level of the template search path
+type tdir struct {
+	level  string
+	parts  []string // os type, distro, version, architecture directories
+	suffix string   // cache key suffix, the alternate distros searched after this level
+}
+
+// Distro is an alternate os distro and version searched, in order, after
+// the requested distro (e.g. from a distro alias or os-release ID_LIKE)
+type Distro struct {
+	Name string `json:"dist"`
+	Vers string `json:"vers"`
+}
+
+// Template search path levels, most specific first
+const (
+	LevelArch    = "arch"    // type/dist/vers/arch
+	LevelVersion = "vers"    // type/dist/vers
+	LevelDistro  = "dist"    // type/dist
+	LevelType    = "type"    // type
+	LevelDefault = "default" // top level template directory
+)
+
 type tspec struct {
 	ostype  string
 	osdist  string
@@ -39,4 +62,5 @@ type tspec struct {
 	sysarch string
 	ttype   string
 	tname   string
+	alts    []Distro
 }
@@ -0,0 +1,231 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/cosi-server/api"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Watcher monitors a template directory tree (including the type/dist/vers/arch
+// sub-directories) and calls an eviction function with the template id
+// (type-name) whenever a template file is created, changed or removed. A
+// flush function is called when a watched sub-directory is removed or renamed,
+// the templates it held are no longer known.
+type Watcher struct {
+	sync.Mutex
+	dir       string
+	dirs      map[string]bool
+	evict     func(id string)
+	flush     func()
+	fsw       *fsnotify.Watcher
+	logger    zerolog.Logger
+	running   bool
+	evictions uint64
+	lastEvict time.Time
+	lastErr   string
+}
+
+// WatcherStatus reports the state of a template directory watcher
+type WatcherStatus struct {
+	Directory    string     `json:"directory"`
+	Running      bool       `json:"running"`
+	Evictions    uint64     `json:"evictions"`
+	LastEviction *time.Time `json:"last_eviction,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// NewWatcher creates a new template directory watcher
+func NewWatcher(dir string, evict func(id string), flush func()) (*Watcher, error) {
+	if dir == "" {
+		return nil, errors.New("invalid template directory (empty)")
+	}
+	if evict == nil {
+		return nil, errors.New("invalid eviction function (nil)")
+	}
+	if flush == nil {
+		return nil, errors.New("invalid flush function (nil)")
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating fs watcher")
+	}
+
+	w := Watcher{
+		dir:    dir,
+		dirs:   map[string]bool{},
+		evict:  evict,
+		flush:  flush,
+		fsw:    fsw,
+		logger: log.With().Str("pkg", "templates.watcher").Logger(),
+	}
+
+	if err := w.addDir(dir); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// Start processes filesystem events until the context is cancelled
+func (w *Watcher) Start(ctx context.Context) {
+	w.Lock()
+	w.running = true
+	w.Unlock()
+
+	defer func() {
+		w.Lock()
+		w.running = false
+		w.Unlock()
+		w.fsw.Close()
+	}()
+
+	w.logger.Info().Str("dir", w.dir).Msg("watching templates")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn().Err(err).Msg("template watcher")
+			w.Lock()
+			w.lastErr = err.Error()
+			w.Unlock()
+		}
+	}
+}
+
+// Status returns the current state of the watcher
+func (w *Watcher) Status() WatcherStatus {
+	w.Lock()
+	defer w.Unlock()
+
+	s := WatcherStatus{
+		Directory: w.dir,
+		Running:   w.running,
+		Evictions: w.evictions,
+		LastError: w.lastErr,
+	}
+	if !w.lastEvict.IsZero() {
+		le := w.lastEvict
+		s.LastEviction = &le
+	}
+
+	return s
+}
+
+func (w *Watcher) handleEvent(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+			// new sub-directory, watch it and evict anything already in it
+			if err := w.addDir(event.Name); err != nil {
+				w.logger.Warn().Err(err).Str("dir", event.Name).Msg("adding watch")
+			}
+			return
+		}
+	}
+
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && w.removeDir(event.Name) {
+		return
+	}
+
+	w.evictFile(event.Name)
+}
+
+// addDir adds a watch for dir and every directory below it, evicting any
+// template files found (they may have been created before the watch existed)
+func (w *Watcher) addDir(dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			if dir != w.dir {
+				w.evictFile(path)
+			}
+			return nil
+		}
+		if err := w.fsw.Add(path); err != nil {
+			return errors.Wrapf(err, "watching %s", path)
+		}
+		w.Lock()
+		w.dirs[path] = true
+		w.Unlock()
+		w.logger.Debug().Str("dir", path).Msg("watching")
+		return nil
+	})
+}
+
+// removeDir drops the watches for a removed or renamed directory and every
+// directory below it, flushing all templates. Returns false if dir is not a
+// watched sub-directory.
+func (w *Watcher) removeDir(dir string) bool {
+	w.Lock()
+	if dir == w.dir || !w.dirs[dir] {
+		w.Unlock()
+		return false
+	}
+	prefix := dir + string(filepath.Separator)
+	for d := range w.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			delete(w.dirs, d)
+			_ = w.fsw.Remove(d) // already gone if the directory was removed
+		}
+	}
+	w.Unlock()
+
+	w.flush()
+
+	w.Lock()
+	w.evictions++
+	w.lastEvict = time.Now()
+	w.Unlock()
+
+	w.logger.Debug().Str("dir", dir).Msg("directory removed, flushed templates")
+	return true
+}
+
+func (w *Watcher) evictFile(file string) {
+	name := filepath.Base(file)
+	ext := filepath.Ext(name)
+	if ext != api.TemplateFileExtension && ext != LegacyFileExtension {
+		return
+	}
+	id := strings.TrimSuffix(name, ext)
+
+	w.evict(id)
+
+	w.Lock()
+	w.evictions++
+	w.lastEvict = time.Now()
+	w.Unlock()
+
+	w.logger.Debug().Str("file", file).Str("id", id).Msg("evicted template")
+}
@@ -0,0 +1,127 @@
+// Copyright © 2017 Circonus, Inc. <support@circonus.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+
+package templates
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Log("Testing Watcher")
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	// invalid
+	{
+		if _, err := NewWatcher("", func(string) {}, func() {}); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := NewWatcher("testdata/templates", nil, func() {}); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := NewWatcher("testdata/templates", func(string) {}, nil); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "cosi-templates")
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	evicted := make(chan string, 10)
+	flushed := make(chan struct{}, 10)
+	w, err := NewWatcher(dir, func(id string) { evicted <- id }, func() { flushed <- struct{}{} })
+	if err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Start(ctx)
+		close(done)
+	}()
+
+	// a single write can produce multiple events (create, write), drain
+	// until the expected id is seen
+	expect := func(id string) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case got := <-evicted:
+				if got == id {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timeout waiting for eviction of %s", id)
+			}
+		}
+	}
+
+	t.Log("\ttemplate file created")
+	if err := ioutil.WriteFile(filepath.Join(dir, "graph-foo.toml"), []byte("x"), 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	expect("graph-foo")
+
+	t.Log("\tsub-directory created")
+	sub := filepath.Join(dir, "linux", "ubuntu")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	time.Sleep(100 * time.Millisecond) // allow watch on new sub-directory to be added
+	if err := ioutil.WriteFile(filepath.Join(sub, "graph-bar.toml"), []byte("x"), 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	expect("graph-bar")
+
+	t.Log("\tnon-template file ignored")
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("x"), 0644); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+
+	t.Log("\ttemplate file removed")
+	if err := os.Remove(filepath.Join(dir, "graph-foo.toml")); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	expect("graph-foo")
+
+	t.Log("\tsub-directory renamed")
+	if err := os.Rename(filepath.Join(dir, "linux"), filepath.Join(dir, "linux.old")); err != nil {
+		t.Fatalf("expected NO error, got %v", err)
+	}
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for flush")
+	}
+	// directory renamed into the tree is watched, its templates evicted
+	expect("graph-bar")
+
+	s := w.Status()
+	if !s.Running {
+		t.Fatal("expected watcher to be running")
+	}
+	if s.LastEviction == nil {
+		t.Fatal("expected last eviction time")
+	}
+
+	cancel()
+	<-done
+
+	if w.Status().Running {
+		t.Fatal("expected watcher to be stopped")
+	}
+}